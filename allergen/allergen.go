@@ -0,0 +1,80 @@
+// Package allergen maps what customers say they are allergic to and what the
+// ordered options contain onto the allergens that must be declared in the EU.
+package allergen
+
+import (
+	"main/model"
+	"strings"
+)
+
+// EU are the 14 allergens that must be declared in the EU.
+var EU = []string{
+	"gluten", "crustaceans", "eggs", "fish", "peanuts", "soybeans", "milk",
+	"nuts", "celery", "mustard", "sesame", "sulphites", "lupin", "molluscs",
+}
+
+// allergies are free text on the customer, so the usual ways of writing them
+// are mapped to the allergen they belong to
+var aliases = map[string][]string{
+	"gluten":      {"wheat", "rye", "barley", "oats", "coeliac", "celiac"},
+	"crustaceans": {"crustacean", "shellfish", "shrimp", "prawn", "prawns", "crab", "lobster"},
+	"eggs":        {"egg"},
+	"peanuts":     {"peanut"},
+	"soybeans":    {"soy", "soya", "soybean"},
+	"milk":        {"dairy", "lactose"},
+	"nuts":        {"nut", "tree nut", "tree nuts", "almond", "almonds", "hazelnut", "hazelnuts", "walnut", "walnuts", "cashew", "cashews", "pecan", "pistachio"},
+	"sulphites":   {"sulphite", "sulfite", "sulfites"},
+	"lupin":       {"lupine"},
+	"molluscs":    {"mollusc", "mollusk", "mollusks"},
+}
+
+// Declared maps a customer's declared allergies to EU allergens; allergies
+// outside the list cannot be checked and are left out.
+func Declared(allergies []string) []string {
+	allergens := []string{}
+	for _, allergy := range allergies {
+		allergen := strings.ToLower(strings.TrimSpace(allergy))
+		for name, names := range aliases {
+			if contains(names, allergen) {
+				allergen = name
+			}
+		}
+		if contains(EU, allergen) && !contains(allergens, allergen) {
+			allergens = append(allergens, allergen)
+		}
+	}
+	return allergens
+}
+
+// Modifiers are the allergens of the selected modifier options. Options the
+// food no longer offers are skipped.
+func Modifiers(groups []model.ModifierGroup, selected []model.SelectedModifier) []string {
+	allergens := []string{}
+	for _, modifier := range selected {
+		for _, group := range groups {
+			if group.GroupID != modifier.GroupID {
+				continue
+			}
+			for _, option := range group.Options {
+				if option.OptionID != modifier.OptionID {
+					continue
+				}
+				for _, allergen := range option.Allergens {
+					if !contains(allergens, allergen) {
+						allergens = append(allergens, allergen)
+					}
+				}
+			}
+		}
+	}
+	return allergens
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
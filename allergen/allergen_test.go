@@ -0,0 +1,66 @@
+package allergen
+
+import (
+	"main/model"
+	"reflect"
+	"testing"
+)
+
+func TestDeclared(t *testing.T) {
+	tests := []struct {
+		name      string
+		allergies []string
+		want      []string
+	}{
+		{"none", nil, []string{}},
+		{"allergen names", []string{"milk", "sesame"}, []string{"milk", "sesame"}},
+		{"case and spaces", []string{"  Peanuts ", "FISH"}, []string{"peanuts", "fish"}},
+		{"aliases", []string{"Shellfish", "lactose", "tree nuts", "soya"}, []string{"crustaceans", "milk", "nuts", "soybeans"}},
+		{"coeliac", []string{"coeliac"}, []string{"gluten"}},
+		{"duplicates", []string{"egg", "eggs", "Egg"}, []string{"eggs"}},
+		{"outside the list", []string{"kiwi", "penicillin", "celery"}, []string{"celery"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Declared(test.allergies); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Declared(%v) = %v, want %v", test.allergies, got, test.want)
+			}
+		})
+	}
+}
+
+func TestModifiers(t *testing.T) {
+	groups := []model.ModifierGroup{
+		{GroupID: "sauce", Options: []model.ModifierOption{
+			{OptionID: "pesto", Allergens: []string{"nuts", "milk"}},
+			{OptionID: "tomato"},
+		}},
+		{GroupID: "extras", Options: []model.ModifierOption{
+			{OptionID: "cheese", Allergens: []string{"milk"}},
+			{OptionID: "egg", Allergens: []string{"eggs"}},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		selected []model.SelectedModifier
+		want     []string
+	}{
+		{"nothing selected", nil, []string{}},
+		{"option without allergens", []model.SelectedModifier{{GroupID: "sauce", OptionID: "tomato"}}, []string{}},
+		{"one option", []model.SelectedModifier{{GroupID: "extras", OptionID: "egg"}}, []string{"eggs"}},
+		{"shared allergen once", []model.SelectedModifier{
+			{GroupID: "sauce", OptionID: "pesto"},
+			{GroupID: "extras", OptionID: "cheese"},
+		}, []string{"nuts", "milk"}},
+		{"option of another group", []model.SelectedModifier{{GroupID: "sauce", OptionID: "egg"}}, []string{}},
+		{"removed option", []model.SelectedModifier{{GroupID: "extras", OptionID: "bacon"}}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Modifiers(groups, test.selected); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Modifiers() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,503 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/database"
+	"main/export"
+	"main/model"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var accountCollection = database.OpenCollection(db, "accounts")
+
+const defaultPaymentTermsDays = 30
+
+var (
+	errAccountRequired    = errors.New("charging to account needs an account_id")
+	errAccountNotFound    = errors.New("account was not found")
+	errAccountInactive    = errors.New("account is not active")
+	errCreditLimitReached = errors.New("the invoice would exceed the account's credit limit")
+)
+
+func GetAccounts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := "FOR account IN accounts SORT account.name RETURN account"
+		cursor, err := db.Query(exportContext(format), query, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.Account](w, format, "accounts", cursor)
+			return
+		}
+
+		accounts := []model.Account{}
+		for {
+			var account model.Account
+			_, err := cursor.ReadDocument(context.TODO(), &account)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read accounts"})
+				return
+			}
+
+			accounts = append(accounts, account)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(accounts)
+	}
+}
+
+func GetAccountByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accountID := chi.URLParam(r, "account_id")
+		var account model.Account
+
+		meta, err := accountCollection.ReadDocument(context.TODO(), accountID, &account)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch account"})
+			return
+		}
+
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(account)
+	}
+}
+
+func CreateAccount() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var account model.Account
+		err := json.NewDecoder(r.Body).Decode(&account)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(account)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		if account.PaymentTermsDays == nil {
+			terms := defaultPaymentTermsDays
+			account.PaymentTermsDays = &terms
+		}
+		if account.Active == nil {
+			active := true
+			account.Active = &active
+		}
+
+		account.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		account.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		account.AccountID = uuid.NewString()
+
+		meta, err := accountCollection.CreateDocument(context.TODO(), account)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to create account"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func UpdateAccountByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accountID := chi.URLParam(r, "account_id")
+		var account model.Account
+		err := json.NewDecoder(r.Body).Decode(&account)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.StructPartial(account, "Email", "PaymentTermsDays", "CreditLimit")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		updateObject := make(map[string]interface{})
+
+		if account.Name != nil {
+			if validate.Var(*account.Name, "min=2,max=100") != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "name must be between 2 and 100 characters"})
+				return
+			}
+			updateObject["name"] = account.Name
+		}
+		if account.ContactName != nil {
+			updateObject["contact_name"] = account.ContactName
+		}
+		if account.Email != nil {
+			updateObject["email"] = account.Email
+		}
+		if account.Phone != nil {
+			updateObject["phone"] = account.Phone
+		}
+		if account.BillingAddress != nil {
+			updateObject["billing_address"] = account.BillingAddress
+		}
+		if account.PaymentTermsDays != nil {
+			updateObject["payment_terms_days"] = account.PaymentTermsDays
+		}
+		if account.CreditLimit != nil {
+			updateObject["credit_limit"] = account.CreditLimit
+		}
+		if account.Active != nil {
+			updateObject["active"] = account.Active
+		}
+
+		account.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObject["updated_at"] = account.UpdatedAt
+
+		meta, err := accountCollection.UpdateDocument(revisionContext(r), accountID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update account"})
+			return
+		}
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func DeleteAccountByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accountID := chi.URLParam(r, "account_id")
+
+		openInvoices, err := accountOpenInvoices(accountID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch open invoices"})
+			return
+		}
+		if len(openInvoices) > 0 {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "account has open invoices"})
+			return
+		}
+
+		meta, err := accountCollection.RemoveDocument(revisionContext(r), accountID)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to delete account"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+// GetAccountStatement lists the charges, payments and credits of an account
+// between from and to with a running balance. Only issued invoices are
+// charged, at their frozen totals.
+func GetAccountStatement() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		accountID := chi.URLParam(r, "account_id")
+		from, to, err := parseReportRange(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		var account model.Account
+		_, err = accountCollection.ReadDocument(context.TODO(), accountID, &account)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": errAccountNotFound.Error()})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch account"})
+			return
+		}
+
+		statement, err := accountStatement(account, from, to)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to build statement"})
+			return
+		}
+
+		if format != "" {
+			exportSlice(w, format, "statement-"+accountID, statement.Lines)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(statement)
+	}
+}
+
+func accountStatement(account model.Account, from, to time.Time) (model.AccountStatement, error) {
+	statement := model.AccountStatement{Account: account, From: from, To: to, Lines: []model.StatementLine{}}
+
+	query := `
+	FOR invoice IN invoices
+		FILTER invoice.account_id == @account_id AND invoice.invoice_number != null
+		LET creditNotes = (
+			FOR note IN creditNotes
+				FILTER note.invoice_id == invoice._key
+				RETURN note
+		)
+		RETURN { invoice: invoice, credit_notes: creditNotes }`
+	cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"account_id": account.AccountID})
+	if err != nil {
+		return statement, err
+	}
+	defer cursor.Close()
+
+	now := time.Now()
+	entries := []model.StatementLine{}
+	for {
+		var row struct {
+			Invoice     model.Invoice      `json:"invoice"`
+			CreditNotes []model.CreditNote `json:"credit_notes"`
+		}
+		_, err := cursor.ReadDocument(context.TODO(), &row)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return statement, err
+		}
+
+		invoice := row.Invoice
+		amount, err := invoiceAmountDue(invoice)
+		if err != nil {
+			return statement, err
+		}
+		reference := invoice.InvoiceID
+		if invoice.InvoiceNumber != nil {
+			reference = *invoice.InvoiceNumber
+		}
+		dueDate := invoice.PaymentDueDate
+
+		entries = append(entries, model.StatementLine{
+			Date:      invoice.CreatedAt,
+			Type:      "CHARGE",
+			InvoiceID: invoice.InvoiceID,
+			Reference: reference,
+			DueDate:   &dueDate,
+			Amount:    amount,
+		})
+		settledAt := invoice.SettledAt
+		if settledAt == nil && invoice.PaymentStatus != nil && *invoice.PaymentStatus == "PAID" {
+			// settled before settlements were recorded apart from issuing
+			settledAt = invoice.PaidAt
+		}
+		if settledAt != nil {
+			entries = append(entries, model.StatementLine{
+				Date:      *settledAt,
+				Type:      "PAYMENT",
+				InvoiceID: invoice.InvoiceID,
+				Reference: reference,
+				Amount:    -amount,
+			})
+		} else if dueDate.Before(now) {
+			statement.Overdue += amount
+		}
+		for _, note := range row.CreditNotes {
+			entries = append(entries, model.StatementLine{
+				Date:      note.CreatedAt,
+				Type:      "CREDIT",
+				InvoiceID: invoice.InvoiceID,
+				Reference: note.CreditNoteNumber,
+				Amount:    -note.Total,
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+
+	balance := 0.0
+	for _, entry := range entries {
+		if !entry.Date.Before(to) {
+			break
+		}
+		balance += entry.Amount
+		if entry.Date.Before(from) {
+			statement.OpeningBalance = balance
+			continue
+		}
+
+		switch entry.Type {
+		case "CHARGE":
+			statement.Charges += entry.Amount
+		case "PAYMENT":
+			statement.Payments -= entry.Amount
+		case "CREDIT":
+			statement.Credits -= entry.Amount
+		}
+		entry.Balance = roundMoney(balance)
+		statement.Lines = append(statement.Lines, entry)
+	}
+
+	statement.OpeningBalance = roundMoney(statement.OpeningBalance)
+	statement.Charges = roundMoney(statement.Charges)
+	statement.Payments = roundMoney(statement.Payments)
+	statement.Credits = roundMoney(statement.Credits)
+	statement.ClosingBalance = roundMoney(balance)
+	statement.Overdue = roundMoney(statement.Overdue)
+	statement.GeneratedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	return statement, nil
+}
+
+// applyAccount checks that an invoice may be charged to its account and sets
+// the due date from the account's payment terms.
+func applyAccount(invoice *model.Invoice) error {
+	if invoice.AccountID == nil || *invoice.AccountID == "" {
+		invoice.AccountID = nil
+		if invoice.PaymentMethod != nil && *invoice.PaymentMethod == "ACCOUNT" {
+			return errAccountRequired
+		}
+		return nil
+	}
+
+	var account model.Account
+	_, err := accountCollection.ReadDocument(context.TODO(), *invoice.AccountID, &account)
+	if driver.IsNotFound(err) {
+		return errAccountNotFound
+	} else if err != nil {
+		return err
+	}
+	if account.Active != nil && !*account.Active {
+		return errAccountInactive
+	}
+
+	if invoice.PaymentMethod == nil || *invoice.PaymentMethod == "" {
+		paymentMethod := "ACCOUNT"
+		invoice.PaymentMethod = &paymentMethod
+	}
+	terms := defaultPaymentTermsDays
+	if account.PaymentTermsDays != nil {
+		terms = *account.PaymentTermsDays
+	}
+	invoice.PaymentDueDate, _ = time.Parse(time.RFC3339, time.Now().AddDate(0, 0, terms).Format(time.RFC3339))
+
+	if account.CreditLimit == nil {
+		return nil
+	}
+	openInvoices, err := accountOpenInvoices(account.AccountID)
+	if err != nil {
+		return err
+	}
+	balance, err := invoiceAmountDue(*invoice)
+	if err != nil {
+		return err
+	}
+	for _, open := range openInvoices {
+		if open.InvoiceID == invoice.InvoiceID {
+			continue
+		}
+		amount, err := invoiceAmountDue(open)
+		if err != nil {
+			return err
+		}
+		balance += amount
+	}
+	if roundMoney(balance) > *account.CreditLimit {
+		return errCreditLimitReached
+	}
+	return nil
+}
+
+// chargedToAccount reports whether the invoice goes on its account's bill
+// instead of being paid at the till.
+func chargedToAccount(invoice model.Invoice) bool {
+	return invoice.AccountID != nil && invoice.PaymentMethod != nil && *invoice.PaymentMethod == "ACCOUNT"
+}
+
+func accountFailed(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errAccountRequired), errors.Is(err, errAccountNotFound), errors.Is(err, errAccountInactive):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+	case errors.Is(err, errCreditLimitReached):
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(status{"error": "failed to charge invoice to account"})
+	}
+}
+
+func accountOpenInvoices(accountID string) ([]model.Invoice, error) {
+	query := `
+	FOR invoice IN invoices
+		FILTER invoice.account_id == @account_id AND invoice.payment_status != "PAID"
+		RETURN invoice`
+	cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"account_id": accountID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	invoices := []model.Invoice{}
+	for {
+		var invoice model.Invoice
+		_, err := cursor.ReadDocument(context.TODO(), &invoice)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, invoice)
+	}
+	return invoices, nil
+}
+
+// invoiceAmountDue is the frozen total of an issued invoice, or what the
+// invoice would come to if it were paid now.
+func invoiceAmountDue(invoice model.Invoice) (float64, error) {
+	if invoiceIsLocked(invoice) {
+		return invoice.Total, nil
+	}
+	data, err := invoiceReceipt(invoice)
+	if err != nil {
+		return 0, err
+	}
+	return data.Total, nil
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"main/allergen"
+	"main/model"
+	"net/http"
+	"strings"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+)
+
+var dietaryTags = []string{"vegan", "vegetarian", "gluten-free", "halal"}
+
+// GetOrderAllergenWarnings lists the items of an order that contain
+// allergens its customer declared.
+func GetOrderAllergenWarnings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orderID := chi.URLParam(r, "order_id")
+		var order model.Order
+
+		_, err := orderCollection.ReadDocument(context.TODO(), orderID, &order)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": "order was not found"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch order item"})
+			return
+		}
+
+		query := "FOR orderItem IN orderItems FILTER orderItem.order_id == @order_id RETURN orderItem"
+		orderItems, err := readAll[model.OrderItem](context.TODO(), query, map[string]interface{}{"order_id": orderID})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to read order items"})
+			return
+		}
+
+		warnings, err := allergenWarnings(order.CustomerID, orderItems)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to check allergens"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(warnings)
+	}
+}
+
+// orderAllergenWarnings lists the ordered items that contain something the
+// customer is allergic to, for the response of the request that ordered
+// them. The order goes through either way, so a failed check is only logged.
+func orderAllergenWarnings(customerID *string, orderItems []model.OrderItem) []model.AllergenWarning {
+	warnings, err := allergenWarnings(customerID, orderItems)
+	if err != nil {
+		log.Println("failed to check allergens:", err)
+		return []model.AllergenWarning{}
+	}
+	return warnings
+}
+
+func allergenWarnings(customerID *string, orderItems []model.OrderItem) ([]model.AllergenWarning, error) {
+	warnings := []model.AllergenWarning{}
+	if customerID == nil {
+		return warnings, nil
+	}
+
+	var customer model.Customer
+	_, err := customerCollection.ReadDocument(context.TODO(), *customerID, &customer)
+	if driver.IsNotFound(err) {
+		return warnings, nil
+	} else if err != nil {
+		return nil, err
+	}
+	allergies := allergen.Declared(customer.Allergies)
+	if len(allergies) == 0 {
+		return warnings, nil
+	}
+
+	for _, orderItem := range orderItems {
+		if orderItem.FoodID == nil {
+			continue
+		}
+		var food model.Food
+		_, err := foodCollection.ReadDocument(context.TODO(), *orderItem.FoodID, &food)
+		if driver.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		allergens, err := foodAllergens(food)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range allergen.Modifiers(food.ModifierGroups, orderItem.Modifiers) {
+			if !contains(allergens, name) {
+				allergens = append(allergens, name)
+			}
+		}
+
+		warning := model.AllergenWarning{OrderItemID: orderItem.OrderItemID, FoodID: food.FoodID, FoodName: orderItem.FoodName}
+		if warning.FoodName == "" && food.Name != nil {
+			warning.FoodName = *food.Name
+		}
+		for _, name := range allergens {
+			if contains(allergies, name) {
+				warning.Allergens = append(warning.Allergens, name)
+			}
+		}
+		if len(warning.Allergens) > 0 {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings, nil
+}
+
+// foodAllergens are the allergens of the food and, for a combo, those of its
+// components.
+func foodAllergens(food model.Food) ([]string, error) {
+	allergens := append([]string{}, food.Allergens...)
+	for _, item := range food.ComboItems {
+		var component model.Food
+		_, err := foodCollection.ReadDocument(context.TODO(), item.FoodID, &component)
+		if driver.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, name := range component.Allergens {
+			if !contains(allergens, name) {
+				allergens = append(allergens, name)
+			}
+		}
+	}
+	return allergens, nil
+}
+
+// normalizeTags lower cases the tags and drops duplicates.
+func normalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// tagFilter reads a comma separated query parameter and rejects values
+// outside allowed.
+func tagFilter(r *http.Request, name string, allowed []string) ([]string, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	tags := normalizeTags(strings.Split(value, ","))
+	for _, tag := range tags {
+		if !contains(allowed, tag) {
+			return nil, fmt.Errorf("unknown %s %q", name, tag)
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/model"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+)
+
+var foodAvailabilityEvents = newEventHub[model.FoodAvailabilityEvent]()
+
+func publishFoodAvailability(food model.Food) {
+	foodAvailabilityEvents.publish(model.FoodAvailabilityEvent{
+		FoodID:            food.FoodID,
+		Name:              *food.Name,
+		Available:         food.Available == nil || *food.Available,
+		RemainingPortions: food.RemainingPortions,
+		SoldOut:           foodSoldOut(food),
+	})
+}
+
+func UpdateFoodAvailability() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		foodID := chi.URLParam(r, "food_id")
+		var availability model.FoodAvailability
+		err := json.NewDecoder(r.Body).Decode(&availability)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(availability)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		updateObject := make(map[string]interface{})
+
+		if availability.Available != nil {
+			updateObject["available"] = availability.Available
+		}
+		if availability.RemainingPortions != nil {
+			updateObject["remaining_portions"] = availability.RemainingPortions
+		} else if availability.ClearPortions {
+			updateObject["remaining_portions"] = nil
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObject["updated_at"] = updatedAt
+
+		var food model.Food
+		ctx := driver.WithReturnNew(revisionContext(r), &food)
+
+		meta, err := foodCollection.UpdateDocument(ctx, foodID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update food availability"})
+			return
+		}
+
+		publishFoodAvailability(food)
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+// GetFoodAvailabilityEvents streams availability changes as server-sent
+// events so that listings can update without polling.
+func GetFoodAvailabilityEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		streamEvents(w, r, foodAvailabilityEvents, "availability")
+	}
+}
+
+func foodSoldOut(food model.Food) bool {
+	if food.Available != nil && !*food.Available {
+		return true
+	}
+	return food.RemainingPortions != nil && *food.RemainingPortions <= 0
+}
+
+var errFoodSoldOut = errors.New("food is sold out")
+
+const reservePortionsQuery = `
+	FOR food IN foods
+		FILTER food._key == @food_id
+		FILTER food.available != false
+		FILTER food.remaining_portions == null OR food.remaining_portions >= @quantity
+		UPDATE food WITH {
+			remaining_portions: food.remaining_portions == null ? null : food.remaining_portions - @quantity
+		} IN foods
+		RETURN NEW`
+
+const releasePortionsQuery = `
+	FOR food IN foods
+		FILTER food._key == @food_id
+		FILTER food.remaining_portions != null
+		UPDATE food WITH {
+			remaining_portions: food.remaining_portions + @quantity
+		} IN foods
+		RETURN NEW`
+
+// reservePortions atomically takes portions of a food that has not been
+// 86'd. It reports false when the food is sold out or has too few portions.
+func reservePortions(foodID string, quantity float64) (bool, error) {
+	food, err := changePortions(context.TODO(), reservePortionsQuery, foodID, quantity)
+	publishPortions(food)
+	return food != nil, err
+}
+
+// releasePortions gives portions taken by reservePortions back to the food.
+func releasePortions(foodID string, quantity float64) error {
+	food, err := changePortions(context.TODO(), releasePortionsQuery, foodID, quantity)
+	publishPortions(food)
+	return err
+}
+
+// changePortions runs a portion query and returns the changed food, or nil
+// when the food did not qualify.
+func changePortions(ctx context.Context, query, foodID string, quantity float64) (*model.Food, error) {
+	bindVars := map[string]interface{}{
+		"food_id":  foodID,
+		"quantity": quantity,
+	}
+	cursor, err := db.Query(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var food model.Food
+	_, err = cursor.ReadDocument(ctx, &food)
+	if driver.IsNoMoreDocuments(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &food, nil
+}
+
+func publishPortions(food *model.Food) {
+	if food != nil && food.RemainingPortions != nil {
+		publishFoodAvailability(*food)
+	}
+}
@@ -0,0 +1,453 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/model"
+	"math"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/google/uuid"
+)
+
+const maxBatchSize = 1000
+
+// batchCollection describes how documents of one resource are created and
+// patched in bulk. Orders, order items and invoices have no batch endpoints:
+// writing an order item reserves portions, moves stock and reprices the
+// order's promotions, and invoices are numbered into the fiscal hash chain
+// and move loyalty points and gift card balances. None of that fits a plain
+// multi-document write, so they are changed one at a time through their own
+// endpoints.
+type batchCollection[T any] struct {
+	collection driver.Collection
+	// fields that only have their own endpoints may change
+	readOnly []string
+	// prepareCreate checks a new document and fills in its defaults
+	prepareCreate func(doc *T) error
+	// prepareUpdate checks the patched fields of a partially decoded document
+	prepareUpdate func(doc *T, fields map[string]bool) error
+	// cleanup is called before documents are deleted and returns a function
+	// that removes what the deleted ones leave behind
+	cleanup func(keys []string) func()
+}
+
+var foodBatch = batchCollection[model.Food]{
+	collection: foodCollection,
+	readOnly:   []string{"available", "remaining_portions", "images"},
+	prepareCreate: func(food *model.Food) error {
+		food.Images = nil
+
+		var menu model.Menu
+		_, err := menuCollection.ReadDocument(context.TODO(), *food.MenuID, &menu)
+		if err != nil {
+			return errors.New("menu was not found")
+		}
+		if err := prepareModifierGroups(food.ModifierGroups); err != nil {
+			return err
+		}
+		if err := checkComboItems(food.ComboItems); err != nil {
+			return err
+		}
+		if err := prepareRecipe(food.Recipe); err != nil {
+			return err
+		}
+
+		if food.Available == nil {
+			available := true
+			food.Available = &available
+		}
+		price := math.Round(*food.UnitPrice*100) / 100
+		food.UnitPrice = &price
+		return nil
+	},
+	prepareUpdate: func(food *model.Food, fields map[string]bool) error {
+		if fields["unit_price"] {
+			price := math.Round(*food.UnitPrice*100) / 100
+			food.UnitPrice = &price
+		}
+		if fields["menu_id"] {
+			var menu model.Menu
+			_, err := menuCollection.ReadDocument(context.TODO(), *food.MenuID, &menu)
+			if err != nil {
+				return errors.New("menu was not found")
+			}
+		}
+		if fields["modifier_groups"] {
+			if err := prepareModifierGroups(food.ModifierGroups); err != nil {
+				return err
+			}
+		}
+		if fields["combo_items"] {
+			if err := checkComboItems(food.ComboItems); err != nil {
+				return err
+			}
+		}
+		if fields["recipe"] {
+			return prepareRecipe(food.Recipe)
+		}
+		return nil
+	},
+	cleanup: foodImageCleanup,
+}
+
+var menuBatch = batchCollection[model.Menu]{
+	collection: menuCollection,
+	prepareCreate: func(menu *model.Menu) error {
+		return checkMenuAvailability(*menu)
+	},
+	prepareUpdate: func(menu *model.Menu, fields map[string]bool) error {
+		err := checkMenuDates(menu.MenuID, menu.StartDate, menu.EndDate)
+		if err == nil && fields["timezone"] {
+			err = checkMenuTimezone(menu.Timezone)
+		}
+		return err
+	},
+}
+
+var tableBatch = batchCollection[model.Table]{
+	collection: tableCollection,
+}
+
+var ingredientBatch = batchCollection[model.Ingredient]{
+	collection: ingredientCollection,
+	readOnly:   []string{"unit", "stock_on_hand"},
+	prepareCreate: func(ingredient *model.Ingredient) error {
+		return checkIngredientSupplier(ingredient.SupplierID)
+	},
+	prepareUpdate: func(ingredient *model.Ingredient, fields map[string]bool) error {
+		return checkIngredientSupplier(ingredient.SupplierID)
+	},
+}
+
+var supplierBatch = batchCollection[model.Supplier]{
+	collection: supplierCollection,
+}
+
+func checkIngredientSupplier(supplierID *string) error {
+	if supplierID == nil {
+		return nil
+	}
+	var supplier model.Supplier
+	_, err := supplierCollection.ReadDocument(context.TODO(), *supplierID, &supplier)
+	if err != nil {
+		return errors.New("supplier was not found")
+	}
+	return nil
+}
+
+func BatchCreateFoods() http.HandlerFunc       { return batchCreate(foodBatch) }
+func BatchUpdateFoods() http.HandlerFunc       { return batchUpdate(foodBatch) }
+func BatchDeleteFoods() http.HandlerFunc       { return batchDelete(foodBatch) }
+func BatchCreateMenus() http.HandlerFunc       { return batchCreate(menuBatch) }
+func BatchUpdateMenus() http.HandlerFunc       { return batchUpdate(menuBatch) }
+func BatchDeleteMenus() http.HandlerFunc       { return batchDelete(menuBatch) }
+func BatchCreateTables() http.HandlerFunc      { return batchCreate(tableBatch) }
+func BatchUpdateTables() http.HandlerFunc      { return batchUpdate(tableBatch) }
+func BatchDeleteTables() http.HandlerFunc      { return batchDelete(tableBatch) }
+func BatchCreateIngredients() http.HandlerFunc { return batchCreate(ingredientBatch) }
+func BatchUpdateIngredients() http.HandlerFunc { return batchUpdate(ingredientBatch) }
+func BatchDeleteIngredients() http.HandlerFunc { return batchDelete(ingredientBatch) }
+func BatchCreateSuppliers() http.HandlerFunc   { return batchCreate(supplierBatch) }
+func BatchUpdateSuppliers() http.HandlerFunc   { return batchUpdate(supplierBatch) }
+func BatchDeleteSuppliers() http.HandlerFunc   { return batchDelete(supplierBatch) }
+
+// batchCreate inserts an array of documents. Every document is validated like
+// a single create; invalid ones are reported and the rest are inserted, unless
+// ?atomic=true asks for all or nothing.
+func batchCreate[T any](batch batchCollection[T]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var items []json.RawMessage
+		if !decodeBatch(w, r, &items) {
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		response := newBatchResponse(r, len(items))
+		docs, indexes := []T{}, []int{}
+
+		for i, item := range items {
+			var doc T
+			err := json.Unmarshal(item, &doc)
+			if err == nil {
+				err = validate.Struct(doc)
+			}
+			if err == nil && batch.prepareCreate != nil {
+				err = batch.prepareCreate(&doc)
+			}
+			if err != nil {
+				response.Results[i].Error = err.Error()
+				continue
+			}
+
+			key := uuid.NewString()
+			stampDocument(&doc, key, now)
+			response.Results[i].Key = key
+			docs = append(docs, doc)
+			indexes = append(indexes, i)
+		}
+
+		runBatch(w, response, batch.collection, indexes, func(ctx context.Context) (driver.ErrorSlice, error) {
+			_, errs, err := batch.collection.CreateDocuments(ctx, docs)
+			return errs, err
+		})
+	}
+}
+
+// batchUpdate applies an array of partial documents identified by their
+// _key. Only the fields present in a patch are validated and written.
+func batchUpdate[T any](batch batchCollection[T]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var items []map[string]json.RawMessage
+		if !decodeBatch(w, r, &items) {
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		response := newBatchResponse(r, len(items))
+		keys, patches, indexes := []string{}, []map[string]interface{}{}, []int{}
+		fieldsByName := jsonFields(reflect.TypeOf((*T)(nil)).Elem())
+
+		for i, item := range items {
+			var key string
+			json.Unmarshal(item["_key"], &key)
+			response.Results[i].Key = key
+
+			patch, err := batchPatch(batch, item, fieldsByName)
+			if key == "" {
+				err = errors.New("_key is required")
+			}
+			if err != nil {
+				response.Results[i].Error = err.Error()
+				continue
+			}
+
+			patch["updated_at"] = now
+			keys = append(keys, key)
+			patches = append(patches, patch)
+			indexes = append(indexes, i)
+		}
+
+		runBatch(w, response, batch.collection, indexes, func(ctx context.Context) (driver.ErrorSlice, error) {
+			_, errs, err := batch.collection.UpdateDocuments(ctx, keys, patches)
+			return errs, err
+		})
+	}
+}
+
+// batchDelete removes the documents whose keys are given as a json array.
+func batchDelete[T any](batch batchCollection[T]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var keys []string
+		if !decodeBatch(w, r, &keys) {
+			return
+		}
+
+		response := newBatchResponse(r, len(keys))
+		validKeys, indexes := []string{}, []int{}
+		for i, key := range keys {
+			response.Results[i].Key = key
+			if key == "" {
+				response.Results[i].Error = "_key is required"
+				continue
+			}
+			validKeys = append(validKeys, key)
+			indexes = append(indexes, i)
+		}
+
+		if batch.cleanup != nil {
+			defer batch.cleanup(validKeys)()
+		}
+		runBatch(w, response, batch.collection, indexes, func(ctx context.Context) (driver.ErrorSlice, error) {
+			_, errs, err := batch.collection.RemoveDocuments(ctx, validKeys)
+			return errs, err
+		})
+	}
+}
+
+func decodeBatch(w http.ResponseWriter, r *http.Request, items interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(items)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(status{"error": "batch requests must be a json array"})
+		return false
+	}
+
+	if n := reflect.ValueOf(items).Elem().Len(); n == 0 || n > maxBatchSize {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(status{"error": fmt.Sprintf("batch requests must contain between 1 and %d items", maxBatchSize)})
+		return false
+	}
+	return true
+}
+
+func newBatchResponse(r *http.Request, n int) model.BatchResponse {
+	response := model.BatchResponse{
+		Atomic:  r.URL.Query().Get("atomic") == "true",
+		Results: make([]model.BatchResult, n),
+	}
+	for i := range response.Results {
+		response.Results[i].Index = i
+	}
+	return response
+}
+
+// runBatch performs the multi-document operation for the items that passed
+// their checks. In atomic mode nothing is written when any item fails, and the
+// operation runs in a stream transaction so a failing document rolls back the
+// ones written before it.
+func runBatch(w http.ResponseWriter, response model.BatchResponse, col driver.Collection, indexes []int, operation func(context.Context) (driver.ErrorSlice, error)) {
+	failed := len(indexes) < len(response.Results)
+
+	if !(response.Atomic && failed) && len(indexes) > 0 {
+		ctx := context.TODO()
+		var transactionID driver.TransactionID
+		if response.Atomic {
+			var err error
+			transactionID, err = db.BeginTransaction(ctx, driver.TransactionCollections{Write: []string{col.Name()}}, nil)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to begin transaction"})
+				return
+			}
+			ctx = driver.WithTransactionID(ctx, transactionID)
+		}
+
+		errs, err := operation(ctx)
+		if err != nil {
+			if response.Atomic {
+				db.AbortTransaction(context.TODO(), transactionID, nil)
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute batch"})
+			return
+		}
+
+		for i, err := range errs {
+			if err != nil {
+				response.Results[indexes[i]].Error = batchError(err)
+				failed = true
+			}
+		}
+
+		if response.Atomic {
+			if failed {
+				err = db.AbortTransaction(context.TODO(), transactionID, nil)
+			} else {
+				err = db.CommitTransaction(context.TODO(), transactionID, nil)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to finish transaction"})
+				return
+			}
+		}
+	}
+
+	for i := range response.Results {
+		result := &response.Results[i]
+		result.OK = result.Error == "" && !(response.Atomic && failed)
+		if result.OK {
+			response.Succeeded++
+		} else {
+			response.Failed++
+			if result.Error == "" {
+				result.Error = "not applied because another item failed"
+			}
+		}
+	}
+
+	if response.Atomic && failed {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func batchError(err error) string {
+	switch {
+	case driver.IsNotFound(err):
+		return "document was not found"
+	case driver.IsConflict(err):
+		return "document conflicts with an existing one"
+	}
+	return err.Error()
+}
+
+// batchPatch type checks and validates the fields of one patch and returns
+// them as an update object.
+func batchPatch[T any](batch batchCollection[T], item map[string]json.RawMessage, fieldsByName map[string]reflect.StructField) (map[string]interface{}, error) {
+	var doc T
+	encoded, _ := json.Marshal(item)
+	err := json.Unmarshal(encoded, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]bool)
+	fieldNames := []string{}
+	for name := range item {
+		if name == "_key" {
+			continue
+		}
+		field, ok := fieldsByName[name]
+		if !ok || name == "created_at" || name == "updated_at" {
+			return nil, fmt.Errorf("%s cannot be updated", name)
+		}
+		for _, readOnly := range batch.readOnly {
+			if name == readOnly {
+				return nil, fmt.Errorf("%s cannot be updated in a batch", name)
+			}
+		}
+		fields[name] = true
+		fieldNames = append(fieldNames, field.Name)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("patch has no fields to update")
+	}
+
+	err = validate.StructPartial(doc, fieldNames...)
+	if err == nil && batch.prepareUpdate != nil {
+		err = batch.prepareUpdate(&doc, fields)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value := reflect.ValueOf(doc)
+	patch := make(map[string]interface{})
+	for name := range fields {
+		patch[name] = value.FieldByIndex(fieldsByName[name].Index).Interface()
+	}
+	return patch, nil
+}
+
+func jsonFields(docType reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < docType.NumField(); i++ {
+		field := docType.Field(i)
+		if name := field.Tag.Get("json"); name != "" && name != "-" {
+			fields[name] = field
+		}
+	}
+	return fields
+}
+
+// stampDocument sets the key and timestamps that single creates fill in.
+func stampDocument(doc interface{}, key string, now time.Time) {
+	value := reflect.ValueOf(doc).Elem()
+	for name, field := range jsonFields(value.Type()) {
+		switch name {
+		case "_key":
+			value.FieldByIndex(field.Index).SetString(key)
+		case "created_at", "updated_at":
+			value.FieldByIndex(field.Index).Set(reflect.ValueOf(now))
+		}
+	}
+}
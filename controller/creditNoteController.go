@@ -0,0 +1,356 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"main/database"
+	"main/export"
+	"main/fiscal"
+	"main/model"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var creditNoteCollection = database.OpenCollection(db, "creditNotes")
+
+var (
+	errInvoiceNotPaid  = errors.New("only issued invoices can be credited")
+	errInvoiceReplaced = errors.New("the invoice was already replaced by a corrected invoice")
+)
+
+func init() {
+	database.EnsureUniqueIndex(creditNoteCollection, "credit_note_number")
+}
+
+func GetCreditNotes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := `
+		FOR note IN creditNotes
+			FILTER @invoice_id == null OR note.invoice_id == @invoice_id
+			SORT note.created_at DESC
+			LIMIT @limit
+			RETURN note`
+		bindVars := map[string]interface{}{"invoice_id": nil, "limit": listLimit(format)}
+		if invoiceID := r.URL.Query().Get("invoice_id"); invoiceID != "" {
+			bindVars["invoice_id"] = invoiceID
+		}
+
+		cursor, err := db.Query(exportContext(format), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.CreditNote](w, format, "credit-notes", cursor)
+			return
+		}
+
+		creditNotes := []model.CreditNote{}
+		for {
+			var creditNote model.CreditNote
+			_, err := cursor.ReadDocument(context.TODO(), &creditNote)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read credit notes"})
+				return
+			}
+
+			creditNotes = append(creditNotes, creditNote)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(creditNotes)
+	}
+}
+
+func GetCreditNoteByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		creditNoteID := chi.URLParam(r, "creditNote_id")
+		var creditNote model.CreditNote
+
+		meta, err := creditNoteCollection.ReadDocument(context.TODO(), creditNoteID, &creditNote)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch credit note"})
+			return
+		}
+
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(creditNote)
+	}
+}
+
+// CreateCreditNote credits a paid invoice. Lines credit quantities of the
+// billed lines, amount credits a sum before tax, and without either the rest
+// of the invoice is credited.
+func CreateCreditNote() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var creditNote model.CreditNote
+		err := json.NewDecoder(r.Body).Decode(&creditNote)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(creditNote)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+		if len(creditNote.Lines) > 0 && creditNote.Amount != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "credit either lines or an amount"})
+			return
+		}
+
+		creditNote, err = issueCreditNote(creditNote, nil)
+		if err != nil {
+			creditNoteFailed(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(creditNote.CreditNoteID)
+	}
+}
+
+// ReissueInvoice credits what remains of a paid invoice and opens a corrected
+// invoice for the same order that points back to it. The order can be edited
+// again until the new invoice is paid.
+func ReissueInvoice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID := chi.URLParam(r, "invoice_id")
+		var correction model.InvoiceCorrection
+		err := json.NewDecoder(r.Body).Decode(&correction)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(correction)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		var original model.Invoice
+		_, err = invoiceCollection.ReadDocument(context.TODO(), invoiceID, &original)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": "invoice was not found"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch invoice item"})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		pending := "PENDING"
+		replacement := model.Invoice{
+			InvoiceID:      uuid.NewString(),
+			OrderID:        original.OrderID,
+			Location:       original.Location,
+			CustomerID:     original.CustomerID,
+			AccountID:      original.AccountID,
+			PaymentMethod:  original.PaymentMethod,
+			PaymentStatus:  &pending,
+			TipAmount:      original.TipAmount,
+			PaymentDueDate: now.AddDate(0, 0, 1),
+			Replaces:       &original.InvoiceID,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if correction.PaymentMethod != nil {
+			replacement.PaymentMethod = correction.PaymentMethod
+		}
+		if correction.TipAmount != nil {
+			tip := roundMoney(*correction.TipAmount)
+			replacement.TipAmount = &tip
+		}
+
+		// a corrected charge goes back on the account with the original terms
+		if chargedToAccount(replacement) {
+			replacement.PaymentDueDate = original.PaymentDueDate
+		}
+
+		pay := correction.PaymentStatus != nil && *correction.PaymentStatus == "PAID"
+		if pay && (replacement.PaymentMethod == nil || *replacement.PaymentMethod == "") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "a payment method is required to pay an invoice"})
+			return
+		}
+		if pay && *replacement.PaymentMethod == "GIFT_CARD" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "redeem gift cards on the invoice before paying it"})
+			return
+		}
+
+		creditNote, err := issueCreditNote(model.CreditNote{InvoiceID: invoiceID, Reason: correction.Reason}, &replacement)
+		if err != nil {
+			creditNoteFailed(w, err)
+			return
+		}
+
+		result := status{"credit_note_id": creditNote.CreditNoteID, "invoice_id": replacement.InvoiceID}
+		if pay || chargedToAccount(replacement) {
+			// the credit note and the replacement are committed either way, so
+			// the replacement is left pending to be paid again and the ids are
+			// sent along with the error
+			_, err = finalizeInvoice(replacement, false)
+			if err != nil {
+				log.Printf("failed to pay reissued invoice %s: %v", replacement.InvoiceID, err)
+				result["error"] = "invoice was reissued but could not be paid"
+				if errors.Is(err, errInvoiceLocked) || errors.Is(err, errGiftCardShort) || errors.Is(err, errGiftCardsExceed) {
+					w.WriteHeader(http.StatusConflict)
+				} else {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				json.NewEncoder(w).Encode(result)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func creditNoteFailed(w http.ResponseWriter, err error) {
+	switch {
+	case driver.IsNotFound(err):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(status{"error": "invoice was not found"})
+	case errors.Is(err, fiscal.ErrUnknownInvoiceLine):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+	case errors.Is(err, errInvoiceNotPaid), errors.Is(err, errInvoiceReplaced), errors.Is(err, fiscal.ErrCreditExceeded):
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(status{"error": "failed to issue credit note"})
+	}
+}
+
+// issueCreditNote numbers the credit note and adds it to the invoice's
+// credited total. Gift cards that paid the invoice get their share back and
+// loyalty points are taken back. A replacement invoice is created in the same
+// transaction and linked to the credited invoice.
+func issueCreditNote(creditNote model.CreditNote, replacement *model.Invoice) (model.CreditNote, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	creditNote.CreditNoteID = uuid.NewString()
+	creditNote.CreatedAt = now
+	creditNote.FiscalYear = now.Year()
+
+	write := []string{
+		invoiceCollection.Name(), creditNoteCollection.Name(), customerCollection.Name(), loyaltyTransactionCollection.Name(),
+		giftCardCollection.Name(), giftCardTransactionCollection.Name(),
+	}
+	err := fiscalTransaction(write, func(ctx context.Context) error {
+		var invoice model.Invoice
+		_, err := invoiceCollection.ReadDocument(ctx, creditNote.InvoiceID, &invoice)
+		if err != nil {
+			return err
+		}
+		if !invoiceIsLocked(invoice) {
+			return errInvoiceNotPaid
+		}
+		if invoice.ReplacedBy != nil {
+			return errInvoiceReplaced
+		}
+
+		previous, err := invoiceCreditNotes(ctx, invoice.InvoiceID)
+		if err != nil {
+			return err
+		}
+		err = fiscal.CreditNoteAmounts(&creditNote, invoice, previous)
+		if err != nil {
+			return err
+		}
+
+		creditNote.OrderID = invoice.OrderID
+		creditNote.Location = invoice.Location
+		err = creditNoteSeries.advance(ctx, creditNote.Location, creditNote.FiscalYear, func(sequenceNumber int, previousHash string) string {
+			creditNote.CreditNoteNumber = creditNoteSeries.number(creditNote.Location, creditNote.FiscalYear, sequenceNumber)
+			creditNote.SequenceNumber = sequenceNumber
+			creditNote.PreviousHash = previousHash
+			creditNote.Hash = fiscal.CreditNoteHash(creditNote)
+			return creditNote.Hash
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = creditNoteCollection.CreateDocument(ctx, creditNote)
+		if err != nil {
+			return err
+		}
+
+		updateObject := map[string]interface{}{
+			"credited_total": roundMoney(invoice.CreditedTotal + creditNote.Total),
+			"updated_at":     now,
+		}
+		if replacement != nil {
+			_, err = invoiceCollection.CreateDocument(ctx, replacement)
+			if err != nil {
+				return err
+			}
+			updateObject["replaced_by"] = replacement.InvoiceID
+		}
+
+		_, err = invoiceCollection.UpdateDocument(ctx, invoice.InvoiceID, updateObject)
+		if err != nil {
+			return err
+		}
+		err = refundCreditedGiftCards(ctx, invoice, creditNote)
+		if err != nil {
+			return err
+		}
+		return reverseLoyalty(ctx, invoice, creditNote)
+	})
+	return creditNote, err
+}
+
+func invoiceCreditNotes(ctx context.Context, invoiceID string) ([]model.CreditNote, error) {
+	query := "FOR note IN creditNotes FILTER note.invoice_id == @invoice_id RETURN note"
+	cursor, err := db.Query(ctx, query, map[string]interface{}{"invoice_id": invoiceID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	creditNotes := []model.CreditNote{}
+	for {
+		var creditNote model.CreditNote
+		_, err := cursor.ReadDocument(ctx, &creditNote)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		creditNotes = append(creditNotes, creditNote)
+	}
+	return creditNotes, nil
+}
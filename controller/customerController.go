@@ -0,0 +1,652 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/database"
+	"main/export"
+	"main/model"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var customerCollection = database.OpenCollection(db, "customers")
+
+var errCustomerNotFound = errors.New("customer was not found")
+
+func init() {
+	database.EnsurePersistentIndex(customerCollection, "phone")
+	database.EnsurePersistentIndex(customerCollection, "email")
+	database.EnsurePersistentIndex(orderCollection, "customer_id")
+}
+
+// GetCustomers lists customers, optionally those whose name contains q or
+// whose phone or email is q.
+func GetCustomers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := `
+		FOR customer IN customers
+			FILTER @q == null OR CONTAINS(LOWER(customer.name), @q) OR customer.email == @q OR customer.phone == @phone
+			SORT customer.name
+			LIMIT @limit
+			RETURN customer`
+		bindVars := map[string]interface{}{"q": nil, "phone": nil, "limit": listLimit(format)}
+		if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+			bindVars["q"] = strings.ToLower(q)
+			bindVars["phone"] = normalizePhone(q)
+		}
+
+		cursor, err := db.Query(exportContext(format), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.Customer](w, format, "customers", cursor)
+			return
+		}
+
+		customers := []model.Customer{}
+		for {
+			var customer model.Customer
+			_, err := cursor.ReadDocument(context.TODO(), &customer)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read customers"})
+				return
+			}
+
+			customers = append(customers, customer)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(customers)
+	}
+}
+
+func GetCustomerByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID := chi.URLParam(r, "customer_id")
+		var customer model.Customer
+
+		meta, err := customerCollection.ReadDocument(context.TODO(), customerID, &customer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch customer"})
+			return
+		}
+
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(customer)
+	}
+}
+
+func CreateCustomer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var customer model.Customer
+		err := json.NewDecoder(r.Body).Decode(&customer)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		customer.Phone = normalizedPhone(customer.Phone)
+		customer.Email = normalizedEmail(customer.Email)
+
+		err = validate.Struct(customer)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		if duplicateCustomer(w, customer.Phone, customer.Email, "") {
+			return
+		}
+
+		customer.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		customer.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		customer.CustomerID = uuid.NewString()
+		customer.ConsentedAt = nil
+		customer.LoyaltyPoints, customer.LifetimePoints, customer.LoyaltyTier = 0, 0, ""
+		if customer.MarketingConsent != nil && *customer.MarketingConsent {
+			customer.ConsentedAt = &customer.CreatedAt
+		}
+
+		meta, err := customerCollection.CreateDocument(context.TODO(), customer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to create customer"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func UpdateCustomerByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID := chi.URLParam(r, "customer_id")
+		var customer model.Customer
+		err := json.NewDecoder(r.Body).Decode(&customer)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		customer.Phone = normalizedPhone(customer.Phone)
+		customer.Email = normalizedEmail(customer.Email)
+
+		err = validate.StructPartial(customer, "Phone", "Email", "Allergies", "Preferences", "Notes")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		if duplicateCustomer(w, customer.Phone, customer.Email, customerID) {
+			return
+		}
+
+		customer.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObject := make(map[string]interface{})
+
+		if customer.Name != nil {
+			if validate.Var(*customer.Name, "min=2,max=100") != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "name must be between 2 and 100 characters"})
+				return
+			}
+			updateObject["name"] = customer.Name
+		}
+		if customer.Phone != nil {
+			updateObject["phone"] = customer.Phone
+		}
+		if customer.Email != nil {
+			updateObject["email"] = customer.Email
+		}
+		if customer.Allergies != nil {
+			updateObject["allergies"] = customer.Allergies
+		}
+		if customer.Preferences != nil {
+			updateObject["preferences"] = customer.Preferences
+		}
+		if customer.Notes != nil {
+			updateObject["notes"] = customer.Notes
+		}
+		if customer.MarketingConsent != nil {
+			updateObject["marketing_consent"] = customer.MarketingConsent
+			if *customer.MarketingConsent {
+				updateObject["consented_at"] = customer.UpdatedAt
+			} else {
+				updateObject["consented_at"] = nil
+			}
+		}
+
+		updateObject["updated_at"] = customer.UpdatedAt
+
+		meta, err := customerCollection.UpdateDocument(revisionContext(r), customerID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update customer"})
+			return
+		}
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+// DeleteCustomerByID removes the customer and unlinks their orders and
+// invoices, which stay for reporting, and their gift cards, which can still
+// be spent.
+func DeleteCustomerByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID := chi.URLParam(r, "customer_id")
+
+		meta, err := customerCollection.RemoveDocument(revisionContext(r), customerID)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to delete customer"})
+			return
+		}
+
+		err = relinkCustomer(context.TODO(), []string{customerID}, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "customer was deleted but their orders could not be unlinked"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+// GetCustomerOrders returns the visits of a customer, newest first, with what
+// they ordered and how it was paid.
+func GetCustomerOrders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		customerID := chi.URLParam(r, "customer_id")
+
+		history := model.CustomerHistory{Orders: []model.CustomerOrder{}}
+		_, err := customerCollection.ReadDocument(context.TODO(), customerID, &history.Customer)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": errCustomerNotFound.Error()})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch customer"})
+			return
+		}
+
+		query := `
+		FOR order IN orders
+			FILTER order.customer_id == @customer_id
+			SORT order.order_date DESC
+			LIMIT @limit
+			LET items = (
+				FOR orderItem IN orderItems
+					FILTER orderItem.order_id == order._key
+					RETURN {
+						food_id: orderItem.food_id,
+						name: NOT_NULL(orderItem.food_name, DOCUMENT(foods, orderItem.food_id).name),
+						quantity: orderItem.quantity,
+						total_price: orderItem.total_price
+					}
+			)
+			LET invoice = FIRST(
+				FOR invoice IN invoices
+					FILTER invoice.order_id == order._key AND invoice.replaced_by == null
+					RETURN invoice
+			)
+			RETURN {
+				order_id: order._key,
+				order_date: order.order_date,
+				table_id: order.table_id,
+				server: order.server,
+				number_of_guest: order.number_of_guest,
+				items: items,
+				total: invoice.invoice_number != null ? invoice.total : SUM(items[*].total_price),
+				invoice_id: invoice._key,
+				invoice_number: invoice.invoice_number,
+				payment_status: invoice.payment_status
+			}`
+		bindVars := map[string]interface{}{"customer_id": customerID, "limit": listLimit(format)}
+		cursor, err := db.Query(context.TODO(), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		for {
+			var order model.CustomerOrder
+			_, err := cursor.ReadDocument(context.TODO(), &order)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read orders"})
+				return
+			}
+
+			order.Total = roundMoney(order.Total)
+			history.TotalSpent += order.Total
+			history.Orders = append(history.Orders, order)
+		}
+
+		if format != "" {
+			exportSlice(w, format, "customer-orders", history.Orders)
+			return
+		}
+
+		history.Visits = len(history.Orders)
+		history.TotalSpent = roundMoney(history.TotalSpent)
+		if len(history.Orders) > 0 {
+			history.LastVisitAt = &history.Orders[0].OrderDate
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(history)
+	}
+}
+
+// GetDuplicateCustomers groups customers that share a phone number or email
+// address so that they can be merged.
+func GetDuplicateCustomers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := `
+		LET byPhone = (
+			FOR customer IN customers
+				FILTER customer.phone != null
+				COLLECT value = customer.phone INTO matches = customer
+				FILTER LENGTH(matches) > 1
+				RETURN { matched_on: "phone", value: value, customers: matches }
+		)
+		LET byEmail = (
+			FOR customer IN customers
+				FILTER customer.email != null
+				COLLECT value = customer.email INTO matches = customer
+				FILTER LENGTH(matches) > 1
+				RETURN { matched_on: "email", value: value, customers: matches }
+		)
+		FOR duplicates IN APPEND(byPhone, byEmail)
+			RETURN duplicates`
+		cursor, err := db.Query(context.TODO(), query, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		duplicates := []model.CustomerDuplicates{}
+		for {
+			var group model.CustomerDuplicates
+			_, err := cursor.ReadDocument(context.TODO(), &group)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read duplicates"})
+				return
+			}
+
+			duplicates = append(duplicates, group)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(duplicates)
+	}
+}
+
+// MergeCustomers folds duplicate records into the customer in the url. Missing
+// details and allergies are taken over, orders, invoices and gift cards are
+// moved, and the duplicates are removed, all in one transaction.
+func MergeCustomers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID := chi.URLParam(r, "customer_id")
+		var merge model.CustomerMerge
+		err := json.NewDecoder(r.Body).Decode(&merge)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(merge)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+		for _, duplicateID := range merge.DuplicateIDs {
+			if duplicateID == customerID {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "a customer cannot be merged into itself"})
+				return
+			}
+		}
+
+		transactionID, err := db.BeginTransaction(context.TODO(), driver.TransactionCollections{
+			Write: []string{customerCollection.Name(), orderCollection.Name(), invoiceCollection.Name(), loyaltyTransactionCollection.Name(), giftCardCollection.Name()},
+		}, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to begin transaction"})
+			return
+		}
+		ctx := driver.WithTransactionID(context.TODO(), transactionID)
+
+		var customer model.Customer
+		err = func() error {
+			settings, err := readLoyaltySettings()
+			if err != nil {
+				return err
+			}
+			_, err = customerCollection.ReadDocument(ctx, customerID, &customer)
+			if err != nil {
+				return err
+			}
+			for _, duplicateID := range merge.DuplicateIDs {
+				var duplicate model.Customer
+				_, err := customerCollection.ReadDocument(ctx, duplicateID, &duplicate)
+				if err != nil {
+					return err
+				}
+				mergeCustomer(&customer, duplicate)
+			}
+			customer.LoyaltyTier = ""
+			if tier := loyaltyTier(settings, customer.LifetimePoints); tier != nil {
+				customer.LoyaltyTier = tier.Name
+			}
+
+			err = relinkCustomer(ctx, merge.DuplicateIDs, &customerID)
+			if err != nil {
+				return err
+			}
+			_, errs, err := customerCollection.RemoveDocuments(ctx, merge.DuplicateIDs)
+			if err == nil {
+				err = errs.FirstNonNil()
+			}
+			if err != nil {
+				return err
+			}
+
+			customer.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			_, err = customerCollection.ReplaceDocument(ctx, customerID, customer)
+			return err
+		}()
+		if err != nil {
+			db.AbortTransaction(context.TODO(), transactionID, nil)
+			if driver.IsNotFound(err) {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(status{"error": errCustomerNotFound.Error()})
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to merge customers"})
+			return
+		}
+
+		err = db.CommitTransaction(context.TODO(), transactionID, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to merge customers"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(customer)
+	}
+}
+
+// mergeCustomer keeps what the customer already has and fills the gaps from
+// the duplicate. Consent is only taken over when the customer never answered.
+func mergeCustomer(customer *model.Customer, duplicate model.Customer) {
+	if customer.Phone == nil {
+		customer.Phone = duplicate.Phone
+	}
+	if customer.Email == nil {
+		customer.Email = duplicate.Email
+	}
+	if customer.Notes == nil {
+		customer.Notes = duplicate.Notes
+	} else if duplicate.Notes != nil && *duplicate.Notes != *customer.Notes {
+		notes := *customer.Notes + "\n" + *duplicate.Notes
+		customer.Notes = &notes
+	}
+	if customer.MarketingConsent == nil {
+		customer.MarketingConsent = duplicate.MarketingConsent
+		customer.ConsentedAt = duplicate.ConsentedAt
+	}
+	customer.LoyaltyPoints += duplicate.LoyaltyPoints
+	customer.LifetimePoints += duplicate.LifetimePoints
+	customer.Allergies = mergeLabels(customer.Allergies, duplicate.Allergies)
+	customer.Preferences = mergeLabels(customer.Preferences, duplicate.Preferences)
+	if duplicate.CreatedAt.Before(customer.CreatedAt) {
+		customer.CreatedAt = duplicate.CreatedAt
+	}
+}
+
+func mergeLabels(labels, more []string) []string {
+	seen := make(map[string]bool)
+	for _, label := range labels {
+		seen[strings.ToLower(label)] = true
+	}
+	for _, label := range more {
+		if !seen[strings.ToLower(label)] {
+			seen[strings.ToLower(label)] = true
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// relinkCustomer moves the orders, invoices, loyalty ledger and gift cards of
+// the given customers to another customer, or unlinks them when customerID is
+// nil.
+func relinkCustomer(ctx context.Context, fromIDs []string, customerID *string) error {
+	for _, collection := range []string{"orders", "invoices", "loyaltyTransactions", "giftCards"} {
+		query := `
+		FOR document IN @@collection
+			FILTER document.customer_id IN @from
+			UPDATE document WITH { customer_id: @customer_id } IN @@collection`
+		bindVars := map[string]interface{}{"@collection": collection, "from": fromIDs, "customer_id": customerID}
+		cursor, err := db.Query(ctx, query, bindVars)
+		if err != nil {
+			return err
+		}
+		cursor.Close()
+	}
+	return nil
+}
+
+// duplicateCustomer writes 409 Conflict with the existing customer when
+// another customer already has the phone number or email address.
+func duplicateCustomer(w http.ResponseWriter, phone, email *string, customerID string) bool {
+	if phone == nil && email == nil {
+		return false
+	}
+
+	query := `
+	FOR customer IN customers
+		FILTER customer._key != @customer_id
+		FILTER (@phone != null AND customer.phone == @phone) OR (@email != null AND customer.email == @email)
+		LIMIT 1
+		RETURN customer._key`
+	bindVars := map[string]interface{}{"customer_id": customerID, "phone": phone, "email": email}
+	cursor, err := db.Query(context.TODO(), query, bindVars)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(status{"error": "failed to check for duplicate customers"})
+		return true
+	}
+	defer cursor.Close()
+
+	var existingID string
+	_, err = cursor.ReadDocument(context.TODO(), &existingID)
+	if driver.IsNoMoreDocuments(err) {
+		return false
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(status{"error": "failed to check for duplicate customers"})
+		return true
+	}
+
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(status{"error": "a customer with this phone or email already exists", "customer_id": existingID})
+	return true
+}
+
+// customerFailed writes the response for an error of checkCustomer.
+func customerFailed(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, errCustomerNotFound) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+		return true
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(status{"error": "failed to fetch customer"})
+	return true
+}
+
+// checkCustomer reports errCustomerNotFound when an order or invoice is
+// linked to a customer that does not exist.
+func checkCustomer(customerID *string) error {
+	if customerID == nil {
+		return nil
+	}
+	exists, err := customerCollection.DocumentExists(context.TODO(), *customerID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errCustomerNotFound
+	}
+	return nil
+}
+
+func normalizedPhone(phone *string) *string {
+	if phone == nil {
+		return nil
+	}
+	normalized := normalizePhone(*phone)
+	return &normalized
+}
+
+// normalizePhone keeps the digits and a leading plus, so that "+44 20 7946-0000"
+// and "+442079460000" match.
+func normalizePhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	var normalized strings.Builder
+	for i, r := range phone {
+		if unicode.IsDigit(r) || (r == '+' && i == 0) {
+			normalized.WriteRune(r)
+		}
+	}
+	return normalized.String()
+}
+
+func normalizedEmail(email *string) *string {
+	if email == nil {
+		return nil
+	}
+	normalized := strings.ToLower(strings.TrimSpace(*email))
+	return &normalized
+}
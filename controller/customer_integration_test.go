@@ -0,0 +1,50 @@
+//go:build integration
+
+package controller_test
+
+import (
+	"fmt"
+	"main/model"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCustomerContactsAreNormalized(t *testing.T) {
+	// a number no earlier run has stored
+	digits := fmt.Sprintf("%09d", time.Now().UnixNano()%1_000_000_000)
+	spaced := fmt.Sprintf("+44 (%s) %s-%s", digits[:3], digits[3:6], digits[6:])
+	email := "Guest." + digits + "@Example.COM "
+
+	customerID := create(t, "/customers", map[string]interface{}{
+		"name":  "Test guest",
+		"phone": spaced,
+		"email": email,
+	})
+
+	var customer model.Customer
+	read(t, "customers", customerID, &customer)
+	if want := "+44" + digits; customer.Phone == nil || *customer.Phone != want {
+		t.Errorf("stored phone = %v, want %s", customer.Phone, want)
+	}
+	if want := "guest." + digits + "@example.com"; customer.Email == nil || *customer.Email != want {
+		t.Errorf("stored email = %v, want %s", customer.Email, want)
+	}
+
+	searches := []string{
+		"+44" + digits,
+		" +44 " + digits[:3] + " " + digits[3:] + " ",
+		spaced,
+		"GUEST." + digits + "@example.com",
+	}
+	for _, q := range searches {
+		var customers []model.Customer
+		if code := call(t, http.MethodGet, "/customers?q="+url.QueryEscape(q), nil, &customers); code != http.StatusOK {
+			t.Fatalf("search for %q answered %d", q, code)
+		}
+		if len(customers) != 1 || customers[0].CustomerID != customerID {
+			t.Errorf("search for %q found %d customers, want only %s", q, len(customers), customerID)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"main/database"
+	"main/export"
+	"main/model"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/google/uuid"
+)
+
+var invoiceReminderCollection = database.OpenCollection(db, "invoiceReminders")
+
+const (
+	dunningInterval  = time.Hour
+	reminderInterval = 7 * 24 * time.Hour
+	maxReminders     = 3
+)
+
+var invoiceReminderEvents = newEventHub[model.InvoiceReminder]()
+
+// GetOverdueInvoices lists unpaid invoices past their due date, oldest first.
+func GetOverdueInvoices() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := `
+		FOR invoice IN invoices
+			FILTER invoice.payment_status != "PAID"
+			FILTER DATE_TIMESTAMP(invoice.payment_due_date) < @now
+			FILTER @account_id == null OR invoice.account_id == @account_id
+			SORT invoice.payment_due_date
+			LIMIT @limit
+			RETURN invoice`
+		bindVars := map[string]interface{}{"now": time.Now().UnixMilli(), "account_id": nil, "limit": listLimit(format)}
+		if accountID := r.URL.Query().Get("account_id"); accountID != "" {
+			bindVars["account_id"] = accountID
+		}
+
+		cursor, err := db.Query(exportContext(format), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		overdue := []model.OverdueInvoice{}
+		for {
+			var invoice model.Invoice
+			_, err := cursor.ReadDocument(context.TODO(), &invoice)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read invoices"})
+				return
+			}
+
+			amount, err := invoiceAmountDue(invoice)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to calculate amount due"})
+				return
+			}
+			overdue = append(overdue, overdueInvoice(invoice, amount))
+		}
+
+		if format != "" {
+			exportSlice(w, format, "overdue-invoices", overdue)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(overdue)
+	}
+}
+
+func GetInvoiceReminders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := `
+		FOR reminder IN invoiceReminders
+			FILTER @invoice_id == null OR reminder.invoice_id == @invoice_id
+			FILTER @account_id == null OR reminder.account_id == @account_id
+			SORT reminder.created_at DESC
+			LIMIT @limit
+			RETURN reminder`
+		bindVars := map[string]interface{}{"invoice_id": nil, "account_id": nil, "limit": listLimit(format)}
+		if invoiceID := r.URL.Query().Get("invoice_id"); invoiceID != "" {
+			bindVars["invoice_id"] = invoiceID
+		}
+		if accountID := r.URL.Query().Get("account_id"); accountID != "" {
+			bindVars["account_id"] = accountID
+		}
+
+		cursor, err := db.Query(exportContext(format), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.InvoiceReminder](w, format, "invoice-reminders", cursor)
+			return
+		}
+
+		reminders := []model.InvoiceReminder{}
+		for {
+			var reminder model.InvoiceReminder
+			_, err := cursor.ReadDocument(context.TODO(), &reminder)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read reminders"})
+				return
+			}
+
+			reminders = append(reminders, reminder)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(reminders)
+	}
+}
+
+// GetInvoiceReminderEvents streams payment reminders as server-sent events
+// for whatever sends them on by mail or text.
+func GetInvoiceReminderEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		streamEvents(w, r, invoiceReminderEvents, "reminder")
+	}
+}
+
+// StartDunning marks unpaid account invoices OVERDUE once their due date
+// passes and sends up to maxReminders reminders for each, a reminderInterval
+// apart.
+func StartDunning() {
+	go func() {
+		ticker := time.NewTicker(dunningInterval)
+		defer ticker.Stop()
+		for {
+			runDunning()
+			<-ticker.C
+		}
+	}()
+}
+
+func runDunning() {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	query := `
+	FOR invoice IN invoices
+		FILTER invoice.payment_status == "PENDING" AND invoice.account_id != null
+		FILTER DATE_TIMESTAMP(invoice.payment_due_date) < @now
+		UPDATE invoice WITH { payment_status: "OVERDUE", updated_at: @updated_at } IN invoices`
+	cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"now": now.UnixMilli(), "updated_at": now})
+	if err != nil {
+		log.Println("failed to mark overdue invoices:", err)
+		return
+	}
+	cursor.Close()
+
+	// only house accounts have someone to remind; the reminders are claimed
+	// in the same statement so that a second instance does not send them again
+	query = `
+	FOR invoice IN invoices
+		FILTER invoice.payment_status == "OVERDUE" AND invoice.account_id != null
+		FILTER NOT_NULL(invoice.reminders_sent, 0) < @max_reminders
+		FILTER invoice.last_reminder_at == null OR DATE_TIMESTAMP(invoice.last_reminder_at) <= @remind_before
+		UPDATE invoice WITH { reminders_sent: NOT_NULL(invoice.reminders_sent, 0) + 1, last_reminder_at: @updated_at } IN invoices
+		RETURN NEW`
+	bindVars := map[string]interface{}{
+		"max_reminders": maxReminders,
+		"remind_before": now.Add(-reminderInterval).UnixMilli(),
+		"updated_at":    now,
+	}
+	cursor, err = db.Query(context.TODO(), query, bindVars)
+	if err != nil {
+		log.Println("failed to claim invoice reminders:", err)
+		return
+	}
+	defer cursor.Close()
+
+	for {
+		var invoice model.Invoice
+		_, err := cursor.ReadDocument(context.TODO(), &invoice)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			log.Println("failed to read invoice:", err)
+			return
+		}
+
+		amount, err := invoiceAmountDue(invoice)
+		if err != nil {
+			log.Printf("failed to calculate amount due of invoice %s: %v", invoice.InvoiceID, err)
+		}
+		overdue := overdueInvoice(invoice, amount)
+
+		reminder := model.InvoiceReminder{
+			ReminderID:  uuid.NewString(),
+			InvoiceID:   invoice.InvoiceID,
+			AccountID:   invoice.AccountID,
+			Level:       invoice.RemindersSent,
+			DueDate:     invoice.PaymentDueDate,
+			DaysOverdue: overdue.DaysOverdue,
+			AmountDue:   amount,
+			CreatedAt:   now,
+		}
+		_, err = invoiceReminderCollection.CreateDocument(context.TODO(), reminder)
+		if err != nil {
+			log.Println("failed to store invoice reminder:", err)
+		}
+		invoiceReminderEvents.publish(reminder)
+	}
+}
+
+func overdueInvoice(invoice model.Invoice, amount float64) model.OverdueInvoice {
+	overdue := model.OverdueInvoice{
+		InvoiceID:     invoice.InvoiceID,
+		InvoiceNumber: invoice.InvoiceNumber,
+		AccountID:     invoice.AccountID,
+		OrderID:       invoice.OrderID,
+		DueDate:       invoice.PaymentDueDate,
+		DaysOverdue:   int(time.Since(invoice.PaymentDueDate).Hours() / 24),
+		AmountDue:     amount,
+		RemindersSent: invoice.RemindersSent,
+	}
+	if invoice.PaymentStatus != nil {
+		overdue.PaymentStatus = *invoice.PaymentStatus
+	}
+	return overdue
+}
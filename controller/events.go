@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// eventHub fans events out to every listener of an event stream.
+type eventHub[T any] struct {
+	mu        sync.Mutex
+	listeners map[chan T]struct{}
+}
+
+func newEventHub[T any]() *eventHub[T] {
+	return &eventHub[T]{listeners: make(map[chan T]struct{})}
+}
+
+func (h *eventHub[T]) subscribe() chan T {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := make(chan T, 16)
+	h.listeners[events] = struct{}{}
+	return events
+}
+
+func (h *eventHub[T]) unsubscribe(events chan T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.listeners, events)
+}
+
+// publish never blocks; a listener that cannot keep up misses events.
+func (h *eventHub[T]) publish(event T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for events := range h.listeners {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// streamEvents sends the events of a hub as server-sent events named name
+// until the client goes away.
+func streamEvents[T any](w http.ResponseWriter, r *http.Request, hub *eventHub[T], name string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(status{"error": "streaming is not supported"})
+		return
+	}
+
+	events := hub.subscribe()
+	defer hub.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+			flusher.Flush()
+		}
+	}
+}
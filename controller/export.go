@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"main/export"
+	"net/http"
+	"reflect"
+
+	"github.com/arangodb/go-driver"
+)
+
+// listLimit keeps JSON listings short while exports return every document.
+func listLimit(format string) int {
+	if format != "" {
+		return 1 << 30
+	}
+	return 10
+}
+
+// exportContext asks ArangoDB for a streaming cursor so that exports do not
+// materialise the whole result on the server.
+func exportContext(format string) context.Context {
+	if format == "" {
+		return context.TODO()
+	}
+	return driver.WithQueryStream(driver.WithQueryBatchSize(context.TODO(), 1000), true)
+}
+
+// exportCursor streams every document of the cursor in the given format.
+func exportCursor[T any](w http.ResponseWriter, format, name string, cursor driver.Cursor) {
+	exportRows(w, format, name, func(row *T) (bool, error) {
+		_, err := cursor.ReadDocument(context.TODO(), row)
+		if driver.IsNoMoreDocuments(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+}
+
+func exportSlice[T any](w http.ResponseWriter, format, name string, rows []T) {
+	i := 0
+	exportRows(w, format, name, func(row *T) (bool, error) {
+		if i == len(rows) {
+			return false, nil
+		}
+		*row = rows[i]
+		i++
+		return true, nil
+	})
+}
+
+func exportRows[T any](w http.ResponseWriter, format, name string, next func(*T) (bool, error)) {
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	w.WriteHeader(http.StatusOK)
+
+	writer, err := export.NewWriter(w, format, reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		log.Println("failed to start export:", err)
+		return
+	}
+	defer writer.Close()
+
+	// the status line is already sent, so failures can only end the stream
+	for {
+		var row T
+		ok, err := next(&row)
+		if err != nil {
+			log.Println("failed to read export row:", err)
+			return
+		} else if !ok {
+			return
+		}
+
+		if err := writer.Write(row); err != nil {
+			log.Println("failed to write export row:", err)
+			return
+		}
+	}
+}
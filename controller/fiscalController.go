@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/database"
+	"main/fiscal"
+	"main/model"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arangodb/go-driver"
+)
+
+var invoiceSequenceCollection = database.OpenCollection(db, "invoiceSequences")
+
+const defaultLocation = "MAIN"
+
+var errInvoiceLocked = errors.New("issued invoices cannot be changed, issue a credit note instead")
+
+func init() {
+	database.EnsureUniqueIndex(invoiceCollection, "invoice_number")
+}
+
+// VerifyInvoiceChain recomputes the hash chain of a location's invoices, or
+// credit notes with series=credit_note, for a year and reports the first
+// document that does not match.
+func VerifyInvoiceChain() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		location := r.URL.Query().Get("location")
+		if location == "" {
+			location = defaultLocation
+		}
+		year := time.Now().Year()
+		if value := r.URL.Query().Get("year"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "year must be a number"})
+				return
+			}
+			year = parsed
+		}
+
+		var result status
+		var err error
+		switch r.URL.Query().Get("series") {
+		case "", "invoice":
+			result, err = verifyChain(invoiceSeries, location, year, func(invoice model.Invoice) fiscal.Link {
+				return fiscal.Link{Number: *invoice.InvoiceNumber, SequenceNumber: invoice.SequenceNumber, PreviousHash: invoice.PreviousHash, Hash: invoice.Hash, Recomputed: fiscal.InvoiceHash(invoice)}
+			})
+		case "credit_note":
+			result, err = verifyChain(creditNoteSeries, location, year, func(note model.CreditNote) fiscal.Link {
+				return fiscal.Link{Number: note.CreditNoteNumber, SequenceNumber: note.SequenceNumber, PreviousHash: note.PreviousHash, Hash: note.Hash, Recomputed: fiscal.CreditNoteHash(note)}
+			})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "series must be invoice or credit_note"})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to verify chain"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// fiscalSeries is a gapless numbering of fiscal documents kept per location
+// and year.
+type fiscalSeries struct {
+	name       string
+	prefix     string
+	collection string
+	numberAttr string
+}
+
+var (
+	invoiceSeries    = fiscalSeries{"INVOICE", "", "invoices", "invoice_number"}
+	creditNoteSeries = fiscalSeries{"CREDIT_NOTE", "CN-", "creditNotes", "credit_note_number"}
+)
+
+func (series fiscalSeries) key(location string, year int) string {
+	return fmt.Sprintf("%s%s-%d", series.prefix, location, year)
+}
+
+func (series fiscalSeries) number(location string, year, sequenceNumber int) string {
+	return fmt.Sprintf("%s-%06d", series.key(location, year), sequenceNumber)
+}
+
+// advance takes the next number of the series. It must run in a transaction
+// that holds the sequences collection exclusively. link receives the number
+// and the hash of the previous document and returns the hash of the new one.
+func (series fiscalSeries) advance(ctx context.Context, location string, year int, link func(sequenceNumber int, previousHash string) string) error {
+	key := series.key(location, year)
+	sequence := model.InvoiceSequence{SequenceID: key, Series: series.name, Location: location, Year: year}
+	_, err := invoiceSequenceCollection.ReadDocument(ctx, key, &sequence)
+	exists := err == nil
+	if err != nil && !driver.IsNotFound(err) {
+		return err
+	}
+
+	sequence.LastNumber++
+	sequence.LastHash = link(sequence.LastNumber, sequence.LastHash)
+	if exists {
+		_, err = invoiceSequenceCollection.ReplaceDocument(ctx, key, sequence)
+	} else {
+		_, err = invoiceSequenceCollection.CreateDocument(ctx, sequence)
+	}
+	return err
+}
+
+// verifyChain walks the documents of a series in order. link describes a
+// document to the chain.
+func verifyChain[T any](series fiscalSeries, location string, year int, link func(T) fiscal.Link) (status, error) {
+	query := fmt.Sprintf(`
+	FOR document IN %s
+		FILTER document.location == @location AND document.fiscal_year == @year
+		FILTER document.%s != null
+		SORT document.sequence_number
+		RETURN document`, series.collection, series.numberAttr)
+	cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"location": location, "year": year})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	result := status{"series": series.name, "location": location, "year": year, "valid": true}
+	chain := fiscal.Chain{}
+	count := 0
+	for {
+		var document T
+		_, err := cursor.ReadDocument(context.TODO(), &document)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		count++
+		next := link(document)
+		if reason := chain.Next(next); reason != "" {
+			result["valid"] = false
+			result["number"] = next.Number
+			result["error"] = reason
+			break
+		}
+	}
+
+	if result["valid"] == true {
+		var sequence model.InvoiceSequence
+		_, err = invoiceSequenceCollection.ReadDocument(context.TODO(), series.key(location, year), &sequence)
+		if err != nil && !driver.IsNotFound(err) {
+			return nil, err
+		}
+		if reason := chain.End(sequence.LastNumber, sequence.LastHash); reason != "" {
+			result["valid"] = false
+			result["error"] = reason
+		}
+	}
+	result["documents"] = count
+
+	return result, nil
+}
+
+// fiscalTransaction runs fn in a stream transaction that holds the sequences
+// collection exclusively, so numbers are taken one at a time.
+func fiscalTransaction(write []string, fn func(ctx context.Context) error) error {
+	return runTransaction(driver.TransactionCollections{
+		Exclusive: []string{invoiceSequenceCollection.Name()},
+		Write:     write,
+	}, fn)
+}
+
+// finalizeInvoice issues an invoice when it is paid or charged to an
+// account. It freezes the billed lines and totals, takes the next number of
+// the location's yearly sequence, links the invoice into the hash chain and
+// awards its loyalty points, all in one transaction so that numbers are never
+// skipped. With create set the invoice is stored for the first time in that
+// transaction, so a failed payment leaves no invoice behind. A charge stays
+// PENDING until the account settles it.
+func finalizeInvoice(invoice model.Invoice, create bool) (model.Invoice, error) {
+	data, err := invoiceReceipt(invoice)
+	if err != nil {
+		return invoice, err
+	}
+
+	paidAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	paymentStatus := "PAID"
+	if chargedToAccount(invoice) {
+		paymentStatus = "PENDING"
+	} else {
+		invoice.SettledAt = &paidAt
+	}
+	invoice.PaymentStatus = &paymentStatus
+	invoice.PaidAt = &paidAt
+	invoice.UpdatedAt = paidAt
+	invoice.FiscalYear = paidAt.Year()
+	if invoice.Location == "" {
+		invoice.Location = defaultLocation
+	}
+
+	invoice.Lines = []model.InvoiceLine{}
+	for _, item := range data.Items {
+		invoice.Lines = append(invoice.Lines, model.InvoiceLine{
+			FoodID:     item.FoodID,
+			Name:       item.Name,
+			Quantity:   item.Quantity,
+			UnitPrice:  item.UnitPrice,
+			TotalPrice: item.Total,
+			Modifiers:  item.Modifiers,
+			Notes:      item.Notes,
+		})
+	}
+	invoice.Taxes = []model.InvoiceTax{}
+	for _, tax := range data.Taxes {
+		invoice.Taxes = append(invoice.Taxes, model.InvoiceTax{Label: tax.Label, Amount: tax.Amount})
+	}
+	invoice.Subtotal = data.Subtotal
+	invoice.Total = data.Total
+
+	// promotions become discount lines of their own on the paid invoice
+	promotions, err := orderPromotionDiscounts(invoice.OrderID)
+	if err != nil {
+		return invoice, err
+	}
+	invoice.Discounts = append(promotions, invoice.Discounts...)
+
+	settings, err := readLoyaltySettings()
+	if err != nil {
+		return invoice, err
+	}
+
+	write := []string{invoiceCollection.Name(), customerCollection.Name(), loyaltyTransactionCollection.Name()}
+	err = fiscalTransaction(write, func(ctx context.Context) error {
+		if !create {
+			// another request may have paid the invoice since it was read
+			var stored model.Invoice
+			_, err := invoiceCollection.ReadDocument(ctx, invoice.InvoiceID, &stored)
+			if err != nil {
+				return err
+			}
+			if invoiceIsLocked(stored) {
+				return errInvoiceLocked
+			}
+
+			// gift cards may have been redeemed since it was read as well
+			invoice.GiftCards = stored.GiftCards
+		}
+		paid := giftCardTotal(invoice)
+		if paid > invoice.Total {
+			return errGiftCardsExceed
+		}
+		if invoice.PaymentMethod != nil && *invoice.PaymentMethod == "GIFT_CARD" && paid < invoice.Total {
+			return errGiftCardShort
+		}
+
+		err := invoiceSeries.advance(ctx, invoice.Location, invoice.FiscalYear, func(sequenceNumber int, previousHash string) string {
+			invoiceNumber := invoiceSeries.number(invoice.Location, invoice.FiscalYear, sequenceNumber)
+			invoice.InvoiceNumber = &invoiceNumber
+			invoice.SequenceNumber = sequenceNumber
+			invoice.PreviousHash = previousHash
+			invoice.Hash = fiscal.InvoiceHash(invoice)
+			return invoice.Hash
+		})
+		if err != nil {
+			return err
+		}
+
+		if create {
+			_, err = invoiceCollection.CreateDocument(ctx, invoice)
+		} else {
+			_, err = invoiceCollection.ReplaceDocument(ctx, invoice.InvoiceID, invoice)
+		}
+		if err != nil {
+			return err
+		}
+		return earnPoints(ctx, settings, invoice)
+	})
+	return invoice, err
+}
+
+// invoiceIsLocked reports whether the invoice was issued, after which only a
+// credit note changes it.
+func invoiceIsLocked(invoice model.Invoice) bool {
+	return invoice.InvoiceNumber != nil
+}
+
+// orderIsLocked reports whether the order has an issued invoice that was not
+// replaced, after which its items may no longer change.
+func orderIsLocked(orderID string) (bool, error) {
+	query := `
+	FOR invoice IN invoices
+		FILTER invoice.order_id == @order_id AND invoice.invoice_number != null
+		FILTER invoice.replaced_by == null
+		LIMIT 1
+		RETURN invoice._key`
+	cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"order_id": orderID})
+	if err != nil {
+		return false, err
+	}
+	defer cursor.Close()
+	return cursor.HasMore(), nil
+}
+
+// orderItemLocked writes 409 Conflict when the items of the order can no
+// longer change.
+func orderItemLocked(w http.ResponseWriter, orderID string) bool {
+	locked, err := orderIsLocked(orderID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(status{"error": "failed to check invoice of order"})
+		return true
+	}
+	if locked {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status{"error": "the order has an issued invoice and cannot be changed"})
+		return true
+	}
+	return false
+}
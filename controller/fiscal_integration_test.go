@@ -0,0 +1,71 @@
+//go:build integration
+
+package controller_test
+
+import (
+	"main/model"
+	"net/http"
+	"testing"
+)
+
+func TestPaidInvoiceIsLocked(t *testing.T) {
+	tableID, foodID := createFood(t, 10)
+	orderID, orderItemID := orderFood(t, tableID, foodID)
+
+	invoiceID := create(t, "/invoices", map[string]interface{}{
+		"order_id":       orderID,
+		"payment_method": "CASH",
+		"payment_status": "PAID",
+	})
+
+	var invoice model.Invoice
+	read(t, "invoices", invoiceID, &invoice)
+	if invoice.InvoiceNumber == nil || invoice.Hash == "" {
+		t.Fatalf("paid invoice was not numbered: %+v", invoice)
+	}
+
+	changes := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodPatch, "/invoices/" + invoiceID, map[string]interface{}{"tip_amount": 2}},
+		{http.MethodPatch, "/invoices/" + invoiceID, map[string]interface{}{"payment_method": "CARD"}},
+		{http.MethodDelete, "/invoices/" + invoiceID, nil},
+		{http.MethodPatch, "/orderItems/" + orderItemID, map[string]interface{}{"quantity": 2}},
+		{http.MethodDelete, "/orderItems/" + orderItemID, nil},
+	}
+	for _, change := range changes {
+		if code := call(t, change.method, change.path, change.body, nil); code != http.StatusConflict {
+			t.Errorf("%s %s answered %d, want 409", change.method, change.path, code)
+		}
+	}
+
+	var stored model.Invoice
+	read(t, "invoices", invoiceID, &stored)
+	if *stored.InvoiceNumber != *invoice.InvoiceNumber || stored.Hash != invoice.Hash || stored.TipAmount != nil {
+		t.Errorf("locked invoice changed from %+v to %+v", invoice, stored)
+	}
+	if !exists(t, "orderItems", orderItemID) {
+		t.Error("item of a locked order was deleted")
+	}
+}
+
+func TestOpenInvoiceCanChange(t *testing.T) {
+	tableID, foodID := createFood(t, 10)
+	orderID, _ := orderFood(t, tableID, foodID)
+
+	invoiceID := create(t, "/invoices", map[string]interface{}{"order_id": orderID})
+	if code := call(t, http.MethodPatch, "/invoices/"+invoiceID, map[string]interface{}{"tip_amount": 2}, nil); code != http.StatusOK {
+		t.Fatalf("PATCH of an open invoice answered %d", code)
+	}
+
+	var invoice model.Invoice
+	read(t, "invoices", invoiceID, &invoice)
+	if invoice.InvoiceNumber != nil {
+		t.Errorf("open invoice was numbered %s", *invoice.InvoiceNumber)
+	}
+	if invoice.TipAmount == nil || *invoice.TipAmount != 2 {
+		t.Errorf("tip amount = %v, want 2", invoice.TipAmount)
+	}
+}
@@ -3,10 +3,14 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"main/allergen"
 	"main/database"
+	"main/export"
 	"main/model"
 	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/arangodb/go-driver"
@@ -22,12 +26,60 @@ var (
 
 var foodCollection = database.OpenCollection(db, "foods")
 
+func init() {
+	database.EnsureUniqueIndex(foodCollection, "sku")
+}
+
 type status map[string]interface{}
 
 func GetFoods() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		query := "FOR food IN foods LIMIT 10 RETURN food"
-		cursor, err := db.Query(context.TODO(), query, nil)
+		format := export.Negotiate(r)
+		query := `
+		FOR food IN foods
+			FILTER !@available OR (food.available != false AND (food.remaining_portions == null OR food.remaining_portions > 0))
+			FILTER @max_calories == null OR (food.nutrition.calories != null AND food.nutrition.calories <= @max_calories)
+			FILTER LENGTH(@diet) == 0 OR LENGTH(INTERSECTION(NOT_NULL(food.dietary_tags, []), @diet)) == LENGTH(@diet)
+			LET allergens = UNION(NOT_NULL(food.allergens, []), FLATTEN(DOCUMENT("foods", NOT_NULL(food.combo_items, [])[*].food_id)[*].allergens))
+			FILTER LENGTH(@allergen_free) == 0 OR LENGTH(INTERSECTION(allergens, @allergen_free)) == 0
+			LIMIT @limit
+			RETURN food`
+		bindVars := map[string]interface{}{
+			"available":     r.URL.Query().Get("available") == "true",
+			"max_calories":  nil,
+			"diet":          []string{},
+			"allergen_free": []string{},
+			"limit":         listLimit(format),
+		}
+
+		// combos count as containing the allergens of their components
+		allergenFree, err := tagFilter(r, "allergen_free", allergen.EU)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		} else if allergenFree != nil {
+			bindVars["allergen_free"] = allergenFree
+		}
+		diet, err := tagFilter(r, "diet", dietaryTags)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		} else if diet != nil {
+			bindVars["diet"] = diet
+		}
+		if value := r.URL.Query().Get("max_calories"); value != "" {
+			maxCalories, err := strconv.ParseFloat(value, 64)
+			if err != nil || maxCalories < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "max_calories must be a positive number"})
+				return
+			}
+			bindVars["max_calories"] = maxCalories
+		}
+
+		cursor, err := db.Query(exportContext(format), query, bindVars)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
@@ -35,6 +87,12 @@ func GetFoods() http.HandlerFunc {
 		}
 		defer cursor.Close()
 
+		if format != "" {
+			exportCursor[model.Food](w, format, "foods", cursor)
+			return
+		}
+
+		locale, defaultLocale := requestLocale(r)
 		foods := []model.Food{}
 		for {
 			var food model.Food
@@ -48,9 +106,11 @@ func GetFoods() http.HandlerFunc {
 				return
 			}
 
+			localizeFood(&food, locale, defaultLocale)
 			foods = append(foods, food)
 		}
 
+		setContentLanguage(w, locale)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(foods)
 	}
@@ -61,13 +121,20 @@ func GetFoodByID() http.HandlerFunc {
 		foodID := chi.URLParam(r, "food_id")
 		var food model.Food
 
-		_, err := foodCollection.ReadDocument(context.TODO(), foodID, &food)
+		meta, err := foodCollection.ReadDocument(context.TODO(), foodID, &food)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to fetch food item"})
 			return
 		}
 
+		locale, defaultLocale := requestLocale(r)
+		setContentLanguage(w, locale)
+		if writeETag(w, r, localizedETag(meta.Rev, locale)) {
+			return
+		}
+
+		localizeFood(&food, locale, defaultLocale)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(food)
 	}
@@ -83,7 +150,13 @@ func CreateFood() http.HandlerFunc {
 			return
 		}
 
+		food.Allergens = normalizeTags(food.Allergens)
+		food.DietaryTags = normalizeTags(food.DietaryTags)
+		food.Images = nil
 		err = validate.Struct(food)
+		if err == nil {
+			err = checkTranslations(food.Translations)
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
@@ -98,14 +171,43 @@ func CreateFood() http.HandlerFunc {
 			return
 		}
 
+		err = prepareModifierGroups(food.ModifierGroups)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		err = checkComboItems(food.ComboItems)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		err = prepareRecipe(food.Recipe)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
 		food.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		food.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		food.FoodID = uuid.NewString()
+		if food.Available == nil {
+			available := true
+			food.Available = &available
+		}
 		num := math.Round(*food.UnitPrice*100) / 100
 		food.UnitPrice = &num
 
 		meta, err := foodCollection.CreateDocument(context.TODO(), food)
-		if err != nil {
+		if driver.IsConflict(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "a food with this sku already exists"})
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to create food item"})
 			return
@@ -132,12 +234,35 @@ func UpdateFoodByID() http.HandlerFunc {
 		if food.Name != nil {
 			updateObject["name"] = food.Name
 		}
+		if food.SKU != nil {
+			updateObject["sku"] = food.SKU
+		}
+		if food.Station != nil {
+			updateObject["station"] = food.Station
+		}
 		if food.UnitPrice != nil {
 			updateObject["unit_price"] = food.UnitPrice
 		}
 		if food.FoodImage != nil {
 			updateObject["food_image"] = food.FoodImage
 		}
+		if food.Description != nil || food.Translations != nil {
+			err = validate.StructPartial(food, "Description", "Translations")
+			if err == nil {
+				err = checkTranslations(food.Translations)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "invalid description or translations"})
+				return
+			}
+		}
+		if food.Description != nil {
+			updateObject["description"] = food.Description
+		}
+		if food.Translations != nil {
+			updateObject["translations"] = food.Translations
+		}
 		if food.MenuID != nil {
 			var menu model.Menu
 			_, err = menuCollection.ReadDocument(context.TODO(), *food.MenuID, &menu)
@@ -148,17 +273,82 @@ func UpdateFoodByID() http.HandlerFunc {
 			}
 			updateObject["menu_id"] = food.MenuID
 		}
+		if food.ModifierGroups != nil {
+			err = validate.Var(food.ModifierGroups, "dive")
+			if err == nil {
+				err = prepareModifierGroups(food.ModifierGroups)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "invalid modifier groups"})
+				return
+			}
+			updateObject["modifier_groups"] = food.ModifierGroups
+		}
+		if food.ComboItems != nil {
+			err = validate.Var(food.ComboItems, "dive")
+			if err == nil {
+				err = checkComboItems(food.ComboItems)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "invalid combo items"})
+				return
+			}
+			updateObject["combo_items"] = food.ComboItems
+		}
+		if food.Recipe != nil {
+			err = validate.Var(food.Recipe, "dive")
+			if err == nil {
+				err = prepareRecipe(food.Recipe)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "invalid recipe"})
+				return
+			}
+			updateObject["recipe"] = food.Recipe
+		}
+		if food.Allergens != nil || food.DietaryTags != nil || food.Nutrition != nil {
+			food.Allergens = normalizeTags(food.Allergens)
+			food.DietaryTags = normalizeTags(food.DietaryTags)
+			err = validate.StructPartial(food, "Allergens", "DietaryTags")
+			if err == nil && food.Nutrition != nil {
+				err = validate.Struct(food.Nutrition)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "invalid allergens, dietary tags or nutrition"})
+				return
+			}
+		}
+		if food.Allergens != nil {
+			updateObject["allergens"] = food.Allergens
+		}
+		if food.DietaryTags != nil {
+			updateObject["dietary_tags"] = food.DietaryTags
+		}
+		if food.Nutrition != nil {
+			updateObject["nutrition"] = food.Nutrition
+		}
 
 		food.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObject["updated_at"] = food.UpdatedAt
 
-		meta, err := foodCollection.UpdateDocument(context.TODO(), foodID, updateObject)
-		if err != nil {
+		meta, err := foodCollection.UpdateDocument(revisionContext(r), foodID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if driver.IsConflict(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "a food with this sku already exists"})
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to create food item"})
 			return
 		}
 
+		setETag(w, meta.Rev)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(meta.Key)
 	}
@@ -168,14 +358,67 @@ func DeleteFoodByID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		foodID := chi.URLParam(r, "food_id")
 
-		meta, err := foodCollection.RemoveDocument(context.TODO(), foodID)
-		if err != nil {
+		var food model.Food
+		meta, err := foodCollection.RemoveDocument(driver.WithReturnOld(revisionContext(r), &food), foodID)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to delete food item"})
 			return
 		}
 
+		removeImages(food.Images)
+
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(meta.Key)
 	}
 }
+
+// prepareModifierGroups assigns ids to new modifier groups and options,
+// normalizes the option allergens and checks that the selection limits are
+// consistent.
+func prepareModifierGroups(groups []model.ModifierGroup) error {
+	for i := range groups {
+		group := &groups[i]
+		if group.GroupID == "" {
+			group.GroupID = uuid.NewString()
+		}
+		if group.MaxSelections > 0 && group.MinSelections > group.MaxSelections {
+			return fmt.Errorf("modifier group %q allows fewer selections than it requires", group.Name)
+		}
+		if group.MinSelections > len(group.Options) {
+			return fmt.Errorf("modifier group %q requires more selections than it has options", group.Name)
+		}
+
+		for j := range group.Options {
+			option := &group.Options[j]
+			if option.OptionID == "" {
+				option.OptionID = uuid.NewString()
+			}
+			option.Allergens = normalizeTags(option.Allergens)
+			for _, name := range option.Allergens {
+				if !contains(allergen.EU, name) {
+					return fmt.Errorf("modifier option %q has unknown allergen %q", option.Name, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkComboItems makes sure every component of a combo is an existing food
+// that is not itself a combo.
+func checkComboItems(items []model.ComboItem) error {
+	for _, item := range items {
+		var component model.Food
+		_, err := foodCollection.ReadDocument(context.TODO(), item.FoodID, &component)
+		if err != nil {
+			return fmt.Errorf("combo component %s was not found", item.FoodID)
+		}
+		if len(component.ComboItems) > 0 {
+			return fmt.Errorf("combo component %s is a combo itself", item.FoodID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,755 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"main/database"
+	"main/export"
+	"main/model"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var giftCardCollection = database.OpenCollection(db, "giftCards")
+var giftCardTransactionCollection = database.OpenCollection(db, "giftCardTransactions")
+
+// codes leave out letters and digits that are easily mistaken for each other
+const (
+	giftCardAlphabet   = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	giftCardCodeLength = 16
+)
+
+var (
+	errGiftCardNotFound  = errors.New("gift card was not found")
+	errGiftCardUnusable  = errors.New("gift card is inactive or expired")
+	errGiftCardEmpty     = errors.New("gift card has no balance left")
+	errNothingDue        = errors.New("nothing is left to pay on the invoice")
+	errGiftCardShort     = errors.New("gift cards do not cover the invoice total, pay the rest by another method")
+	errGiftCardsExceed   = errors.New("gift card payments exceed the invoice total, remove one first")
+	errGiftCardNotOnBill = errors.New("gift card payment was not found on the invoice")
+)
+
+func init() {
+	database.EnsureUniqueIndex(giftCardCollection, "code")
+	database.EnsurePersistentIndex(giftCardTransactionCollection, "gift_card_id")
+}
+
+func GetGiftCards() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := "FOR giftCard IN giftCards SORT giftCard.created_at DESC LIMIT @limit RETURN giftCard"
+		bindVars := map[string]interface{}{"limit": listLimit(format)}
+		cursor, err := db.Query(exportContext(format), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.GiftCard](w, format, "gift-cards", cursor)
+			return
+		}
+
+		giftCards := []model.GiftCard{}
+		for {
+			var giftCard model.GiftCard
+			_, err := cursor.ReadDocument(context.TODO(), &giftCard)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read gift cards"})
+				return
+			}
+
+			giftCards = append(giftCards, giftCard)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(giftCards)
+	}
+}
+
+func GetGiftCardByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		giftCardID := chi.URLParam(r, "gift_card_id")
+		var giftCard model.GiftCard
+
+		meta, err := giftCardCollection.ReadDocument(context.TODO(), giftCardID, &giftCard)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": errGiftCardNotFound.Error()})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch gift card"})
+			return
+		}
+
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(giftCard)
+	}
+}
+
+// GetGiftCardBalance looks a card up by its code, for guests asking what is
+// left on it. Only the last digits of the code are returned.
+func GetGiftCardBalance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		giftCard, err := giftCardByCode(context.TODO(), chi.URLParam(r, "code"))
+		if giftCardFailed(w, err) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(model.GiftCardBalance{
+			CardEnding: cardEnding(giftCard.Code),
+			Balance:    giftCard.Balance,
+			ExpiresAt:  giftCard.ExpiresAt,
+			Usable:     giftCardUsable(giftCard),
+		})
+	}
+}
+
+// IssueGiftCard sells a new gift card with a generated code.
+func IssueGiftCard() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var issue model.GiftCardIssue
+		err := json.NewDecoder(r.Body).Decode(&issue)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(issue)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+		if issue.ExpiresAt != nil && issue.ExpiresAt.Before(time.Now()) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "expiry date must be in the future"})
+			return
+		}
+		if customerFailed(w, checkCustomer(issue.CustomerID)) {
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		active := true
+		amount := roundMoney(issue.Amount)
+		giftCard := model.GiftCard{
+			GiftCardID:    uuid.NewString(),
+			InitialAmount: amount,
+			IssuedTo:      issue.IssuedTo,
+			CustomerID:    issue.CustomerID,
+			ExpiresAt:     issue.ExpiresAt,
+			Active:        &active,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+
+		// a generated code may already be taken, however unlikely
+		for attempt := 0; attempt < 3; attempt++ {
+			giftCard.Code, err = newGiftCardCode()
+			if err != nil {
+				break
+			}
+			err = runTransaction(giftCardCollections(), func(ctx context.Context) error {
+				giftCard.Balance = 0
+				_, err := giftCardCollection.CreateDocument(ctx, giftCard)
+				if err != nil {
+					return err
+				}
+				return moveGiftCardBalance(ctx, &giftCard, &model.GiftCardTransaction{
+					Type:          "ISSUE",
+					Amount:        amount,
+					PaymentMethod: &issue.PaymentMethod,
+				})
+			})
+			if !driver.IsConflict(err) {
+				break
+			}
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to issue gift card"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(giftCard)
+	}
+}
+
+func UpdateGiftCardByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		giftCardID := chi.URLParam(r, "gift_card_id")
+		var giftCard model.GiftCard
+		err := json.NewDecoder(r.Body).Decode(&giftCard)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.StructPartial(giftCard, "IssuedTo")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		updateObject := make(map[string]interface{})
+
+		if giftCard.IssuedTo != nil {
+			updateObject["issued_to"] = giftCard.IssuedTo
+		}
+		if giftCard.CustomerID != nil {
+			if *giftCard.CustomerID == "" {
+				giftCard.CustomerID = nil
+			} else if customerFailed(w, checkCustomer(giftCard.CustomerID)) {
+				return
+			}
+			updateObject["customer_id"] = giftCard.CustomerID
+		}
+		if giftCard.ExpiresAt != nil {
+			updateObject["expires_at"] = giftCard.ExpiresAt
+		}
+		if giftCard.Active != nil {
+			updateObject["active"] = giftCard.Active
+		}
+
+		giftCard.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObject["updated_at"] = giftCard.UpdatedAt
+
+		meta, err := giftCardCollection.UpdateDocument(revisionContext(r), giftCardID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": errGiftCardNotFound.Error()})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update gift card"})
+			return
+		}
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+// ReloadGiftCard puts more money on an existing card.
+func ReloadGiftCard() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		giftCardID := chi.URLParam(r, "gift_card_id")
+		var load model.GiftCardLoad
+		err := json.NewDecoder(r.Body).Decode(&load)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(load)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		var giftCard model.GiftCard
+		err = runTransaction(giftCardCollections(), func(ctx context.Context) error {
+			_, err := giftCardCollection.ReadDocument(ctx, giftCardID, &giftCard)
+			if driver.IsNotFound(err) {
+				return errGiftCardNotFound
+			} else if err != nil {
+				return err
+			}
+			if !giftCardUsable(giftCard) {
+				return errGiftCardUnusable
+			}
+			return moveGiftCardBalance(ctx, &giftCard, &model.GiftCardTransaction{
+				Type:          "RELOAD",
+				Amount:        roundMoney(load.Amount),
+				PaymentMethod: &load.PaymentMethod,
+			})
+		})
+		if giftCardFailed(w, err) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(giftCard)
+	}
+}
+
+func GetGiftCardTransactions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		giftCardID := chi.URLParam(r, "gift_card_id")
+		format := export.Negotiate(r)
+		query := `
+		FOR entry IN giftCardTransactions
+			FILTER entry.gift_card_id == @gift_card_id
+			SORT entry.created_at DESC
+			LIMIT @limit
+			RETURN entry`
+		bindVars := map[string]interface{}{"gift_card_id": giftCardID, "limit": listLimit(format)}
+		cursor, err := db.Query(exportContext(format), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.GiftCardTransaction](w, format, "gift-card-transactions", cursor)
+			return
+		}
+
+		transactions := []model.GiftCardTransaction{}
+		for {
+			var transaction model.GiftCardTransaction
+			_, err := cursor.ReadDocument(context.TODO(), &transaction)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read gift card transactions"})
+				return
+			}
+
+			transactions = append(transactions, transaction)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(transactions)
+	}
+}
+
+// GetGiftCardLiability totals the ledger and compares it with what the cards
+// still hold, which is what the restaurant owes its gift card holders.
+func GetGiftCardLiability() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := `
+		LET ledger = (
+			FOR entry IN giftCardTransactions
+				COLLECT type = entry.type AGGREGATE amount = SUM(entry.amount)
+				RETURN { type, amount }
+		)
+		RETURN {
+			cards: LENGTH(giftCards),
+			issued: NOT_NULL(SUM(ledger[* FILTER CURRENT.type == "ISSUE"].amount), 0),
+			reloaded: NOT_NULL(SUM(ledger[* FILTER CURRENT.type == "RELOAD"].amount), 0),
+			redeemed: -NOT_NULL(SUM(ledger[* FILTER CURRENT.type == "REDEEM"].amount), 0),
+			refunded: NOT_NULL(SUM(ledger[* FILTER CURRENT.type == "REFUND"].amount), 0),
+			ledger_balance: NOT_NULL(SUM(ledger[*].amount), 0),
+			outstanding: NOT_NULL(SUM(FOR giftCard IN giftCards RETURN giftCard.balance), 0)
+		}`
+		cursor, err := db.Query(context.TODO(), query, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		var liability model.GiftCardLiability
+		_, err = cursor.ReadDocument(context.TODO(), &liability)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to read gift card liability"})
+			return
+		}
+
+		liability.Issued = roundMoney(liability.Issued)
+		liability.Reloaded = roundMoney(liability.Reloaded)
+		liability.Redeemed = roundMoney(liability.Redeemed)
+		liability.Refunded = roundMoney(liability.Refunded)
+		liability.LedgerBalance = roundMoney(liability.LedgerBalance)
+		liability.Outstanding = roundMoney(liability.Outstanding)
+		liability.Difference = roundMoney(liability.Outstanding - liability.LedgerBalance)
+		liability.Reconciled = liability.Difference == 0
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(liability)
+	}
+}
+
+// RedeemGiftCard pays part or all of an unpaid invoice from a gift card. The
+// amount defaults to whatever is still due, limited by the card's balance.
+func RedeemGiftCard() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID := chi.URLParam(r, "invoice_id")
+		var redemption model.GiftCardRedemption
+		err := json.NewDecoder(r.Body).Decode(&redemption)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(redemption)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		var invoice model.Invoice
+		_, err = invoiceCollection.ReadDocument(context.TODO(), invoiceID, &invoice)
+		if driver.IsNotFound(err) {
+			giftCardFailed(w, errInvoiceNotFound)
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch invoice item"})
+			return
+		}
+		data, err := invoiceReceipt(invoice)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		var payment model.GiftCardPayment
+		collections := giftCardCollections(invoiceCollection.Name())
+		err = runTransaction(collections, func(ctx context.Context) error {
+			var stored model.Invoice
+			_, err := invoiceCollection.ReadDocument(ctx, invoiceID, &stored)
+			if err != nil {
+				return err
+			}
+			if invoiceIsLocked(stored) {
+				return errInvoiceLocked
+			}
+
+			giftCard, err := giftCardByCode(ctx, redemption.Code)
+			if err != nil {
+				return err
+			}
+			if !giftCardUsable(giftCard) {
+				return errGiftCardUnusable
+			}
+
+			amount := roundMoney(data.Total - giftCardTotal(stored))
+			if amount <= 0 {
+				return errNothingDue
+			}
+			if redemption.Amount != nil && *redemption.Amount < amount {
+				amount = roundMoney(*redemption.Amount)
+			}
+			if giftCard.Balance < amount {
+				amount = giftCard.Balance
+			}
+			if amount <= 0 {
+				return errGiftCardEmpty
+			}
+
+			entry := model.GiftCardTransaction{
+				Type:      "REDEEM",
+				Amount:    -amount,
+				InvoiceID: &stored.InvoiceID,
+			}
+			err = moveGiftCardBalance(ctx, &giftCard, &entry)
+			if err != nil {
+				return err
+			}
+
+			payment = model.GiftCardPayment{
+				PaymentID:  entry.TransactionID,
+				GiftCardID: giftCard.GiftCardID,
+				CardEnding: cardEnding(giftCard.Code),
+				Amount:     amount,
+			}
+			updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			_, err = invoiceCollection.UpdateDocument(ctx, invoiceID, map[string]interface{}{
+				"gift_cards": append(stored.GiftCards, payment),
+				"updated_at": updatedAt,
+			})
+			return err
+		})
+		if giftCardFailed(w, err) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(payment)
+	}
+}
+
+// RemoveGiftCardPayment takes a gift card payment off an unpaid invoice and
+// puts the amount back on the card.
+func RemoveGiftCardPayment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID := chi.URLParam(r, "invoice_id")
+		paymentID := chi.URLParam(r, "payment_id")
+
+		collections := giftCardCollections(invoiceCollection.Name())
+		err := runTransaction(collections, func(ctx context.Context) error {
+			var invoice model.Invoice
+			_, err := invoiceCollection.ReadDocument(ctx, invoiceID, &invoice)
+			if driver.IsNotFound(err) {
+				return errInvoiceNotFound
+			} else if err != nil {
+				return err
+			}
+			if invoiceIsLocked(invoice) {
+				return errInvoiceLocked
+			}
+
+			kept := []model.GiftCardPayment{}
+			removed := []model.GiftCardPayment{}
+			for _, payment := range invoice.GiftCards {
+				if payment.PaymentID == paymentID {
+					removed = append(removed, payment)
+				} else {
+					kept = append(kept, payment)
+				}
+			}
+			if len(removed) == 0 {
+				return errGiftCardNotOnBill
+			}
+
+			err = refundGiftCardPayments(ctx, invoiceID, removed, "payment removed from invoice")
+			if err != nil {
+				return err
+			}
+			updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			_, err = invoiceCollection.UpdateDocument(ctx, invoiceID, map[string]interface{}{
+				"gift_cards": kept,
+				"updated_at": updatedAt,
+			})
+			return err
+		})
+		if giftCardFailed(w, err) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(status{"success": "gift card payment removed"})
+	}
+}
+
+func giftCardCollections(more ...string) driver.TransactionCollections {
+	return driver.TransactionCollections{
+		Write: append([]string{giftCardCollection.Name(), giftCardTransactionCollection.Name()}, more...),
+	}
+}
+
+// refundGiftCardPayments puts the payments of an invoice back on their
+// cards, whether or not the cards are still usable.
+func refundGiftCardPayments(ctx context.Context, invoiceID string, payments []model.GiftCardPayment, note string) error {
+	for _, payment := range payments {
+		var giftCard model.GiftCard
+		_, err := giftCardCollection.ReadDocument(ctx, payment.GiftCardID, &giftCard)
+		if driver.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		err = moveGiftCardBalance(ctx, &giftCard, &model.GiftCardTransaction{
+			Type:      "REFUND",
+			Amount:    payment.Amount,
+			InvoiceID: &invoiceID,
+			Note:      note,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refundCreditedGiftCards gives the gift cards that paid an invoice their
+// share of a credit note. The credit note that settles the rest of the
+// invoice gives back whatever is left of each payment, so rounding never
+// keeps money off a card. It runs in the transaction that issues the credit
+// note.
+func refundCreditedGiftCards(ctx context.Context, invoice model.Invoice, creditNote model.CreditNote) error {
+	if len(invoice.GiftCards) == 0 || invoice.Total <= 0 {
+		return nil
+	}
+
+	query := `
+	FOR entry IN giftCardTransactions
+		FILTER entry.invoice_id == @invoice_id AND entry.credit_note_id != null
+		COLLECT giftCardID = entry.gift_card_id AGGREGATE refunded = SUM(entry.amount)
+		RETURN { gift_card_id: giftCardID, refunded: refunded }`
+	cursor, err := db.Query(ctx, query, map[string]interface{}{"invoice_id": invoice.InvoiceID})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	refunded := make(map[string]float64)
+	for {
+		var row struct {
+			GiftCardID string  `json:"gift_card_id"`
+			Refunded   float64 `json:"refunded"`
+		}
+		_, err := cursor.ReadDocument(ctx, &row)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+		refunded[row.GiftCardID] = row.Refunded
+	}
+
+	ratio := creditNote.Total / invoice.Total
+	settled := roundMoney(invoice.CreditedTotal+creditNote.Total) >= invoice.Total
+	for _, payment := range invoice.GiftCards {
+		remaining := roundMoney(payment.Amount - refunded[payment.GiftCardID])
+		amount := roundMoney(payment.Amount * ratio)
+		if settled || amount > remaining {
+			amount = remaining
+		}
+		if amount <= 0 {
+			continue
+		}
+		refunded[payment.GiftCardID] += amount
+
+		var giftCard model.GiftCard
+		_, err := giftCardCollection.ReadDocument(ctx, payment.GiftCardID, &giftCard)
+		if driver.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		err = moveGiftCardBalance(ctx, &giftCard, &model.GiftCardTransaction{
+			Type:         "REFUND",
+			Amount:       amount,
+			InvoiceID:    &invoice.InvoiceID,
+			CreditNoteID: &creditNote.CreditNoteID,
+			Note:         "credit note " + creditNote.CreditNoteNumber,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveGiftCardBalance records the entry in the ledger and changes the card's
+// balance by its amount.
+func moveGiftCardBalance(ctx context.Context, giftCard *model.GiftCard, entry *model.GiftCardTransaction) error {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	giftCard.Balance = roundMoney(giftCard.Balance + entry.Amount)
+	giftCard.UpdatedAt = now
+
+	entry.TransactionID = uuid.NewString()
+	entry.GiftCardID = giftCard.GiftCardID
+	entry.Balance = giftCard.Balance
+	entry.CreatedAt = now
+	_, err := giftCardTransactionCollection.CreateDocument(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = giftCardCollection.UpdateDocument(ctx, giftCard.GiftCardID, map[string]interface{}{
+		"balance":    giftCard.Balance,
+		"updated_at": giftCard.UpdatedAt,
+	})
+	return err
+}
+
+func giftCardByCode(ctx context.Context, code string) (model.GiftCard, error) {
+	var giftCard model.GiftCard
+	query := "FOR giftCard IN giftCards FILTER giftCard.code == @code LIMIT 1 RETURN giftCard"
+	cursor, err := db.Query(ctx, query, map[string]interface{}{"code": normalizeGiftCardCode(code)})
+	if err != nil {
+		return giftCard, err
+	}
+	defer cursor.Close()
+
+	_, err = cursor.ReadDocument(ctx, &giftCard)
+	if driver.IsNoMoreDocuments(err) {
+		return giftCard, errGiftCardNotFound
+	}
+	return giftCard, err
+}
+
+func giftCardUsable(giftCard model.GiftCard) bool {
+	if giftCard.Active != nil && !*giftCard.Active {
+		return false
+	}
+	return giftCard.ExpiresAt == nil || giftCard.ExpiresAt.After(time.Now())
+}
+
+// giftCardTotal is the part of the invoice already paid from gift cards.
+func giftCardTotal(invoice model.Invoice) float64 {
+	total := 0.0
+	for _, payment := range invoice.GiftCards {
+		total += payment.Amount
+	}
+	return roundMoney(total)
+}
+
+func newGiftCardCode() (string, error) {
+	code := make([]byte, giftCardCodeLength)
+	size := big.NewInt(int64(len(giftCardAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		code[i] = giftCardAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeGiftCardCode accepts codes typed in lower case or in groups
+// separated by dashes or spaces.
+func normalizeGiftCardCode(code string) string {
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return strings.ToUpper(code)
+}
+
+func cardEnding(code string) string {
+	if len(code) <= 4 {
+		return code
+	}
+	return code[len(code)-4:]
+}
+
+// giftCardFailed writes the response for an error of a gift card operation.
+func giftCardFailed(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errGiftCardNotFound), errors.Is(err, errInvoiceNotFound), errors.Is(err, errGiftCardNotOnBill):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+	case errors.Is(err, errGiftCardUnusable), errors.Is(err, errGiftCardEmpty), errors.Is(err, errNothingDue), errors.Is(err, errInvoiceLocked):
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(status{"error": "failed to update gift card"})
+	}
+	return true
+}
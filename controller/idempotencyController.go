@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"main/database"
+	"main/model"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const idempotencyKeyTTL = 24 * time.Hour
+
+var idempotencyCollection = database.OpenCollection(db, "idempotencyKeys")
+
+func init() {
+	database.EnsureTTLIndex(idempotencyCollection, "expires_at", 0)
+}
+
+// Idempotent replays the stored response of a create request when a client
+// retries it with the same Idempotency-Key header.
+func Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to read request body"})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		requestHash := sha256.Sum256(body)
+		recordID := sha256.Sum256([]byte(r.Method + " " + r.URL.Path + " " + key))
+
+		record := model.IdempotencyRecord{
+			RecordID:    hex.EncodeToString(recordID[:]),
+			Key:         key,
+			Path:        r.URL.Path,
+			RequestHash: hex.EncodeToString(requestHash[:]),
+			ExpiresAt:   time.Now().Add(idempotencyKeyTTL).Unix(),
+		}
+
+		_, err = idempotencyCollection.CreateDocument(context.TODO(), record)
+		if driver.IsConflict(err) {
+			replayIdempotentResponse(w, record)
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to store idempotency key"})
+			return
+		}
+
+		var response bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&response)
+		next.ServeHTTP(ww, r)
+
+		// server errors are not cached so that the client can retry them
+		if ww.Status() >= http.StatusInternalServerError {
+			releaseIdempotencyKey(record)
+			return
+		}
+
+		updateObject := map[string]interface{}{
+			"completed":    true,
+			"status_code":  ww.Status(),
+			"content_type": ww.Header().Get("Content-Type"),
+			"body":         response.String(),
+		}
+		_, err = idempotencyCollection.UpdateDocument(context.TODO(), record.RecordID, updateObject)
+		if err != nil {
+			// without the stored response a retry would be refused as still in
+			// progress, so the key is given up instead
+			log.Printf("failed to store response for idempotency key %s: %v", record.Key, err)
+			releaseIdempotencyKey(record)
+		}
+	})
+}
+
+// releaseIdempotencyKey removes the record of a request so that the key can
+// be used again.
+func releaseIdempotencyKey(record model.IdempotencyRecord) {
+	_, err := idempotencyCollection.RemoveDocument(context.TODO(), record.RecordID)
+	if err != nil && !driver.IsNotFound(err) {
+		log.Printf("failed to release idempotency key %s: %v", record.Key, err)
+	}
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, record model.IdempotencyRecord) {
+	var stored model.IdempotencyRecord
+	_, err := idempotencyCollection.ReadDocument(context.TODO(), record.RecordID, &stored)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(status{"error": "failed to fetch idempotency key"})
+		return
+	}
+
+	if stored.RequestHash != record.RequestHash {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(status{"error": "idempotency key was already used with a different request body"})
+		return
+	}
+
+	if !stored.Completed {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status{"error": "a request with this idempotency key is still in progress"})
+		return
+	}
+
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.StatusCode)
+	io.WriteString(w, stored.Body)
+}
@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"io"
+	"log"
+	"main/model"
+	"main/storage"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// maxImagePixels leaves room for the 12 megapixel photos of current phones;
+// an upload is held decoded and once more as RGBA while it is resized.
+const (
+	maxImageSize   = 5 << 20
+	maxImagePixels = 16_000_000
+)
+
+// resized copies made of every upload, by width in pixels
+var imageVariants = []struct {
+	name  string
+	width int
+}{
+	{"medium", 800},
+	{"thumbnail", 200},
+}
+
+var imageExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+var imageStorage = openImageStorage()
+
+var errImageTooLarge = fmt.Errorf("images may be at most %d MB", maxImageSize>>20)
+
+func openImageStorage() storage.Storage {
+	images, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to open image storage:", err)
+	}
+	return images
+}
+
+// ServeImages serves uploaded images when they are stored on the local
+// filesystem and returns the path to mount the handler under, taken from
+// STORAGE_BASE_URL. The path is empty when the images are stored elsewhere.
+func ServeImages() (string, http.Handler) {
+	local, ok := imageStorage.(*storage.LocalStorage)
+	if !ok {
+		return "", http.NotFoundHandler()
+	}
+	return local.Path(), http.StripPrefix(local.Path()+"/", local)
+}
+
+// UploadFoodImage stores the image of a food from the "image" field of a
+// multipart form together with resized variants, replacing any earlier one.
+func UploadFoodImage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		foodID := chi.URLParam(r, "food_id")
+
+		var food model.Food
+		_, err := foodCollection.ReadDocument(context.TODO(), foodID, &food)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": "food was not found"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch food item"})
+			return
+		}
+
+		data, err := readImageUpload(w, r)
+		if errors.Is(err, errImageTooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		contentType := mimetype.Detect(data).String()
+		extension, ok := imageExtensions[contentType]
+		if !ok {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			json.NewEncoder(w).Encode(status{"error": "images must be jpeg, png or gif"})
+			return
+		}
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err == nil && config.Width*config.Height > maxImagePixels {
+			err = errors.New("image has too many pixels")
+		}
+		var decoded image.Image
+		if err == nil {
+			decoded, _, err = image.Decode(bytes.NewReader(data))
+		}
+		var pixels *image.RGBA
+		if err == nil {
+			pixels = storage.ToRGBA(decoded)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "image could not be read"})
+			return
+		}
+
+		prefix := fmt.Sprintf("foods/%s/%s", foodID, uuid.NewString())
+		images := []model.StoredImage{{
+			Variant:     "original",
+			Key:         prefix + "-original." + extension,
+			ContentType: contentType,
+			Width:       config.Width,
+			Height:      config.Height,
+			Size:        len(data),
+		}}
+		files := [][]byte{data}
+		for _, variant := range imageVariants {
+			resized := storage.Resize(pixels, variant.width)
+			encoded, variantType, err := storage.EncodeImage(resized, contentType)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to resize image"})
+				return
+			}
+			images = append(images, model.StoredImage{
+				Variant:     variant.name,
+				Key:         prefix + "-" + variant.name + "." + imageExtensions[variantType],
+				ContentType: variantType,
+				Width:       resized.Bounds().Dx(),
+				Height:      resized.Bounds().Dy(),
+				Size:        len(encoded),
+			})
+			files = append(files, encoded)
+		}
+
+		for i := range images {
+			images[i].URL = imageStorage.URL(images[i].Key)
+			err = imageStorage.Put(context.TODO(), images[i].Key, files[i], images[i].ContentType)
+			if err != nil {
+				removeImages(images[:i])
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to store image"})
+				return
+			}
+		}
+
+		// the images replaced are taken from the update itself, so that of
+		// two uploads at once each removes only what it overwrote
+		var old model.Food
+		ctx := driver.WithReturnOld(revisionContext(r), &old)
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		meta, err := foodCollection.UpdateDocument(ctx, foodID, map[string]interface{}{
+			"images":     images,
+			"food_image": images[0].URL,
+			"updated_at": updatedAt,
+		})
+		if err != nil {
+			removeImages(images)
+		}
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update food item"})
+			return
+		}
+
+		removeImages(old.Images)
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(images)
+	}
+}
+
+// DeleteFoodImage removes the uploaded image of a food.
+func DeleteFoodImage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		foodID := chi.URLParam(r, "food_id")
+
+		var food model.Food
+		_, err := foodCollection.ReadDocument(context.TODO(), foodID, &food)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": "food was not found"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch food item"})
+			return
+		}
+
+		var old model.Food
+		ctx := driver.WithReturnOld(revisionContext(r), &old)
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		meta, err := foodCollection.UpdateDocument(ctx, foodID, map[string]interface{}{
+			"images":     nil,
+			"food_image": nil,
+			"updated_at": updatedAt,
+		})
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update food item"})
+			return
+		}
+
+		removeImages(old.Images)
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func readImageUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	// leave room for the rest of the multipart body
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageSize+1<<20)
+	file, _, err := r.FormFile("image")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, errImageTooLarge
+	} else if err != nil {
+		return nil, errors.New("an image file is required in the image field")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageSize {
+		return nil, errImageTooLarge
+	}
+	return data, nil
+}
+
+// removeImages deletes stored files that are no longer referenced. Failures
+// only leave unused files behind, so they are logged.
+func removeImages(images []model.StoredImage) {
+	for _, stored := range images {
+		err := imageStorage.Delete(context.TODO(), stored.Key)
+		if err != nil {
+			log.Printf("failed to delete image %s: %v", stored.Key, err)
+		}
+	}
+}
+
+// foodImageCleanup remembers the images of the foods and removes those of
+// the foods that no longer exist when the returned function is called.
+func foodImageCleanup(foodIDs []string) func() {
+	query := "FOR food IN foods FILTER food._key IN @keys AND LENGTH(food.images) > 0 RETURN food"
+	foods, err := readAll[model.Food](context.TODO(), query, map[string]interface{}{"keys": foodIDs})
+	if err != nil {
+		log.Println("failed to read food images:", err)
+	}
+	return func() {
+		for _, food := range foods {
+			exists, err := foodCollection.DocumentExists(context.TODO(), food.FoodID)
+			if err == nil && !exists {
+				removeImages(food.Images)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+//go:build integration
+
+package controller_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"main/controller"
+	"main/model"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+// uploadImage uploads a png wide enough to be resized to every variant.
+func uploadImage(t *testing.T, foodID string) []model.StoredImage {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 10))
+	for x := 0; x < 1000; x++ {
+		img.Set(x, 5, color.RGBA{R: uint8(x), A: 255})
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("image", "food.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	form.Close()
+
+	var images []model.StoredImage
+	path := "/foods/" + foodID + "/image"
+	if code := send(t, http.MethodPost, path, form.FormDataContentType(), &body, &images); code != http.StatusOK {
+		t.Fatalf("POST %s answered %d", path, code)
+	}
+	if len(images) != 3 {
+		t.Fatalf("upload stored %d images, want the original and 2 variants", len(images))
+	}
+	return images
+}
+
+// checkStored checks that each image can or can no longer be fetched.
+func checkStored(t *testing.T, images []model.StoredImage, stored bool) {
+	t.Helper()
+	want := http.StatusNotFound
+	if stored {
+		want = http.StatusOK
+	}
+	for _, img := range images {
+		if code := send(t, http.MethodGet, img.URL, "", nil, nil); code != want {
+			t.Errorf("GET %s answered %d, want %d", img.URL, code, want)
+		}
+	}
+}
+
+func TestFoodImageCleanup(t *testing.T) {
+	if path, _ := controller.ServeImages(); path == "" {
+		t.Skip("images are not stored locally")
+	}
+
+	_, foodID := createFood(t, 10)
+	first := uploadImage(t, foodID)
+	checkStored(t, first, true)
+
+	// a new upload replaces the files of the earlier one
+	second := uploadImage(t, foodID)
+	checkStored(t, first, false)
+	checkStored(t, second, true)
+
+	if code := call(t, http.MethodDelete, "/foods/"+foodID+"/image", nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE of the image answered %d", code)
+	}
+	checkStored(t, second, false)
+	var food model.Food
+	read(t, "foods", foodID, &food)
+	if food.FoodImage != nil || len(food.Images) != 0 {
+		t.Errorf("food still refers to its deleted image: %v %v", food.FoodImage, food.Images)
+	}
+
+	// deleting the food removes its files
+	third := uploadImage(t, foodID)
+	if code := call(t, http.MethodDelete, "/foods/"+foodID, nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE of the food answered %d", code)
+	}
+	checkStored(t, third, false)
+}
+
+func TestBatchDeleteRemovesFoodImages(t *testing.T) {
+	if path, _ := controller.ServeImages(); path == "" {
+		t.Skip("images are not stored locally")
+	}
+
+	_, foodID := createFood(t, 10)
+	images := uploadImage(t, foodID)
+
+	var response model.BatchResponse
+	if code := call(t, http.MethodDelete, "/foods:batchDelete", []string{foodID}, &response); code != http.StatusOK {
+		t.Fatalf("batch delete answered %d", code)
+	}
+	if response.Succeeded != 1 {
+		t.Fatalf("batch delete removed %d foods, want 1: %+v", response.Succeeded, response.Results)
+	}
+	checkStored(t, images, false)
+}
@@ -0,0 +1,443 @@
+package controller
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"main/model"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/google/uuid"
+)
+
+const maxImportSize = 10 << 20
+
+var errUnknownImportFormat = errors.New("import format must be csv or json")
+
+// importInputError marks errors of the file itself, as opposed to failures
+// of the database.
+type importInputError struct{ error }
+
+// catalogEntry is one input row, or the reason it could not be decoded.
+type catalogEntry struct {
+	row model.CatalogRow
+	err error
+}
+
+func ImportCatalog() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if mediaType == "text/csv" {
+				format = "csv"
+			}
+		}
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+
+		report, err := RunCatalogImport(http.MaxBytesReader(w, r.Body, maxImportSize), format, dryRun)
+		var inputErr importInputError
+		if errors.As(err, &inputErr) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to import catalog"})
+			return
+		}
+
+		if len(report.Errors) > 0 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// RunCatalogImport validates every row of a csv or json catalog and, unless
+// dryRun is set, upserts its menus and foods by SKU in one transaction.
+// Nothing is written when any row fails. Rows are numbered from 1, not
+// counting the csv header.
+func RunCatalogImport(input io.Reader, format string, dryRun bool) (model.CatalogImportReport, error) {
+	var entries []catalogEntry
+	var err error
+	switch format {
+	case "csv":
+		entries, err = readCatalogCSV(input)
+	case "json":
+		entries, err = readCatalogJSON(input)
+	default:
+		err = errUnknownImportFormat
+	}
+	if err != nil {
+		return model.CatalogImportReport{}, importInputError{err}
+	}
+
+	report := model.CatalogImportReport{DryRun: dryRun, Rows: len(entries), Errors: []model.CatalogImportError{}}
+	rowError := func(i int, err error) {
+		sku := ""
+		if entries[i].row.SKU != nil {
+			sku = *entries[i].row.SKU
+		}
+		report.Errors = append(report.Errors, model.CatalogImportError{Row: i + 1, SKU: sku, Error: err.Error()})
+	}
+
+	menuSKUs, foodSKUs := []string{}, []string{}
+	seenFoods := make(map[string]bool)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.err == nil {
+			entry.err = validate.Struct(entry.row)
+		}
+		if entry.err == nil && seenFoods[*entry.row.SKU] {
+			entry.err = fmt.Errorf("sku %s appears more than once", *entry.row.SKU)
+		}
+		if entry.err != nil {
+			continue
+		}
+
+		seenFoods[*entry.row.SKU] = true
+		foodSKUs = append(foodSKUs, *entry.row.SKU)
+		menuSKUs = append(menuSKUs, *entry.row.MenuSKU)
+	}
+
+	existingMenus, err := readBySKU[model.Menu]("menus", menuSKUs)
+	if err != nil {
+		return model.CatalogImportReport{}, err
+	}
+	existingFoods, err := readBySKU[model.Food]("foods", foodSKUs)
+	if err != nil {
+		return model.CatalogImportReport{}, err
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	// later rows may repeat the menu columns or leave them blank
+	menus := make(map[string]*model.Menu)
+	menuFields := make(map[string][]string)
+	menuOrder := []string{}
+	for _, entry := range entries {
+		if entry.err != nil {
+			continue
+		}
+		row := entry.row
+
+		menu, ok := menus[*row.MenuSKU]
+		if !ok {
+			if existing, found := existingMenus[*row.MenuSKU]; found {
+				menu = &existing
+			} else {
+				menu = &model.Menu{MenuID: uuid.NewString(), SKU: row.MenuSKU, CreatedAt: now}
+			}
+			menus[*row.MenuSKU] = menu
+			menuFields[*row.MenuSKU] = []string{"updated_at"}
+			menuOrder = append(menuOrder, *row.MenuSKU)
+		}
+
+		fields := menuFields[*row.MenuSKU]
+		if row.MenuName != nil {
+			menu.Name = *row.MenuName
+			fields = addField(fields, "name")
+		}
+		if row.MenuCategory != nil {
+			menu.Category = *row.MenuCategory
+			fields = addField(fields, "category")
+		}
+		if row.MenuStartDate != nil {
+			menu.StartDate = row.MenuStartDate
+			fields = addField(fields, "start_date")
+		}
+		if row.MenuEndDate != nil {
+			menu.EndDate = row.MenuEndDate
+			fields = addField(fields, "end_date")
+		}
+		if row.MenuTimezone != nil {
+			menu.Timezone = *row.MenuTimezone
+			fields = addField(fields, "timezone")
+		}
+		menuFields[*row.MenuSKU] = fields
+		menu.UpdatedAt = now
+	}
+
+	menuErrors := make(map[string]error)
+	for _, sku := range menuOrder {
+		menu := *menus[sku]
+		err := validate.Struct(menu)
+		if err == nil {
+			err = checkMenuAvailability(menu)
+		}
+		if err != nil {
+			menuErrors[sku] = fmt.Errorf("menu %s: %v", sku, err)
+		} else if _, found := existingMenus[sku]; found {
+			report.MenusUpdated++
+		} else {
+			report.MenusCreated++
+		}
+	}
+
+	foods := []catalogWrite[model.Food]{}
+	for i, entry := range entries {
+		if entry.err != nil {
+			rowError(i, entry.err)
+			continue
+		}
+		if err := menuErrors[*entry.row.MenuSKU]; err != nil {
+			rowError(i, err)
+			continue
+		}
+
+		food, fields, err := catalogFood(entry.row, existingFoods, menus[*entry.row.MenuSKU].MenuID, now)
+		if err != nil {
+			rowError(i, err)
+			continue
+		}
+
+		if _, found := existingFoods[*entry.row.SKU]; found {
+			report.FoodsUpdated++
+		} else {
+			report.FoodsCreated++
+		}
+		foods = append(foods, catalogWrite[model.Food]{food, fields})
+	}
+
+	if dryRun || len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	menuDocuments := []catalogWrite[model.Menu]{}
+	for _, sku := range menuOrder {
+		menuDocuments = append(menuDocuments, catalogWrite[model.Menu]{*menus[sku], menuFields[sku]})
+	}
+	collections := driver.TransactionCollections{Write: []string{menuCollection.Name(), foodCollection.Name()}}
+	err = runTransaction(collections, func(ctx context.Context) error {
+		err := upsertBySKU(ctx, "menus", menuDocuments)
+		if err != nil {
+			return err
+		}
+		return upsertBySKU(ctx, "foods", foods)
+	})
+	if err != nil {
+		return model.CatalogImportReport{}, err
+	}
+
+	return report, nil
+}
+
+// catalogFood applies an import row to the stored food with the same SKU, or
+// to a new food, and runs the same checks as CreateFood. It also returns the
+// attributes the row sets.
+func catalogFood(row model.CatalogRow, existingFoods map[string]model.Food, menuID string, now time.Time) (model.Food, []string, error) {
+	food, found := existingFoods[*row.SKU]
+	if !found {
+		available := true
+		food = model.Food{FoodID: uuid.NewString(), SKU: row.SKU, Available: &available, CreatedAt: now}
+	}
+
+	fields := []string{"menu_id", "updated_at"}
+	food.MenuID = &menuID
+	if row.Name != nil {
+		food.Name = row.Name
+		fields = append(fields, "name")
+	}
+	if row.UnitPrice != nil {
+		price := math.Round(*row.UnitPrice*100) / 100
+		food.UnitPrice = &price
+		fields = append(fields, "unit_price")
+	}
+	if row.FoodImage != nil {
+		food.FoodImage = row.FoodImage
+		fields = append(fields, "food_image")
+	}
+	if row.Available != nil {
+		food.Available = row.Available
+		fields = append(fields, "available")
+	}
+	if row.ModifierGroups != nil {
+		food.ModifierGroups = row.ModifierGroups
+		fields = append(fields, "modifier_groups")
+	}
+	if row.Recipe != nil {
+		food.Recipe = row.Recipe
+		fields = append(fields, "recipe")
+	}
+	food.UpdatedAt = now
+
+	err := validate.Struct(food)
+	if err != nil {
+		return food, fields, err
+	}
+	err = prepareModifierGroups(food.ModifierGroups)
+	if err != nil {
+		return food, fields, err
+	}
+	if row.Recipe != nil {
+		err = prepareRecipe(food.Recipe)
+	}
+	return food, fields, err
+}
+
+func addField(fields []string, field string) []string {
+	if contains(fields, field) {
+		return fields
+	}
+	return append(fields, field)
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func readCatalogJSON(input io.Reader) ([]catalogEntry, error) {
+	var rows []json.RawMessage
+	err := json.NewDecoder(input).Decode(&rows)
+	if err != nil {
+		return nil, errors.New("json imports must be an array of rows")
+	}
+
+	entries := make([]catalogEntry, len(rows))
+	for i, raw := range rows {
+		entries[i].err = json.Unmarshal(raw, &entries[i].row)
+	}
+	return entries, nil
+}
+
+// readCatalogCSV maps columns onto the json names of model.CatalogRow.
+// Modifier groups and recipes are written as json in their cells, the same
+// way exports render nested values.
+func readCatalogCSV(input io.Reader) ([]catalogEntry, error) {
+	textColumns := make(map[string]bool)
+	rowType := reflect.TypeOf(model.CatalogRow{})
+	for i := 0; i < rowType.NumField(); i++ {
+		field := rowType.Field(i)
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		textColumns[field.Tag.Get("json")] = fieldType.Kind() == reflect.String || fieldType == reflect.TypeOf(time.Time{})
+	}
+
+	reader := csv.NewReader(input)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("csv imports need a header row")
+	}
+	for _, name := range header {
+		if _, ok := textColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+
+	entries := []catalogEntry{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		var entry catalogEntry
+		object := make(map[string]json.RawMessage)
+		for i, cell := range record {
+			cell = strings.TrimSpace(cell)
+			if cell == "" {
+				continue
+			}
+
+			if textColumns[header[i]] {
+				object[header[i]], _ = json.Marshal(cell)
+			} else if json.Valid([]byte(cell)) {
+				object[header[i]] = json.RawMessage(cell)
+			} else {
+				entry.err = fmt.Errorf("column %s has an invalid value %q", header[i], cell)
+			}
+		}
+
+		if entry.err == nil {
+			encoded, _ := json.Marshal(object)
+			entry.err = json.Unmarshal(encoded, &entry.row)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func readBySKU[T any](collection string, skus []string) (map[string]T, error) {
+	query := `
+	FOR doc IN @@collection
+		FILTER doc.sku IN @skus
+		RETURN { sku: doc.sku, doc: doc }`
+	bindVars := map[string]interface{}{"@collection": collection, "skus": skus}
+
+	cursor, err := db.Query(context.TODO(), query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	docs := make(map[string]T)
+	for {
+		var result struct {
+			SKU string `json:"sku"`
+			Doc T      `json:"doc"`
+		}
+		_, err := cursor.ReadDocument(context.TODO(), &result)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		docs[result.SKU] = result.Doc
+	}
+	return docs, nil
+}
+
+// catalogWrite is an imported document together with the attributes the
+// import sets on it.
+type catalogWrite[T any] struct {
+	Doc    T        `json:"doc"`
+	Fields []string `json:"fields"`
+}
+
+// upsertBySKU keeps the key and creation time of documents that already
+// exist, so running the same import twice does not duplicate anything. A
+// stored document only gets the attributes the import sets, so what changed
+// since it was read, such as portions or images, is not written back.
+func upsertBySKU[T any](ctx context.Context, collection string, docs []catalogWrite[T]) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	query := `
+	FOR item IN @docs
+		UPSERT { sku: item.doc.sku }
+		INSERT item.doc
+		UPDATE KEEP(item.doc, item.fields)
+		IN @@collection`
+	bindVars := map[string]interface{}{"@collection": collection, "docs": docs}
+
+	cursor, err := db.Query(ctx, query, bindVars)
+	if err != nil {
+		return err
+	}
+	return cursor.Close()
+}
@@ -0,0 +1,519 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"main/database"
+	"main/export"
+	"main/model"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ingredientCollection    = database.OpenCollection(db, "ingredients")
+	stockMovementCollection = database.OpenCollection(db, "stockMovements")
+	stockAlertCollection    = database.OpenCollection(db, "stockAlerts")
+)
+
+func GetIngredients() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := "FOR ingredient IN ingredients SORT ingredient.name RETURN ingredient"
+		cursor, err := db.Query(exportContext(format), query, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.Ingredient](w, format, "ingredients", cursor)
+			return
+		}
+
+		ingredients := []model.Ingredient{}
+		for {
+			var ingredient model.Ingredient
+			_, err := cursor.ReadDocument(context.TODO(), &ingredient)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read ingredients"})
+				return
+			}
+
+			ingredients = append(ingredients, ingredient)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ingredients)
+	}
+}
+
+func GetIngredientByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ingredientID := chi.URLParam(r, "ingredient_id")
+		var ingredient model.Ingredient
+
+		meta, err := ingredientCollection.ReadDocument(context.TODO(), ingredientID, &ingredient)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch ingredient"})
+			return
+		}
+
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ingredient)
+	}
+}
+
+func CreateIngredient() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ingredient model.Ingredient
+		err := json.NewDecoder(r.Body).Decode(&ingredient)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(ingredient)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		if ingredient.SupplierID != nil {
+			var supplier model.Supplier
+			_, err = supplierCollection.ReadDocument(context.TODO(), *ingredient.SupplierID, &supplier)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "supplier was not found"})
+				return
+			}
+		}
+
+		ingredient.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		ingredient.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		ingredient.IngredientID = uuid.NewString()
+
+		meta, err := ingredientCollection.CreateDocument(context.TODO(), ingredient)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to create ingredient"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func UpdateIngredientByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ingredientID := chi.URLParam(r, "ingredient_id")
+		var ingredient model.Ingredient
+		err := json.NewDecoder(r.Body).Decode(&ingredient)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		if ingredient.Unit != nil || ingredient.StockOnHand != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "unit cannot be changed and stock is changed through adjustments"})
+			return
+		}
+
+		updateObject := make(map[string]interface{})
+
+		if ingredient.Name != nil {
+			updateObject["name"] = ingredient.Name
+		}
+		if ingredient.LowStockThreshold != nil {
+			updateObject["low_stock_threshold"] = ingredient.LowStockThreshold
+		}
+		if ingredient.ParLevel != nil {
+			updateObject["par_level"] = ingredient.ParLevel
+		}
+		if ingredient.CostPerUnit != nil {
+			updateObject["cost_per_unit"] = ingredient.CostPerUnit
+		}
+		if ingredient.SupplierID != nil {
+			var supplier model.Supplier
+			_, err = supplierCollection.ReadDocument(context.TODO(), *ingredient.SupplierID, &supplier)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "supplier was not found"})
+				return
+			}
+			updateObject["supplier_id"] = ingredient.SupplierID
+		}
+
+		ingredient.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObject["updated_at"] = ingredient.UpdatedAt
+
+		meta, err := ingredientCollection.UpdateDocument(revisionContext(r), ingredientID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update ingredient"})
+			return
+		}
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func DeleteIngredientByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ingredientID := chi.URLParam(r, "ingredient_id")
+
+		meta, err := ingredientCollection.RemoveDocument(revisionContext(r), ingredientID)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to delete ingredient"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func AdjustIngredientStock() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ingredientID := chi.URLParam(r, "ingredient_id")
+		var adjustment model.StockAdjustment
+		err := json.NewDecoder(r.Body).Decode(&adjustment)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(adjustment)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		exists, err := ingredientCollection.DocumentExists(context.TODO(), ingredientID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch ingredient"})
+			return
+		} else if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": "ingredient was not found"})
+			return
+		}
+
+		line := model.RecipeLine{IngredientID: ingredientID, Quantity: *adjustment.Quantity}
+		err = runTransaction(stockCollections(), func(ctx context.Context) error {
+			return moveStock(ctx, []model.RecipeLine{line}, 1, "ADJUSTMENT", "")
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to adjust stock"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ingredientID)
+	}
+}
+
+func GetStockAlerts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := `
+		FOR alert IN stockAlerts
+			FILTER alert.acknowledged == false
+			SORT alert.created_at DESC
+			RETURN alert`
+		cursor, err := db.Query(exportContext(format), query, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.StockAlert](w, format, "stock-alerts", cursor)
+			return
+		}
+
+		alerts := []model.StockAlert{}
+		for {
+			var alert model.StockAlert
+			_, err := cursor.ReadDocument(context.TODO(), &alert)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read stock alerts"})
+				return
+			}
+
+			alerts = append(alerts, alert)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(alerts)
+	}
+}
+
+func AcknowledgeStockAlert() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alertID := chi.URLParam(r, "alert_id")
+
+		updateObject := map[string]interface{}{"acknowledged": true}
+
+		meta, err := stockAlertCollection.UpdateDocument(context.TODO(), alertID, updateObject)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to acknowledge stock alert"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+type unitOfMeasure struct {
+	base   string
+	factor float64
+}
+
+var unitsOfMeasure = map[string]unitOfMeasure{
+	"g":   {"g", 1},
+	"kg":  {"g", 1000},
+	"ml":  {"ml", 1},
+	"l":   {"ml", 1000},
+	"pcs": {"pcs", 1},
+}
+
+func convertUnit(quantity float64, from, to string) (float64, error) {
+	source, ok := unitsOfMeasure[from]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	target, ok := unitsOfMeasure[to]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	if source.base != target.base {
+		return 0, fmt.Errorf("cannot convert %s to %s", from, to)
+	}
+	return quantity * source.factor / target.factor, nil
+}
+
+// prepareRecipe checks that every recipe line references an existing
+// ingredient and converts its quantity into the ingredient's own unit.
+func prepareRecipe(recipe []model.RecipeLine) error {
+	for i := range recipe {
+		line := &recipe[i]
+
+		var ingredient model.Ingredient
+		_, err := ingredientCollection.ReadDocument(context.TODO(), line.IngredientID, &ingredient)
+		if err != nil {
+			return fmt.Errorf("ingredient %s was not found", line.IngredientID)
+		}
+
+		if line.Unit == "" {
+			line.Unit = *ingredient.Unit
+		}
+		line.Quantity, err = convertUnit(line.Quantity, line.Unit, *ingredient.Unit)
+		if err != nil {
+			return err
+		}
+		line.Unit = *ingredient.Unit
+	}
+	return nil
+}
+
+// foodConsumption returns the ingredient quantities used by the given number
+// of portions of a food, following combo components to their own recipes.
+func foodConsumption(food model.Food, quantity float64) ([]model.RecipeLine, error) {
+	totals := make(map[string]float64)
+	order := []string{}
+
+	add := func(recipe []model.RecipeLine, portions float64) {
+		for _, line := range recipe {
+			if _, ok := totals[line.IngredientID]; !ok {
+				order = append(order, line.IngredientID)
+			}
+			totals[line.IngredientID] += line.Quantity * portions
+		}
+	}
+
+	add(food.Recipe, quantity)
+	for _, item := range food.ComboItems {
+		var component model.Food
+		_, err := foodCollection.ReadDocument(context.TODO(), item.FoodID, &component)
+		if err != nil {
+			return nil, err
+		}
+		add(component.Recipe, quantity*item.Quantity)
+	}
+
+	consumption := []model.RecipeLine{}
+	for _, ingredientID := range order {
+		consumption = append(consumption, model.RecipeLine{
+			IngredientID: ingredientID,
+			Quantity:     math.Round(totals[ingredientID]*1000) / 1000,
+		})
+	}
+	return consumption, nil
+}
+
+// moveStock applies the lines to the on-hand stock, records them in the stock
+// ledger and raises an alert for every ingredient that drops to or below its
+// low-stock threshold. A direction of -1 depletes and 1 restores. Lines of
+// ingredients that were deleted are skipped. It is meant to run in a
+// transaction over stockCollections, so that the ledger always matches the
+// stock.
+func moveStock(ctx context.Context, lines []model.RecipeLine, direction float64, reason, orderItemID string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	query := `
+	FOR line IN @lines
+		LET ingredient = DOCUMENT(ingredients, line.ingredient_id)
+		FILTER ingredient != null
+		UPDATE ingredient WITH {
+			stock_on_hand: ingredient.stock_on_hand + line.quantity * @direction,
+			updated_at: @now
+		} IN ingredients
+		RETURN { before: OLD, after: NEW }`
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	bindVars := map[string]interface{}{
+		"lines":     lines,
+		"direction": direction,
+		"now":       now,
+	}
+
+	cursor, err := db.Query(ctx, query, bindVars)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	movements := []model.StockMovement{}
+	alerts := []model.StockAlert{}
+	for {
+		var change struct {
+			Before model.Ingredient `json:"before"`
+			After  model.Ingredient `json:"after"`
+		}
+		_, err := cursor.ReadDocument(ctx, &change)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		movements = append(movements, model.StockMovement{
+			StockMovementID: uuid.NewString(),
+			IngredientID:    change.After.IngredientID,
+			Quantity:        *change.After.StockOnHand - *change.Before.StockOnHand,
+			Reason:          reason,
+			OrderItemID:     orderItemID,
+			CreatedAt:       now,
+		})
+
+		threshold := change.After.LowStockThreshold
+		if threshold != nil && *change.After.StockOnHand <= *threshold && *change.Before.StockOnHand > *threshold {
+			log.Printf("low stock: %s has %.3f %s left", *change.After.Name, *change.After.StockOnHand, *change.After.Unit)
+			alerts = append(alerts, model.StockAlert{
+				StockAlertID: uuid.NewString(),
+				IngredientID: change.After.IngredientID,
+				Name:         *change.After.Name,
+				StockOnHand:  *change.After.StockOnHand,
+				Threshold:    *threshold,
+				CreatedAt:    now,
+			})
+		}
+	}
+
+	_, errs, err := stockMovementCollection.CreateDocuments(ctx, movements)
+	if err != nil {
+		return err
+	} else if err := errs.FirstNonNil(); err != nil {
+		return err
+	}
+
+	if len(alerts) > 0 {
+		_, errs, err = stockAlertCollection.CreateDocuments(ctx, alerts)
+		if err != nil {
+			return err
+		} else if err := errs.FirstNonNil(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stockCollections are written by moveStock, along with more collections
+// that change in the same transaction.
+func stockCollections(more ...string) driver.TransactionCollections {
+	return driver.TransactionCollections{
+		Write: append([]string{ingredientCollection.Name(), stockMovementCollection.Name(), stockAlertCollection.Name()}, more...),
+	}
+}
+
+// runTransaction runs fn in a stream transaction and commits it unless fn
+// fails or panics.
+func runTransaction(collections driver.TransactionCollections, fn func(ctx context.Context) error) error {
+	transactionID, err := db.BeginTransaction(context.TODO(), collections, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		// a panic would otherwise leave the transaction holding its locks
+		// until the server times it out
+		if !committed {
+			db.AbortTransaction(context.TODO(), transactionID, nil)
+		}
+	}()
+
+	err = fn(driver.WithTransactionID(context.TODO(), transactionID))
+	if err != nil {
+		return err
+	}
+	err = db.CommitTransaction(context.TODO(), transactionID, nil)
+	committed = err == nil
+	return err
+}
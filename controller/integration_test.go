@@ -0,0 +1,147 @@
+//go:build integration
+
+// The integration tests run the handlers against the ArangoDB the server
+// uses, at localhost:8529:
+//
+//	go test -tags integration ./controller
+package controller_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"main/database"
+	"main/model"
+	"main/routes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	server *httptest.Server
+	db     driver.Database
+)
+
+func TestMain(m *testing.M) {
+	router := chi.NewRouter()
+	routes.Use(router)
+	server = httptest.NewServer(router)
+	db = database.DBinstance()
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// send makes a request and decodes the JSON response into out, if given.
+func send(t *testing.T, method, path, contentType string, body io.Reader, out interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s answered with invalid json: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// call sends body as JSON.
+func call(t *testing.T, method, path string, body, out interface{}) int {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	return send(t, method, path, "application/json", reader, out)
+}
+
+// create posts body and returns the key of the created document.
+func create(t *testing.T, path string, body interface{}) string {
+	t.Helper()
+	var key string
+	if code := call(t, http.MethodPost, path, body, &key); code != http.StatusOK {
+		t.Fatalf("POST %s answered %d", path, code)
+	}
+	return key
+}
+
+// read fetches a document straight from the database.
+func read(t *testing.T, collection, key string, out interface{}) {
+	t.Helper()
+	col, err := db.Collection(context.Background(), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := col.ReadDocument(context.Background(), key, out); err != nil {
+		t.Fatalf("failed to read %s/%s: %v", collection, key, err)
+	}
+}
+
+// exists reports whether the database holds the document.
+func exists(t *testing.T, collection, key string) bool {
+	t.Helper()
+	col, err := db.Collection(context.Background(), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := col.DocumentExists(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+// createFood creates a table and a food on a new menu and returns their keys.
+func createFood(t *testing.T, price float64) (tableID, foodID string) {
+	t.Helper()
+	tableID = create(t, "/tables", map[string]interface{}{"number_of_guest": 4, "table_number": 99})
+	menuID := create(t, "/menus", map[string]interface{}{"name": "Test menu", "category": "Test"})
+	foodID = create(t, "/foods", map[string]interface{}{
+		"name":       "Test food",
+		"unit_price": price,
+		"menu_id":    menuID,
+	})
+	return tableID, foodID
+}
+
+// orderFood orders one of the food and returns the keys of the order and
+// its item.
+func orderFood(t *testing.T, tableID, foodID string) (orderID, orderItemID string) {
+	t.Helper()
+	pack := map[string]interface{}{
+		"table_id":    tableID,
+		"order_items": []map[string]interface{}{{"food_id": foodID, "quantity": 1}},
+	}
+	var created struct {
+		OrderItemIDs []string `json:"order_item_ids"`
+	}
+	if code := call(t, http.MethodPost, "/orderItems", pack, &created); code != http.StatusOK {
+		t.Fatalf("POST /orderItems answered %d", code)
+	}
+
+	var orderItem model.OrderItem
+	read(t, "orderItems", created.OrderItemIDs[0], &orderItem)
+	return orderItem.OrderID, orderItem.OrderItemID
+}
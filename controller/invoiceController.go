@@ -3,8 +3,11 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"main/database"
+	"main/export"
 	"main/model"
+	"math"
 	"net/http"
 	"time"
 
@@ -17,8 +20,10 @@ var invoiceCollection = database.OpenCollection(db, "invoices")
 
 func GetInvoices() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		query := "FOR invoice IN invoices LIMIT 10 RETURN invoice"
-		cursor, err := db.Query(context.TODO(), query, nil)
+		format := export.Negotiate(r)
+		query := "FOR invoice IN invoices LIMIT @limit RETURN invoice"
+		bindVars := map[string]interface{}{"limit": listLimit(format)}
+		cursor, err := db.Query(exportContext(format), query, bindVars)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
@@ -26,6 +31,11 @@ func GetInvoices() http.HandlerFunc {
 		}
 		defer cursor.Close()
 
+		if format != "" {
+			exportCursor[model.Invoice](w, format, "invoices", cursor)
+			return
+		}
+
 		invoices := []model.Invoice{}
 		for {
 			var invoice model.Invoice
@@ -52,13 +62,25 @@ func GetInvoiceByID() http.HandlerFunc {
 		invoiceID := chi.URLParam(r, "invoice_id")
 		var invoice model.Invoice
 
-		_, err := invoiceCollection.ReadDocument(context.TODO(), invoiceID, &invoice)
+		meta, err := invoiceCollection.ReadDocument(context.TODO(), invoiceID, &invoice)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to fetch invoice item"})
 			return
 		}
 
+		// the view shows the order and its items as well, so a change to any
+		// of them changes the ETag
+		revs, err := orderRevisions(invoice.OrderID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch invoice item"})
+			return
+		}
+		if writeETag(w, r, derivedETag(meta.Rev, revs)) {
+			return
+		}
+
 		var invoiceView model.InvoiceViewFormat
 
 		allOrderItems, err := ItemsByOrder(invoice.OrderID)
@@ -70,22 +92,50 @@ func GetInvoiceByID() http.HandlerFunc {
 		invoiceView.OrderID = invoice.OrderID
 		invoiceView.PaymentDueDate = invoice.PaymentDueDate
 
-		invoiceView.PaymentMethod = "null"
-		if invoice.PaymentMethod != nil {
-			invoiceView.PaymentMethod = *invoice.PaymentMethod
-		}
-
+		invoiceView.PaymentMethod = invoice.PaymentMethod
 		invoiceView.InvoiceID = invoice.InvoiceID
+		invoiceView.InvoiceNumber = invoice.InvoiceNumber
+		invoiceView.CreditedTotal = invoice.CreditedTotal
+		invoiceView.Replaces = invoice.Replaces
+		invoiceView.ReplacedBy = invoice.ReplacedBy
+		invoiceView.AccountID = invoice.AccountID
+		invoiceView.CustomerID = invoice.CustomerID
 		invoiceView.PaymentStatus = invoice.PaymentStatus
+		invoiceView.SettledAt = invoice.SettledAt
+		invoiceView.TipAmount = invoice.TipAmount
+		invoiceView.GiftCards = invoice.GiftCards
 		invoiceView.PaymentDue = allOrderItems[0].PaymentDue
 		invoiceView.TableNumber = allOrderItems[0].TableNumber
 		invoiceView.OrderDetails = allOrderItems[0].OrderItems
 
+		// issued invoices show what was billed even if the order changes later
+		if invoiceIsLocked(invoice) {
+			invoiceView.PaymentDue = invoice.Subtotal
+			invoiceView.OrderDetails = invoice.Lines
+		}
+
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(invoiceView)
 	}
 }
 
+// orderRevisions lists the revisions of an order and its items.
+func orderRevisions(orderID string) ([]string, error) {
+	query := `RETURN APPEND(
+		(FOR order IN orders FILTER order._key == @order_id RETURN order._rev),
+		(FOR orderItem IN orderItems FILTER orderItem.order_id == @order_id SORT orderItem._key RETURN orderItem._rev)
+	)`
+	cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"order_id": orderID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var revs []string
+	_, err = cursor.ReadDocument(context.TODO(), &revs)
+	return revs, err
+}
+
 func CreateInvoice() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var invoice model.Invoice
@@ -108,9 +158,18 @@ func CreateInvoice() http.HandlerFunc {
 		if invoice.PaymentStatus == nil {
 			invoice.PaymentStatus = &paymentStatus
 		}
+		if invoice.Location == "" {
+			invoice.Location = defaultLocation
+		}
 
 		invoice.PaymentDueDate, _ = time.Parse(time.RFC3339, time.Now().AddDate(0, 0, 1).Format(time.RFC3339))
 
+		// the snapshot and links are only ever written by the server
+		invoice.Lines, invoice.Taxes, invoice.Discounts, invoice.GiftCards = nil, nil, nil, nil
+		invoice.Subtotal, invoice.Total, invoice.CreditedTotal = 0, 0, 0
+		invoice.Replaces, invoice.ReplacedBy, invoice.PaidAt, invoice.SettledAt = nil, nil, nil, nil
+		invoice.RemindersSent, invoice.LastReminderAt = 0, nil
+
 		invoice.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		invoice.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		invoice.InvoiceID = uuid.NewString()
@@ -122,7 +181,42 @@ func CreateInvoice() http.HandlerFunc {
 			return
 		}
 
-		meta, err := invoiceCollection.CreateDocument(context.TODO(), invoice)
+		err = applyAccount(&invoice)
+		if err != nil {
+			accountFailed(w, err)
+			return
+		}
+
+		// the guest of the order unless the invoice names someone else
+		if invoice.CustomerID == nil {
+			invoice.CustomerID = order.CustomerID
+		}
+		if customerFailed(w, checkCustomer(invoice.CustomerID)) {
+			return
+		}
+
+		// numbers are only taken when the invoice is paid or charged to an
+		// account, so such an invoice is created and finalized in one
+		// transaction
+		pay := *invoice.PaymentStatus == "PAID"
+		if pay && invoice.PaymentMethod == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "a payment method is required to pay an invoice"})
+			return
+		}
+		if pay && *invoice.PaymentMethod == "GIFT_CARD" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "redeem gift cards on the invoice before paying it"})
+			return
+		}
+		invoice.InvoiceNumber = nil
+
+		if pay || chargedToAccount(invoice) {
+			invoice, err = finalizeInvoice(invoice, true)
+		} else {
+			invoice.PaymentStatus = &paymentStatus
+			_, err = invoiceCollection.CreateDocument(context.TODO(), invoice)
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to create invoice item"})
@@ -130,7 +224,7 @@ func CreateInvoice() http.HandlerFunc {
 		}
 
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(meta.Key)
+		json.NewEncoder(w).Encode(invoice.InvoiceID)
 	}
 }
 
@@ -145,41 +239,193 @@ func UpdateInvoiceByID() http.HandlerFunc {
 			return
 		}
 
+		var storedInvoice model.Invoice
+		meta, err := invoiceCollection.ReadDocument(revisionContext(r), invoiceID, &storedInvoice)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch invoice item"})
+			return
+		}
+		if invoiceIsLocked(storedInvoice) {
+			settleInvoice(w, invoice, storedInvoice, meta.Rev)
+			return
+		}
+
 		updateObject := make(map[string]interface{})
 
 		if invoice.PaymentMethod != nil {
+			err = validate.Var(*invoice.PaymentMethod, "eq=CARD|eq=CASH|eq=ACCOUNT|eq=GIFT_CARD|eq=")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "invalid payment method"})
+				return
+			}
 			updateObject["payment_method"] = invoice.PaymentMethod
+			storedInvoice.PaymentMethod = invoice.PaymentMethod
 		}
-		if invoice.PaymentStatus != nil {
-			updateObject["payment_status"] = invoice.PaymentStatus
+		if invoice.TipAmount != nil {
+			err = validate.Var(*invoice.TipAmount, "gte=0")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "tip amount cannot be negative"})
+				return
+			}
+			tip := math.Round(*invoice.TipAmount*100) / 100
+			updateObject["tip_amount"] = tip
+			storedInvoice.TipAmount = &tip
+		}
+		if invoice.CustomerID != nil {
+			if *invoice.CustomerID == "" {
+				invoice.CustomerID = nil
+			} else if customerFailed(w, checkCustomer(invoice.CustomerID)) {
+				return
+			}
+			if len(invoiceRedemptions(storedInvoice)) > 0 {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(status{"error": "remove the redeemed rewards before changing the customer"})
+				return
+			}
+			updateObject["customer_id"] = invoice.CustomerID
+			storedInvoice.CustomerID = invoice.CustomerID
+		}
+		if invoice.AccountID != nil {
+			storedInvoice.AccountID = invoice.AccountID
+		}
+		if invoice.AccountID != nil || invoice.PaymentMethod != nil {
+			// the account decides the due date, and a charge to account needs one
+			err = applyAccount(&storedInvoice)
+			if err != nil {
+				accountFailed(w, err)
+				return
+			}
+			updateObject["account_id"] = storedInvoice.AccountID
+			updateObject["payment_method"] = storedInvoice.PaymentMethod
+			updateObject["payment_due_date"] = storedInvoice.PaymentDueDate
+			if storedInvoice.PaymentDueDate.After(time.Now()) {
+				updateObject["payment_status"] = "PENDING"
+			}
 		}
 
-		paymentStatus := "PENDING"
-		if invoice.PaymentStatus == nil {
-			invoice.PaymentStatus = &paymentStatus
+		// charging the invoice to an account issues it just as paying does
+		pay := invoice.PaymentStatus != nil && *invoice.PaymentStatus == "PAID"
+		if pay || chargedToAccount(storedInvoice) {
+			if storedInvoice.PaymentMethod == nil || *storedInvoice.PaymentMethod == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "a payment method is required to pay an invoice"})
+				return
+			}
+
+			storedInvoice, err = finalizeInvoice(storedInvoice, false)
+			if errors.Is(err, errInvoiceLocked) || errors.Is(err, errGiftCardShort) || errors.Is(err, errGiftCardsExceed) {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(status{"error": err.Error()})
+				return
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to pay invoice"})
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(storedInvoice.InvoiceID)
+			return
+		} else if invoice.PaymentStatus != nil {
+			if *invoice.PaymentStatus != "PENDING" && *invoice.PaymentStatus != "OVERDUE" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "payment status must be PENDING, OVERDUE or PAID"})
+				return
+			}
+			updateObject["payment_status"] = *invoice.PaymentStatus
 		}
 
 		invoice.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObject["updated_at"] = invoice.UpdatedAt
 
-		meta, err := invoiceCollection.UpdateDocument(context.TODO(), invoiceID, updateObject)
-		if err != nil {
+		meta, err = invoiceCollection.UpdateDocument(driver.WithRevision(context.TODO(), meta.Rev), invoiceID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to update invoice item"})
 			return
 		}
 
+		setETag(w, meta.Rev)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(meta.Key)
 	}
 }
 
+// settleInvoice records that the account paid an invoice charged to it, the
+// only change an issued invoice takes.
+func settleInvoice(w http.ResponseWriter, invoice, storedInvoice model.Invoice, rev string) {
+	settles := invoice.PaymentStatus != nil && *invoice.PaymentStatus == "PAID"
+	changes := invoice.PaymentMethod != nil || invoice.TipAmount != nil || invoice.CustomerID != nil || invoice.AccountID != nil
+	if !settles || changes || storedInvoice.SettledAt != nil || !chargedToAccount(storedInvoice) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status{"error": errInvoiceLocked.Error()})
+		return
+	}
+
+	settledAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObject := map[string]interface{}{
+		"payment_status": "PAID",
+		"settled_at":     settledAt,
+		"updated_at":     settledAt,
+	}
+	meta, err := invoiceCollection.UpdateDocument(driver.WithRevision(context.TODO(), rev), storedInvoice.InvoiceID, updateObject)
+	if revisionConflict(w, err) {
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(status{"error": "failed to settle invoice"})
+		return
+	}
+
+	setETag(w, meta.Rev)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(meta.Key)
+}
+
 func DeleteInvoiceByID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		invoiceID := chi.URLParam(r, "invoice_id")
 
-		meta, err := invoiceCollection.RemoveDocument(context.TODO(), invoiceID)
-		if err != nil {
+		var invoice model.Invoice
+		meta, err := invoiceCollection.ReadDocument(revisionContext(r), invoiceID, &invoice)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch invoice item"})
+			return
+		}
+		if invoiceIsLocked(invoice) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": errInvoiceLocked.Error()})
+			return
+		}
+
+		// the revision guards against the invoice being paid in between, and
+		// points redeemed on it go back to the customer and gift card payments
+		// back on their cards
+		collections := loyaltyCollections(invoiceCollection.Name(), giftCardCollection.Name(), giftCardTransactionCollection.Name())
+		err = runTransaction(collections, func(ctx context.Context) error {
+			_, err := invoiceCollection.RemoveDocument(driver.WithRevision(ctx, meta.Rev), invoiceID)
+			if err != nil {
+				return err
+			}
+			err = refundGiftCardPayments(ctx, invoiceID, invoice.GiftCards, "invoice deleted")
+			if err != nil {
+				return err
+			}
+			return releaseRedemptions(ctx, invoiceRedemptions(invoice), "invoice deleted")
+		})
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to delete invoice item"})
 			return
@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"main/model"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"golang.org/x/text/language"
+)
+
+const localizationSettingsKey = "localization"
+
+// Every localized read needs the settings, so they are kept in memory.
+// Updates through this instance drop them at once; the expiry bounds how
+// long other instances serve the old ones.
+const localizationSettingsTTL = time.Minute
+
+var localizationCache struct {
+	mu       sync.Mutex
+	settings *model.LocalizationSettings
+	read     time.Time
+}
+
+func GetLocalizationSettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings, err := readLocalizationSettings()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch localization settings"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+func UpdateLocalizationSettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var settings model.LocalizationSettings
+		err := json.NewDecoder(r.Body).Decode(&settings)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		settings.DefaultLocale = strings.ToLower(settings.DefaultLocale)
+		settings.Locales = normalizeTags(settings.Locales)
+		if settings.Locales == nil {
+			settings.Locales = []string{}
+		}
+		if !contains(settings.Locales, settings.DefaultLocale) {
+			settings.Locales = append([]string{settings.DefaultLocale}, settings.Locales...)
+		}
+
+		err = validate.Struct(settings)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+		for _, locale := range settings.Locales {
+			if _, err := language.Parse(locale); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "unknown locale " + locale})
+				return
+			}
+		}
+
+		document := struct {
+			Key string `json:"_key"`
+			model.LocalizationSettings
+		}{localizationSettingsKey, settings}
+
+		exists, err := settingsCollection.DocumentExists(context.TODO(), localizationSettingsKey)
+		if err == nil && exists {
+			_, err = settingsCollection.ReplaceDocument(context.TODO(), localizationSettingsKey, document)
+		} else if err == nil {
+			_, err = settingsCollection.CreateDocument(context.TODO(), document)
+		}
+		forgetLocalizationSettings()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update localization settings"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// readLocalizationSettings returns the stored localization settings, or
+// English with Spanish and German when none were saved yet.
+func readLocalizationSettings() (model.LocalizationSettings, error) {
+	settings := model.LocalizationSettings{DefaultLocale: "en", Locales: []string{"en", "es", "de"}}
+	_, err := settingsCollection.ReadDocument(context.TODO(), localizationSettingsKey, &settings)
+	if driver.IsNotFound(err) {
+		return settings, nil
+	}
+	return settings, err
+}
+
+// cachedLocalizationSettings returns the settings kept in memory and reads
+// them again once they expired.
+func cachedLocalizationSettings() (model.LocalizationSettings, error) {
+	localizationCache.mu.Lock()
+	defer localizationCache.mu.Unlock()
+
+	if localizationCache.settings != nil && time.Since(localizationCache.read) < localizationSettingsTTL {
+		return *localizationCache.settings, nil
+	}
+	settings, err := readLocalizationSettings()
+	if err != nil {
+		return settings, err
+	}
+	localizationCache.settings = &settings
+	localizationCache.read = time.Now()
+	return settings, nil
+}
+
+func forgetLocalizationSettings() {
+	localizationCache.mu.Lock()
+	defer localizationCache.mu.Unlock()
+
+	localizationCache.settings = nil
+}
+
+// requestLocale picks the locale asked for with ?lang= or Accept-Language
+// among the configured ones, falling back to the default locale. It returns
+// the locale and the default locale.
+func requestLocale(r *http.Request) (string, string) {
+	settings, err := cachedLocalizationSettings()
+	if err != nil {
+		log.Println("failed to fetch localization settings:", err)
+	}
+
+	locales := []string{settings.DefaultLocale}
+	supported := []language.Tag{language.Make(settings.DefaultLocale)}
+	for _, locale := range settings.Locales {
+		if locale != settings.DefaultLocale {
+			locales = append(locales, locale)
+			supported = append(supported, language.Make(locale))
+		}
+	}
+
+	var desired []language.Tag
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		desired = []language.Tag{language.Make(lang)}
+	} else {
+		desired, _, _ = language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
+
+	_, index, confidence := language.NewMatcher(supported).Match(desired...)
+	if confidence == language.No {
+		index = 0
+	}
+	return locales[index], settings.DefaultLocale
+}
+
+// checkTranslations validates the texts of every language, which the
+// validator does not do for structs inside maps.
+func checkTranslations(translations model.Translations) error {
+	for _, translated := range translations {
+		err := validate.Struct(translated)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setContentLanguage(w http.ResponseWriter, locale string) {
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+}
+
+// translation returns the texts for locale, taking any field it lacks from
+// the default locale. Fields left empty keep the untranslated text.
+func translation(translations model.Translations, locale, defaultLocale string) model.Translation {
+	translated := translations[locale]
+	fallback := translations[defaultLocale]
+	if translated.Name == "" {
+		translated.Name = fallback.Name
+	}
+	if translated.Category == "" {
+		translated.Category = fallback.Category
+	}
+	if translated.Description == "" {
+		translated.Description = fallback.Description
+	}
+	return translated
+}
+
+func localizeFood(food *model.Food, locale, defaultLocale string) {
+	translated := translation(food.Translations, locale, defaultLocale)
+	if translated.Name != "" {
+		food.Name = &translated.Name
+	}
+	if translated.Description != "" {
+		food.Description = &translated.Description
+	}
+}
+
+func localizeMenu(menu *model.Menu, locale, defaultLocale string) {
+	translated := translation(menu.Translations, locale, defaultLocale)
+	if translated.Name != "" {
+		menu.Name = translated.Name
+	}
+	if translated.Category != "" {
+		menu.Category = translated.Category
+	}
+	if translated.Description != "" {
+		menu.Description = translated.Description
+	}
+}
+
+// localizeReceipt prints the receipt labels and the food names in locale.
+// Modifiers keep the names they were ordered with.
+func localizeReceipt(data *model.Receipt, locale, defaultLocale string) error {
+	data.Locale = locale
+
+	foods := map[string]model.Food{}
+	for i, item := range data.Items {
+		if item.FoodID == "" {
+			continue
+		}
+		food, ok := foods[item.FoodID]
+		if !ok {
+			_, err := foodCollection.ReadDocument(context.TODO(), item.FoodID, &food)
+			if err != nil && !driver.IsNotFound(err) {
+				return err
+			}
+			foods[item.FoodID] = food
+		}
+		if translated := translation(food.Translations, locale, defaultLocale); translated.Name != "" {
+			data.Items[i].Name = translated.Name
+		}
+	}
+	return nil
+}
@@ -0,0 +1,810 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"main/database"
+	"main/fiscal"
+	"main/model"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var loyaltyTransactionCollection = database.OpenCollection(db, "loyaltyTransactions")
+
+const (
+	loyaltySettingsKey    = "loyalty"
+	loyaltyExpiryInterval = time.Hour
+	expiringSoonDays      = 30
+)
+
+var (
+	errLoyaltyDisabled    = errors.New("the loyalty program is not enabled")
+	errUnknownReward      = errors.New("unknown reward")
+	errNoLoyaltyCustomer  = errors.New("the invoice has no customer to redeem points for")
+	errNotEnoughPoints    = errors.New("the customer does not have enough points")
+	errRedemptionNotFound = errors.New("redemption was not found on the invoice")
+	errInvoiceNotFound    = errors.New("invoice was not found")
+)
+
+func init() {
+	database.EnsurePersistentIndex(loyaltyTransactionCollection, "customer_id")
+	database.EnsurePersistentIndex(loyaltyTransactionCollection, "invoice_id")
+}
+
+func GetLoyaltySettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings, err := readLoyaltySettings()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch loyalty settings"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// UpdateLoyaltySettings replaces the loyalty program and moves customers to
+// the tier their lifetime points reach under the new tiers.
+func UpdateLoyaltySettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var settings model.LoyaltySettings
+		err := json.NewDecoder(r.Body).Decode(&settings)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(settings)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+		if _, err := time.LoadLocation(settings.Timezone); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "unknown timezone"})
+			return
+		}
+
+		document := struct {
+			Key string `json:"_key"`
+			model.LoyaltySettings
+		}{loyaltySettingsKey, settings}
+
+		exists, err := settingsCollection.DocumentExists(context.TODO(), loyaltySettingsKey)
+		if err == nil && exists {
+			_, err = settingsCollection.ReplaceDocument(context.TODO(), loyaltySettingsKey, document)
+		} else if err == nil {
+			_, err = settingsCollection.CreateDocument(context.TODO(), document)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update loyalty settings"})
+			return
+		}
+
+		query := `
+		FOR customer IN customers
+			LET tier = NOT_NULL(FIRST(
+				FOR tier IN @tiers
+					FILTER NOT_NULL(customer.lifetime_points, 0) >= tier.min_points
+					SORT tier.min_points DESC
+					LIMIT 1
+					RETURN tier.name
+			), "")
+			FILTER NOT_NULL(customer.loyalty_tier, "") != tier
+			UPDATE customer WITH { loyalty_tier: tier } IN customers`
+		tiers := settings.Tiers
+		if tiers == nil {
+			tiers = []model.LoyaltyTier{}
+		}
+		cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"tiers": tiers})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "settings were saved but customer tiers could not be updated"})
+			return
+		}
+		cursor.Close()
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// GetCustomerLoyalty returns the points balance of a customer, how far they
+// are from the next tier, how many points expire soon and the latest ledger
+// entries.
+func GetCustomerLoyalty() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID := chi.URLParam(r, "customer_id")
+
+		var customer model.Customer
+		_, err := customerCollection.ReadDocument(context.TODO(), customerID, &customer)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": errCustomerNotFound.Error()})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch customer"})
+			return
+		}
+
+		settings, err := readLoyaltySettings()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch loyalty settings"})
+			return
+		}
+
+		query := `
+		RETURN {
+			expiring_soon: SUM(
+				FOR entry IN loyaltyTransactions
+					FILTER entry.customer_id == @customer_id AND entry.remaining > 0
+					FILTER entry.expires_at != null AND DATE_TIMESTAMP(entry.expires_at) < @soon
+					RETURN entry.remaining
+			),
+			transactions: (
+				FOR entry IN loyaltyTransactions
+					FILTER entry.customer_id == @customer_id
+					SORT entry.created_at DESC
+					LIMIT 50
+					RETURN entry
+			)
+		}`
+		bindVars := map[string]interface{}{
+			"customer_id": customerID,
+			"soon":        time.Now().AddDate(0, 0, expiringSoonDays).UnixMilli(),
+		}
+		cursor, err := db.Query(context.TODO(), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		account := model.LoyaltyAccount{
+			CustomerID:     customer.CustomerID,
+			Points:         customer.LoyaltyPoints,
+			LifetimePoints: customer.LifetimePoints,
+			Tier:           customer.LoyaltyTier,
+		}
+		ledger := struct {
+			ExpiringSoon int                        `json:"expiring_soon"`
+			Transactions []model.LoyaltyTransaction `json:"transactions"`
+		}{}
+		_, err = cursor.ReadDocument(context.TODO(), &ledger)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to read loyalty transactions"})
+			return
+		}
+		account.ExpiringSoon = ledger.ExpiringSoon
+		account.Transactions = ledger.Transactions
+		if next := nextLoyaltyTier(settings, customer.LifetimePoints); next != nil {
+			account.NextTier = &next.Name
+			account.PointsToNextTier = next.MinPoints - customer.LifetimePoints
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(account)
+	}
+}
+
+// AdjustLoyaltyPoints books a manual correction. Adjustments change the
+// balance but not the lifetime points, so they never change the tier.
+func AdjustLoyaltyPoints() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		customerID := chi.URLParam(r, "customer_id")
+		var adjustment model.LoyaltyAdjustment
+		err := json.NewDecoder(r.Body).Decode(&adjustment)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(adjustment)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		settings, err := readLoyaltySettings()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch loyalty settings"})
+			return
+		}
+
+		entry := model.LoyaltyTransaction{
+			CustomerID:  customerID,
+			Type:        "ADJUST",
+			Points:      adjustment.Points,
+			Description: adjustment.Reason,
+		}
+		err = runTransaction(loyaltyCollections(), func(ctx context.Context) error {
+			return addPoints(ctx, settings, &entry, 0)
+		})
+		if loyaltyFailed(w, err) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(entry.TransactionID)
+	}
+}
+
+// RedeemLoyaltyReward spends the customer's points on a reward, which comes
+// off the unpaid invoice as a discount.
+func RedeemLoyaltyReward() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID := chi.URLParam(r, "invoice_id")
+		var redemption model.LoyaltyRedemption
+		err := json.NewDecoder(r.Body).Decode(&redemption)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(redemption)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		settings, err := readLoyaltySettings()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch loyalty settings"})
+			return
+		}
+		if !settings.Enabled {
+			loyaltyFailed(w, errLoyaltyDisabled)
+			return
+		}
+		var reward *model.LoyaltyReward
+		for i := range settings.Rewards {
+			if settings.Rewards[i].Code == redemption.RewardCode {
+				reward = &settings.Rewards[i]
+				break
+			}
+		}
+		if reward == nil {
+			loyaltyFailed(w, errUnknownReward)
+			return
+		}
+
+		var discount model.InvoiceDiscount
+		err = runTransaction(loyaltyCollections(invoiceCollection.Name()), func(ctx context.Context) error {
+			var invoice model.Invoice
+			_, err := invoiceCollection.ReadDocument(ctx, invoiceID, &invoice)
+			if driver.IsNotFound(err) {
+				return errInvoiceNotFound
+			} else if err != nil {
+				return err
+			}
+			if invoiceIsLocked(invoice) {
+				return errInvoiceLocked
+			}
+			if invoice.CustomerID == nil {
+				return errNoLoyaltyCustomer
+			}
+
+			entry := model.LoyaltyTransaction{
+				CustomerID:  *invoice.CustomerID,
+				Type:        "REDEEM",
+				Points:      -reward.Points,
+				InvoiceID:   &invoice.InvoiceID,
+				RewardCode:  &reward.Code,
+				Description: reward.Name,
+			}
+			err = addPoints(ctx, settings, &entry, 0)
+			if err != nil {
+				return err
+			}
+
+			discount = model.InvoiceDiscount{
+				DiscountID: uuid.NewString(),
+				Label:      reward.Name,
+				Amount:     roundMoney(reward.Discount),
+				Source:     "LOYALTY",
+				Reference:  entry.TransactionID,
+			}
+			updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			_, err = invoiceCollection.UpdateDocument(ctx, invoiceID, map[string]interface{}{
+				"discounts":  append(invoice.Discounts, discount),
+				"updated_at": updatedAt,
+			})
+			return err
+		})
+		if loyaltyFailed(w, err) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(discount)
+	}
+}
+
+// RemoveLoyaltyReward takes a reward off an unpaid invoice and gives the
+// points back.
+func RemoveLoyaltyReward() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID := chi.URLParam(r, "invoice_id")
+		discountID := chi.URLParam(r, "discount_id")
+
+		err := runTransaction(loyaltyCollections(invoiceCollection.Name()), func(ctx context.Context) error {
+			var invoice model.Invoice
+			_, err := invoiceCollection.ReadDocument(ctx, invoiceID, &invoice)
+			if driver.IsNotFound(err) {
+				return errInvoiceNotFound
+			} else if err != nil {
+				return err
+			}
+			if invoiceIsLocked(invoice) {
+				return errInvoiceLocked
+			}
+
+			var removed *model.InvoiceDiscount
+			discounts := []model.InvoiceDiscount{}
+			for i, discount := range invoice.Discounts {
+				if discount.DiscountID == discountID && discount.Source == "LOYALTY" {
+					removed = &invoice.Discounts[i]
+					continue
+				}
+				discounts = append(discounts, discount)
+			}
+			if removed == nil {
+				return errRedemptionNotFound
+			}
+
+			err = releaseRedemptions(ctx, []model.InvoiceDiscount{*removed}, "reward removed from invoice")
+			if err != nil {
+				return err
+			}
+
+			updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			_, err = invoiceCollection.UpdateDocument(ctx, invoiceID, map[string]interface{}{
+				"discounts":  discounts,
+				"updated_at": updatedAt,
+			})
+			return err
+		})
+		if loyaltyFailed(w, err) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(discountID)
+	}
+}
+
+// StartLoyalty expires unspent points once their expiry date passes.
+func StartLoyalty() {
+	go func() {
+		ticker := time.NewTicker(loyaltyExpiryInterval)
+		defer ticker.Stop()
+		for {
+			expirePoints()
+			<-ticker.C
+		}
+	}()
+}
+
+func expirePoints() {
+	query := `
+	FOR entry IN loyaltyTransactions
+		FILTER entry.remaining > 0 AND entry.expires_at != null
+		FILTER DATE_TIMESTAMP(entry.expires_at) < @now
+		RETURN entry._key`
+	cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"now": time.Now().UnixMilli()})
+	if err != nil {
+		log.Println("failed to find expired loyalty points:", err)
+		return
+	}
+	defer cursor.Close()
+
+	settings, err := readLoyaltySettings()
+	if err != nil {
+		log.Println("failed to fetch loyalty settings:", err)
+		return
+	}
+
+	for {
+		var transactionID string
+		_, err := cursor.ReadDocument(context.TODO(), &transactionID)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			log.Println("failed to read loyalty transaction:", err)
+			return
+		}
+
+		err = runTransaction(loyaltyCollections(), func(ctx context.Context) error {
+			// the points may have been spent since the query ran
+			var entry model.LoyaltyTransaction
+			_, err := loyaltyTransactionCollection.ReadDocument(ctx, transactionID, &entry)
+			if err != nil || entry.Remaining == 0 {
+				return err
+			}
+			_, err = loyaltyTransactionCollection.UpdateDocument(ctx, transactionID, map[string]interface{}{"remaining": 0})
+			if err != nil || entry.CustomerID == "" {
+				return err
+			}
+
+			expired := model.LoyaltyTransaction{
+				CustomerID:  entry.CustomerID,
+				Type:        "EXPIRE",
+				Points:      -entry.Remaining,
+				Description: "points expired",
+			}
+			return addPoints(ctx, settings, &expired, 0)
+		})
+		if err != nil {
+			log.Printf("failed to expire loyalty transaction %s: %v", transactionID, err)
+		}
+	}
+}
+
+// readLoyaltySettings returns the stored loyalty program, or a disabled one
+// when none was saved yet.
+func readLoyaltySettings() (model.LoyaltySettings, error) {
+	settings := model.LoyaltySettings{}
+	_, err := settingsCollection.ReadDocument(context.TODO(), loyaltySettingsKey, &settings)
+	if driver.IsNotFound(err) {
+		return settings, nil
+	}
+	return settings, err
+}
+
+func loyaltyCollections(more ...string) driver.TransactionCollections {
+	return driver.TransactionCollections{
+		Write: append([]string{customerCollection.Name(), loyaltyTransactionCollection.Name()}, more...),
+	}
+}
+
+// loyaltyTier is the highest tier reached with the lifetime points, if any.
+func loyaltyTier(settings model.LoyaltySettings, lifetimePoints int) *model.LoyaltyTier {
+	var reached *model.LoyaltyTier
+	for i, tier := range settings.Tiers {
+		if lifetimePoints >= tier.MinPoints && (reached == nil || tier.MinPoints > reached.MinPoints) {
+			reached = &settings.Tiers[i]
+		}
+	}
+	return reached
+}
+
+func nextLoyaltyTier(settings model.LoyaltySettings, lifetimePoints int) *model.LoyaltyTier {
+	var next *model.LoyaltyTier
+	for i, tier := range settings.Tiers {
+		if lifetimePoints < tier.MinPoints && (next == nil || tier.MinPoints < next.MinPoints) {
+			next = &settings.Tiers[i]
+		}
+	}
+	return next
+}
+
+// invoicePoints is what a paid invoice earns: its subtotal after discounts
+// times points_per_unit plus the bonus of every bonus item, multiplied by
+// the multiplier of the day it was paid and of the customer's tier.
+func invoicePoints(settings model.LoyaltySettings, invoice model.Invoice, lifetimePoints int) int {
+	points := (invoice.Subtotal - fiscal.DiscountTotal(invoice)) * settings.PointsPerUnit
+	for _, line := range invoice.Lines {
+		for _, bonus := range settings.BonusItems {
+			if bonus.FoodID == line.FoodID {
+				points += float64(bonus.Points) * line.Quantity
+			}
+		}
+	}
+
+	paidAt := invoice.UpdatedAt
+	if invoice.PaidAt != nil {
+		paidAt = *invoice.PaidAt
+	}
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	weekday := int(paidAt.In(location).Weekday())
+	for _, day := range settings.DayMultipliers {
+		if day.Weekday == weekday {
+			points *= day.Multiplier
+		}
+	}
+	if tier := loyaltyTier(settings, lifetimePoints); tier != nil {
+		points *= tier.Multiplier
+	}
+
+	return int(math.Floor(points))
+}
+
+// earnPoints credits the customer of a paid invoice with its points. It runs
+// in the transaction that pays the invoice, so points are never missed.
+func earnPoints(ctx context.Context, settings model.LoyaltySettings, invoice model.Invoice) error {
+	if invoice.CustomerID == nil || !settings.Enabled {
+		return nil
+	}
+
+	var customer model.Customer
+	_, err := customerCollection.ReadDocument(ctx, *invoice.CustomerID, &customer)
+	if driver.IsNotFound(err) {
+		// a deleted customer does not hold up the payment
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	points := invoicePoints(settings, invoice, customer.LifetimePoints)
+	if points <= 0 {
+		return nil
+	}
+	entry := model.LoyaltyTransaction{
+		CustomerID: customer.CustomerID,
+		Type:       "EARN",
+		Points:     points,
+		InvoiceID:  &invoice.InvoiceID,
+	}
+	if invoice.InvoiceNumber != nil {
+		entry.Description = "invoice " + *invoice.InvoiceNumber
+	}
+	return addPoints(ctx, settings, &entry, points)
+}
+
+// reverseLoyalty takes back the points an invoice earned in proportion to
+// what the credit note refunds. Once the invoice is credited in full the
+// rest of its points are taken back and rewards redeemed on it are given
+// back. It runs in the transaction that issues the credit note.
+func reverseLoyalty(ctx context.Context, invoice model.Invoice, creditNote model.CreditNote) error {
+	query := `
+	FOR entry IN loyaltyTransactions
+		FILTER entry.invoice_id == @invoice_id AND entry.customer_id != null
+		RETURN entry`
+	cursor, err := db.Query(ctx, query, map[string]interface{}{"invoice_id": invoice.InvoiceID})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	var earned *model.LoyaltyTransaction
+	reversed := 0
+	redemptions := []model.InvoiceDiscount{}
+	for {
+		var entry model.LoyaltyTransaction
+		_, err := cursor.ReadDocument(ctx, &entry)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch entry.Type {
+		case "EARN":
+			earned = &entry
+		case "REVERSE":
+			reversed -= entry.Points
+		case "REDEEM":
+			redemptions = append(redemptions, model.InvoiceDiscount{Reference: entry.TransactionID})
+		}
+	}
+	if earned == nil && len(redemptions) == 0 {
+		return nil
+	}
+
+	settings, err := readLoyaltySettings()
+	if err != nil {
+		return err
+	}
+
+	full := roundMoney(invoice.CreditedTotal+creditNote.Total) >= invoice.Total
+	if earned != nil {
+		points := earned.Points - reversed
+		net := invoice.Subtotal - fiscal.DiscountTotal(invoice)
+		if !full && net > 0 {
+			share := int(math.Floor(float64(earned.Points) * creditNote.Subtotal / net))
+			if share < points {
+				points = share
+			}
+		}
+		if points > 0 {
+			entry := model.LoyaltyTransaction{
+				CustomerID:   earned.CustomerID,
+				Type:         "REVERSE",
+				Points:       -points,
+				InvoiceID:    &invoice.InvoiceID,
+				CreditNoteID: &creditNote.CreditNoteID,
+				Description:  "credit note " + creditNote.CreditNoteNumber,
+			}
+			err = addPoints(ctx, settings, &entry, -points)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if !full {
+		return nil
+	}
+	return releaseRedemptions(ctx, redemptions, "invoice credited")
+}
+
+// releaseRedemptions gives back the points of the loyalty discounts, whose
+// reference is the redemption in the ledger.
+func releaseRedemptions(ctx context.Context, discounts []model.InvoiceDiscount, description string) error {
+	settings, err := readLoyaltySettings()
+	if err != nil {
+		return err
+	}
+
+	for _, discount := range discounts {
+		var redemption model.LoyaltyTransaction
+		_, err := loyaltyTransactionCollection.ReadDocument(ctx, discount.Reference, &redemption)
+		if driver.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if redemption.Reversed || redemption.CustomerID == "" {
+			continue
+		}
+
+		_, err = loyaltyTransactionCollection.UpdateDocument(ctx, redemption.TransactionID, map[string]interface{}{"reversed": true})
+		if err != nil {
+			return err
+		}
+		entry := model.LoyaltyTransaction{
+			CustomerID:  redemption.CustomerID,
+			Type:        "RESTORE",
+			Points:      -redemption.Points,
+			InvoiceID:   redemption.InvoiceID,
+			RewardCode:  redemption.RewardCode,
+			Description: description,
+		}
+		err = addPoints(ctx, settings, &entry, 0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invoiceRedemptions are the loyalty discounts of an invoice.
+func invoiceRedemptions(invoice model.Invoice) []model.InvoiceDiscount {
+	redemptions := []model.InvoiceDiscount{}
+	for _, discount := range invoice.Discounts {
+		if discount.Source == "LOYALTY" {
+			redemptions = append(redemptions, discount)
+		}
+	}
+	return redemptions
+}
+
+// addPoints books a ledger entry, moves the customer's balance by its points
+// and their lifetime points by lifetimePoints. Points credited expire after
+// the configured days; points taken come out of the credits expiring first.
+func addPoints(ctx context.Context, settings model.LoyaltySettings, entry *model.LoyaltyTransaction, lifetimePoints int) error {
+	var customer model.Customer
+	_, err := customerCollection.ReadDocument(ctx, entry.CustomerID, &customer)
+	if driver.IsNotFound(err) {
+		return errCustomerNotFound
+	} else if err != nil {
+		return err
+	}
+	// reversals may take the balance below zero when the points were spent
+	// already, but nobody can spend points they do not have
+	if (entry.Type == "REDEEM" || entry.Type == "ADJUST") && customer.LoyaltyPoints+entry.Points < 0 {
+		return errNotEnoughPoints
+	}
+
+	entry.TransactionID = uuid.NewString()
+	entry.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	if entry.Points > 0 {
+		entry.Remaining = entry.Points
+		if settings.ExpiryDays > 0 {
+			expiresAt := entry.CreatedAt.AddDate(0, 0, settings.ExpiryDays)
+			entry.ExpiresAt = &expiresAt
+		}
+	} else if entry.Type != "EXPIRE" {
+		err = consumePoints(ctx, entry.CustomerID, -entry.Points)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = loyaltyTransactionCollection.CreateDocument(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	lifetime := customer.LifetimePoints + lifetimePoints
+	tier := ""
+	if reached := loyaltyTier(settings, lifetime); reached != nil {
+		tier = reached.Name
+	}
+	_, err = customerCollection.UpdateDocument(ctx, customer.CustomerID, map[string]interface{}{
+		"loyalty_points":  customer.LoyaltyPoints + entry.Points,
+		"lifetime_points": lifetime,
+		"loyalty_tier":    tier,
+	})
+	return err
+}
+
+// consumePoints takes points out of the customer's unspent credits, those
+// expiring first first.
+func consumePoints(ctx context.Context, customerID string, points int) error {
+	query := `
+	FOR entry IN loyaltyTransactions
+		FILTER entry.customer_id == @customer_id AND entry.remaining > 0
+		SORT entry.expires_at == null, entry.expires_at, entry.created_at
+		RETURN entry`
+	cursor, err := db.Query(ctx, query, map[string]interface{}{"customer_id": customerID})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	credits := []model.LoyaltyTransaction{}
+	for {
+		var entry model.LoyaltyTransaction
+		_, err := cursor.ReadDocument(ctx, &entry)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+		credits = append(credits, entry)
+	}
+
+	for _, credit := range credits {
+		if points <= 0 {
+			break
+		}
+		taken := credit.Remaining
+		if taken > points {
+			taken = points
+		}
+		_, err = loyaltyTransactionCollection.UpdateDocument(ctx, credit.TransactionID, map[string]interface{}{"remaining": credit.Remaining - taken})
+		if err != nil {
+			return err
+		}
+		points -= taken
+	}
+	return nil
+}
+
+// loyaltyFailed writes the response for an error of a loyalty operation.
+func loyaltyFailed(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errInvoiceNotFound), errors.Is(err, errCustomerNotFound), errors.Is(err, errRedemptionNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+	case errors.Is(err, errUnknownReward), errors.Is(err, errNoLoyaltyCustomer):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+	case errors.Is(err, errLoyaltyDisabled), errors.Is(err, errNotEnoughPoints), errors.Is(err, errInvoiceLocked):
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(status{"error": "failed to update loyalty points"})
+	}
+	return true
+}
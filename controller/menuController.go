@@ -3,8 +3,11 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"main/database"
+	"main/export"
 	"main/model"
+	"main/schedule"
 	"net/http"
 	"time"
 
@@ -15,10 +18,16 @@ import (
 
 var menuCollection = database.OpenCollection(db, "menus")
 
+func init() {
+	database.EnsureUniqueIndex(menuCollection, "sku")
+}
+
 func GetMenus() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		query := "FOR menu IN menus LIMIT 10 RETURN menu"
-		cursor, err := db.Query(context.TODO(), query, nil)
+		format := export.Negotiate(r)
+		query := "FOR menu IN menus LIMIT @limit RETURN menu"
+		bindVars := map[string]interface{}{"limit": listLimit(format)}
+		cursor, err := db.Query(exportContext(format), query, bindVars)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
@@ -26,6 +35,12 @@ func GetMenus() http.HandlerFunc {
 		}
 		defer cursor.Close()
 
+		if format != "" {
+			exportCursor[model.Menu](w, format, "menus", cursor)
+			return
+		}
+
+		locale, defaultLocale := requestLocale(r)
 		menus := []model.Menu{}
 		for {
 			var menu model.Menu
@@ -39,9 +54,11 @@ func GetMenus() http.HandlerFunc {
 				return
 			}
 
+			localizeMenu(&menu, locale, defaultLocale)
 			menus = append(menus, menu)
 		}
 
+		setContentLanguage(w, locale)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(menus)
 	}
@@ -52,13 +69,20 @@ func GetMenuByID() http.HandlerFunc {
 		menuID := chi.URLParam(r, "menu_id")
 		var menu model.Menu
 
-		_, err := menuCollection.ReadDocument(context.TODO(), menuID, &menu)
+		meta, err := menuCollection.ReadDocument(context.TODO(), menuID, &menu)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to fetch menu item"})
 			return
 		}
 
+		locale, defaultLocale := requestLocale(r)
+		setContentLanguage(w, locale)
+		if writeETag(w, r, localizedETag(meta.Rev, locale)) {
+			return
+		}
+
+		localizeMenu(&menu, locale, defaultLocale)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(menu)
 	}
@@ -75,18 +99,32 @@ func CreateMenu() http.HandlerFunc {
 		}
 
 		err = validate.Struct(menu)
+		if err == nil {
+			err = checkTranslations(menu.Translations)
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
 			return
 		}
 
+		err = checkMenuAvailability(menu)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
 		menu.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		menu.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		menu.MenuID = uuid.NewString()
 
 		meta, err := menuCollection.CreateDocument(context.TODO(), menu)
-		if err != nil {
+		if driver.IsConflict(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "a menu with this sku already exists"})
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to create menu item"})
 			return
@@ -110,33 +148,88 @@ func UpdateMenuByID() http.HandlerFunc {
 
 		updateObject := make(map[string]interface{})
 
-		if menu.StartDate != nil && menu.EndDate != nil {
-			if !inTimeSpan(*menu.StartDate, *menu.EndDate, time.Now()) {
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(status{"error": "kindly retype tye the time"})
-				return
-			}
-
+		err = checkMenuDates(menuID, menu.StartDate, menu.EndDate)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": "menu was not found"})
+			return
+		} else if errors.Is(err, errMenuDates) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch menu item"})
+			return
+		}
+		if menu.StartDate != nil {
 			updateObject["start_date"] = menu.StartDate
+		}
+		if menu.EndDate != nil {
 			updateObject["end_date"] = menu.EndDate
 		}
+		if menu.Timezone != "" {
+			err = checkMenuTimezone(menu.Timezone)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": err.Error()})
+				return
+			}
+			updateObject["timezone"] = menu.Timezone
+		}
+		if menu.Schedules != nil {
+			err = validate.Var(menu.Schedules, "dive")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+				return
+			}
+			updateObject["schedules"] = menu.Schedules
+		}
 		if menu.Name != "" {
 			updateObject["name"] = menu.Name
 		}
 		if menu.Category != "" {
 			updateObject["category"] = menu.Category
 		}
+		if menu.SKU != nil {
+			updateObject["sku"] = menu.SKU
+		}
+		if menu.Description != "" || menu.Translations != nil {
+			err = validate.StructPartial(menu, "Description", "Translations")
+			if err == nil {
+				err = checkTranslations(menu.Translations)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "invalid description or translations"})
+				return
+			}
+		}
+		if menu.Description != "" {
+			updateObject["description"] = menu.Description
+		}
+		if menu.Translations != nil {
+			updateObject["translations"] = menu.Translations
+		}
 
 		menu.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObject["updated_at"] = menu.UpdatedAt
 
-		meta, err := menuCollection.UpdateDocument(context.TODO(), menuID, updateObject)
-		if err != nil {
+		meta, err := menuCollection.UpdateDocument(revisionContext(r), menuID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if driver.IsConflict(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "a menu with this sku already exists"})
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to create menu item"})
 			return
 		}
 
+		setETag(w, meta.Rev)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(meta.Key)
 	}
@@ -146,8 +239,10 @@ func DeleteMenuByID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		menuID := chi.URLParam(r, "menu_id")
 
-		meta, err := menuCollection.RemoveDocument(context.TODO(), menuID)
-		if err != nil {
+		meta, err := menuCollection.RemoveDocument(revisionContext(r), menuID)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to delete menu item"})
 			return
@@ -158,6 +253,114 @@ func DeleteMenuByID() http.HandlerFunc {
 	}
 }
 
-func inTimeSpan(start, end, check time.Time) bool {
-	return start.After(check) && end.After(start)
+func GetActiveMenus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		if at := r.URL.Query().Get("at"); at != "" {
+			var err error
+			now, err = time.Parse(time.RFC3339, at)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "at must be an RFC3339 timestamp"})
+				return
+			}
+		}
+
+		query := "FOR menu IN menus RETURN menu"
+		cursor, err := db.Query(context.TODO(), query, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		locale, defaultLocale := requestLocale(r)
+		menus := []model.Menu{}
+		for {
+			var menu model.Menu
+			_, err := cursor.ReadDocument(context.TODO(), &menu)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read menu items"})
+				return
+			}
+
+			if menuIsActive(menu, now) {
+				localizeMenu(&menu, locale, defaultLocale)
+				menus = append(menus, menu)
+			}
+		}
+
+		setContentLanguage(w, locale)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(menus)
+	}
+}
+
+// checkMenuAvailability validates the date range and timezone of a menu.
+func checkMenuAvailability(menu model.Menu) error {
+	if menu.StartDate != nil && menu.EndDate != nil && !menu.EndDate.After(*menu.StartDate) {
+		return errMenuDates
+	}
+	return checkMenuTimezone(menu.Timezone)
+}
+
+var errMenuDates = errors.New("end date must be after start date")
+
+// checkMenuDates checks new dates of a stored menu. When only one of them
+// changes it is checked against the other one the menu keeps.
+func checkMenuDates(menuID string, startDate, endDate *time.Time) error {
+	if startDate == nil && endDate == nil {
+		return nil
+	}
+	if startDate == nil || endDate == nil {
+		var stored model.Menu
+		_, err := menuCollection.ReadDocument(context.TODO(), menuID, &stored)
+		if err != nil {
+			return err
+		}
+		if startDate == nil {
+			startDate = stored.StartDate
+		}
+		if endDate == nil {
+			endDate = stored.EndDate
+		}
+	}
+	if startDate != nil && endDate != nil && !endDate.After(*startDate) {
+		return errMenuDates
+	}
+	return nil
+}
+
+// checkMenuTimezone accepts IANA names only. "Local" is refused because it
+// would follow whatever timezone the server runs in.
+func checkMenuTimezone(timezone string) error {
+	if timezone == "Local" {
+		return errors.New("unknown timezone")
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return errors.New("unknown timezone")
+	}
+	return nil
+}
+
+// menuIsActive reports whether the menu can be ordered from at the given
+// instant.
+func menuIsActive(menu model.Menu, now time.Time) bool {
+	return schedule.Active(menu.StartDate, menu.EndDate, menu.Timezone, menu.Schedules, now)
+}
+
+// foodMenuIsActive loads the menu of a food and reports whether it is
+// currently available.
+func foodMenuIsActive(food model.Food) (bool, error) {
+	var menu model.Menu
+	_, err := menuCollection.ReadDocument(context.TODO(), *food.MenuID, &menu)
+	if err != nil {
+		return false, err
+	}
+	return menuIsActive(menu, time.Now()), nil
 }
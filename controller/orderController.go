@@ -3,7 +3,9 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"main/database"
+	"main/export"
 	"main/model"
 	"net/http"
 	"time"
@@ -17,8 +19,10 @@ var orderCollection = database.OpenCollection(db, "orders")
 
 func GetOrders() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		query := "FOR order IN orders LIMIT 10 RETURN order"
-		cursor, err := db.Query(context.TODO(), query, nil)
+		format := export.Negotiate(r)
+		query := "FOR order IN orders LIMIT @limit RETURN order"
+		bindVars := map[string]interface{}{"limit": listLimit(format)}
+		cursor, err := db.Query(exportContext(format), query, bindVars)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
@@ -26,6 +30,11 @@ func GetOrders() http.HandlerFunc {
 		}
 		defer cursor.Close()
 
+		if format != "" {
+			exportCursor[model.Order](w, format, "orders", cursor)
+			return
+		}
+
 		orders := []model.Order{}
 		for {
 			var order model.Order
@@ -52,13 +61,17 @@ func GetOrderByID() http.HandlerFunc {
 		orderID := chi.URLParam(r, "order_id")
 		var order model.Order
 
-		_, err := orderCollection.ReadDocument(context.TODO(), orderID, &order)
+		meta, err := orderCollection.ReadDocument(context.TODO(), orderID, &order)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to fetch order item"})
 			return
 		}
 
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(order)
 	}
@@ -89,20 +102,28 @@ func CreateOrder() http.HandlerFunc {
 			return
 		}
 
+		if customerFailed(w, checkCustomer(order.CustomerID)) {
+			return
+		}
+
 		order.OrderDate, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		order.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		order.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		order.OrderID = uuid.NewString()
 
-		meta, err := orderCollection.CreateDocument(context.TODO(), order)
-		if err != nil {
+		collections := driver.TransactionCollections{Write: []string{orderCollection.Name(), promotionCollection.Name()}}
+		err = runTransaction(collections, func(ctx context.Context) error {
+			return createOrder(ctx, order)
+		})
+		if errors.Is(err, errInvalidCoupon) {
+			promotionFailed(w, err)
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to create order item"})
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(meta.Key)
+		json.NewEncoder(w).Encode(order.OrderID)
 	}
 }
 
@@ -129,17 +150,39 @@ func UpdateOrderByID() http.HandlerFunc {
 			}
 			updateObject["table_id"] = order.TableID
 		}
+		if order.Server != nil {
+			updateObject["server"] = order.Server
+		}
+		if order.NumberOfGuest != nil {
+			if *order.NumberOfGuest <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "number of guests must be greater than zero"})
+				return
+			}
+			updateObject["number_of_guest"] = order.NumberOfGuest
+		}
+		if order.CustomerID != nil {
+			if *order.CustomerID == "" {
+				order.CustomerID = nil
+			} else if customerFailed(w, checkCustomer(order.CustomerID)) {
+				return
+			}
+			updateObject["customer_id"] = order.CustomerID
+		}
 
 		order.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObject["updated_at"] = order.UpdatedAt
 
-		meta, err := orderCollection.UpdateDocument(context.TODO(), orderID, updateObject)
-		if err != nil {
+		meta, err := orderCollection.UpdateDocument(revisionContext(r), orderID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to create order item"})
 			return
 		}
 
+		setETag(w, meta.Rev)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(meta.Key)
 	}
@@ -149,8 +192,21 @@ func DeleteOrderByID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		orderID := chi.URLParam(r, "order_id")
 
-		meta, err := orderCollection.RemoveDocument(context.TODO(), orderID)
-		if err != nil {
+		// the coupon of the order can be used again
+		var meta driver.DocumentMeta
+		collections := driver.TransactionCollections{Write: []string{orderCollection.Name(), promotionCollection.Name()}}
+		err := runTransaction(collections, func(ctx context.Context) error {
+			var removed model.Order
+			var err error
+			meta, err = orderCollection.RemoveDocument(driver.WithReturnOld(withIfMatch(ctx, r), &removed), orderID)
+			if err != nil || removed.CouponCode == nil {
+				return err
+			}
+			return releaseCoupon(ctx, *removed.CouponCode)
+		})
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to delete order item"})
 			return
@@ -161,13 +217,19 @@ func DeleteOrderByID() http.HandlerFunc {
 	}
 }
 
-func OrderItemOrderCreator(order model.Order) string {
+// createOrder claims the coupon of a new order and stores the order. It runs
+// in a transaction that writes orders and promotions, so that a failure
+// leaves neither the order nor a use of the coupon behind.
+func createOrder(ctx context.Context, order model.Order) error {
+	if order.CouponCode != nil {
+		err := claimCoupon(ctx, *order.CouponCode)
+		if err != nil {
+			return err
+		}
+	}
+
 	order.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	order.OrderID = uuid.NewString()
-	_, err := orderCollection.CreateDocument(context.TODO(), order)
-	if err != nil {
-		panic(err)
-	}
-	return order.OrderID
+	_, err := orderCollection.CreateDocument(ctx, order)
+	return err
 }
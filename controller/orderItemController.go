@@ -3,9 +3,11 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"main/database"
+	"main/export"
 	"main/model"
 	"math"
 	"net/http"
@@ -20,8 +22,10 @@ var orderItemCollection = database.OpenCollection(db, "orderItems")
 
 func GetOrderItems() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		query := "FOR orderItem IN orderItems LIMIT 10 RETURN orderItem"
-		cursor, err := db.Query(context.TODO(), query, nil)
+		format := export.Negotiate(r)
+		query := "FOR orderItem IN orderItems LIMIT @limit RETURN orderItem"
+		bindVars := map[string]interface{}{"limit": listLimit(format)}
+		cursor, err := db.Query(exportContext(format), query, bindVars)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
@@ -29,6 +33,11 @@ func GetOrderItems() http.HandlerFunc {
 		}
 		defer cursor.Close()
 
+		if format != "" {
+			exportCursor[model.OrderItem](w, format, "orderItems", cursor)
+			return
+		}
+
 		orderItems := []model.OrderItem{}
 		for {
 			var orderItem model.OrderItem
@@ -55,13 +64,17 @@ func GetOrderItemByID() http.HandlerFunc {
 		orderItemID := chi.URLParam(r, "orderItem_id")
 		var orderItem model.OrderItem
 
-		_, err := orderItemCollection.ReadDocument(context.TODO(), orderItemID, &orderItem)
+		meta, err := orderItemCollection.ReadDocument(context.TODO(), orderItemID, &orderItem)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to fetch orderItem"})
 			return
 		}
 
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(orderItem)
 	}
@@ -79,6 +92,13 @@ func CreateOrderItem() http.HandlerFunc {
 			return
 		}
 
+		err = validate.Struct(orderItemPack)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
 		var table model.Table
 		_, err = tableCollection.ReadDocument(context.TODO(), *orderItemPack.TableID, &table)
 		if err != nil {
@@ -87,11 +107,24 @@ func CreateOrderItem() http.HandlerFunc {
 			return
 		}
 
+		if customerFailed(w, checkCustomer(orderItemPack.CustomerID)) {
+			return
+		}
+		if orderItemPack.CouponCode != nil && promotionFailed(w, checkCoupon(*orderItemPack.CouponCode)) {
+			return
+		}
+
 		order.OrderDate, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 
 		orderItemsToBeInserted := []model.OrderItem{}
 		order.TableID = orderItemPack.TableID
-		orderID := OrderItemOrderCreator(order)
+		order.Server = orderItemPack.Server
+		order.NumberOfGuest = orderItemPack.NumberOfGuest
+		order.CustomerID = orderItemPack.CustomerID
+		order.CouponCode = orderItemPack.CouponCode
+		// the order is only stored with its items
+		orderID := uuid.NewString()
+		order.OrderID = orderID
 
 		for _, orderItem := range orderItemPack.OrderItems {
 			orderItem.OrderID = orderID
@@ -102,6 +135,12 @@ func CreateOrderItem() http.HandlerFunc {
 				return
 			}
 
+			if orderItem.TotalPrice != nil || orderItem.UnitPrice != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "prices are calculated by the server"})
+				return
+			}
+
 			var food model.Food
 			_, err = foodCollection.ReadDocument(context.TODO(), *orderItem.FoodID, &food)
 			if err != nil {
@@ -110,27 +149,102 @@ func CreateOrderItem() http.HandlerFunc {
 				return
 			}
 
+			active, err := foodMenuIsActive(food)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to fetch menu item"})
+				return
+			} else if !active {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(status{"error": "food is not available at this time", "food_id": food.FoodID})
+				return
+			}
+
 			orderItem.OrderItemID = uuid.NewString()
 			orderItem.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 			orderItem.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-			totalPrice := math.Round((*food.UnitPrice)*(*orderItem.Quantity)*100) / 100
-			orderItem.TotalPrice = &totalPrice
+			err = priceOrderItem(&orderItem, food)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": err.Error()})
+				return
+			}
+
+			if food.Station != nil {
+				orderItem.Station = *food.Station
+			}
+
+			orderItem.Consumption, err = foodConsumption(food, *orderItem.Quantity)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to fetch recipe"})
+				return
+			}
 			orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
 		}
 
-		metas, errs, err := orderItemCollection.CreateDocuments(context.TODO(), orderItemsToBeInserted)
+		for i, orderItem := range orderItemsToBeInserted {
+			reserved, err := reservePortions(*orderItem.FoodID, *orderItem.Quantity)
+			if err != nil || !reserved {
+				releaseOrderItemPortions(orderItemsToBeInserted[:i])
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to reserve food portions"})
+				return
+			} else if !reserved {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(status{"error": "food is sold out", "food_id": *orderItem.FoodID})
+				return
+			}
+		}
+
+		// the order, the use of its coupon, the items, the stock they use and
+		// their discounts are written together
+		var metas driver.DocumentMetaSlice
+		collections := stockCollections(orderItemCollection.Name(), orderCollection.Name(), promotionCollection.Name())
+		err = runTransaction(collections, func(ctx context.Context) error {
+			err := createOrder(ctx, order)
+			if err != nil {
+				return err
+			}
+			var errs driver.ErrorSlice
+			metas, errs, err = orderItemCollection.CreateDocuments(ctx, orderItemsToBeInserted)
+			if err != nil {
+				return err
+			} else if err := errs.FirstNonNil(); err != nil {
+				return err
+			}
+			for _, orderItem := range orderItemsToBeInserted {
+				err = moveStock(ctx, orderItem.Consumption, -1, "SALE", orderItem.OrderItemID)
+				if err != nil {
+					return err
+				}
+			}
+			return applyPromotions(ctx, orderID)
+		})
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(status{"error": "failed to create orderItem Collection"})
+			releaseOrderItemPortions(orderItemsToBeInserted)
+		}
+		if errors.Is(err, errInvalidCoupon) {
+			promotionFailed(w, err)
 			return
-		} else if err := errs.FirstNonNil(); err != nil {
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to create orderItem Collection"})
 			return
 		}
 
+		_, err = queueKitchenTickets(order, orderItemsToBeInserted)
+		if err != nil {
+			log.Println("failed to queue kitchen tickets:", err)
+		}
+
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(metas.Keys())
+		json.NewEncoder(w).Encode(status{
+			"order_item_ids":    metas.Keys(),
+			"allergen_warnings": orderAllergenWarnings(order.CustomerID, orderItemsToBeInserted),
+		})
 	}
 }
 
@@ -145,37 +259,176 @@ func UpdateOrderItemByID() http.HandlerFunc {
 			return
 		}
 
-		updateObject := make(map[string]interface{})
+		if orderItem.TotalPrice != nil || orderItem.UnitPrice != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "prices are calculated by the server"})
+			return
+		}
 
-		if orderItem.TotalPrice != nil {
-			updateObject["total_price"] = orderItem.TotalPrice
+		var storedOrderItem model.OrderItem
+		_, err = orderItemCollection.ReadDocument(context.TODO(), orderItemID, &storedOrderItem)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch orderItem"})
+			return
 		}
+		previousOrderItem := storedOrderItem
+
+		if orderItemLocked(w, storedOrderItem.OrderID) {
+			return
+		}
+
+		updateObject := make(map[string]interface{})
+
 		if orderItem.Quantity != nil {
+			if *orderItem.Quantity <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "quantity must be greater than zero"})
+				return
+			}
+			storedOrderItem.Quantity = orderItem.Quantity
 			updateObject["quantity"] = orderItem.Quantity
 		}
-		if orderItem.FoodID != nil {
+
+		if orderItem.SpecialInstructions != nil {
+			err = validate.Var(*orderItem.SpecialInstructions, "max=200")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "special instructions are too long"})
+				return
+			}
+			updateObject["special_instructions"] = orderItem.SpecialInstructions
+		}
+
+		// the unit price snapshot is only refreshed when the food or its
+		// modifiers change, so later menu price edits do not rewrite the item
+		if orderItem.FoodID != nil || orderItem.Modifiers != nil || storedOrderItem.UnitPrice == nil {
+			if orderItem.FoodID != nil {
+				storedOrderItem.FoodID = orderItem.FoodID
+				storedOrderItem.Modifiers = nil
+			}
+			if orderItem.Modifiers != nil {
+				err = validate.Var(orderItem.Modifiers, "dive")
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+					return
+				}
+				storedOrderItem.Modifiers = orderItem.Modifiers
+			}
+
 			var food model.Food
-			_, err = foodCollection.ReadDocument(context.TODO(), *orderItem.FoodID, &food)
+			_, err = foodCollection.ReadDocument(context.TODO(), *storedOrderItem.FoodID, &food)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(w).Encode(status{"error": "food was not found"})
 				return
 			}
-			updateObject["food_id"] = orderItem.FoodID
+
+			if orderItem.FoodID != nil {
+				active, err := foodMenuIsActive(food)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(status{"error": "failed to fetch menu item"})
+					return
+				} else if !active {
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(status{"error": "food is not available at this time"})
+					return
+				}
+			}
+
+			err = priceOrderItem(&storedOrderItem, food)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": err.Error()})
+				return
+			}
+			updateObject["food_id"] = storedOrderItem.FoodID
+			updateObject["food_name"] = storedOrderItem.FoodName
+			updateObject["unit_price"] = storedOrderItem.UnitPrice
+			updateObject["modifiers"] = storedOrderItem.Modifiers
+			updateObject["combo_items"] = storedOrderItem.ComboItems
+		}
+
+		totalPrice := math.Round((*storedOrderItem.UnitPrice)*(*storedOrderItem.Quantity)*100) / 100
+		updateObject["total_price"] = totalPrice
+
+		var consumption []model.RecipeLine
+		if orderItem.Quantity != nil || orderItem.FoodID != nil {
+			var food model.Food
+			_, err = foodCollection.ReadDocument(context.TODO(), *storedOrderItem.FoodID, &food)
+			if err == nil {
+				consumption, err = foodConsumption(food, *storedOrderItem.Quantity)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to fetch recipe"})
+				return
+			}
+			updateObject["consumption"] = consumption
 		}
 
+		portionsChanged := orderItem.Quantity != nil || orderItem.FoodID != nil
+
 		orderItem.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObject["updated_at"] = orderItem.UpdatedAt
 
-		meta, err := orderItemCollection.UpdateDocument(context.TODO(), orderItemID, updateObject)
-		if err != nil {
+		// portions and stock held by the previous version are swapped for
+		// those of the new one in the same transaction as the update
+		var meta driver.DocumentMeta
+		var changedFoods []*model.Food
+		collections := stockCollections(orderItemCollection.Name(), foodCollection.Name())
+		err = runTransaction(collections, func(ctx context.Context) error {
+			if portionsChanged {
+				changedFoods, err = swapPortions(ctx, previousOrderItem, storedOrderItem)
+				if err != nil {
+					return err
+				}
+			}
+			meta, err = orderItemCollection.UpdateDocument(withIfMatch(ctx, r), orderItemID, updateObject)
+			if err != nil {
+				return err
+			}
+			if consumption != nil {
+				err = moveStock(ctx, previousOrderItem.Consumption, 1, "VOID", orderItemID)
+				if err != nil {
+					return err
+				}
+				err = moveStock(ctx, consumption, -1, "SALE", orderItemID)
+				if err != nil {
+					return err
+				}
+			}
+			return applyPromotions(ctx, storedOrderItem.OrderID)
+		})
+		if errors.Is(err, errFoodSoldOut) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "food is sold out", "food_id": *storedOrderItem.FoodID})
+			return
+		} else if revisionConflict(w, err) {
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to create orderItem"})
 			return
 		}
+		for _, food := range changedFoods {
+			publishPortions(food)
+		}
+
+		warnings := []model.AllergenWarning{}
+		if orderItem.FoodID != nil || orderItem.Modifiers != nil {
+			var order model.Order
+			_, err = orderCollection.ReadDocument(context.TODO(), storedOrderItem.OrderID, &order)
+			if err == nil {
+				warnings = orderAllergenWarnings(order.CustomerID, []model.OrderItem{storedOrderItem})
+			}
+		}
 
+		setETag(w, meta.Rev)
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(meta.Key)
+		json.NewEncoder(w).Encode(status{"order_item_id": meta.Key, "allergen_warnings": warnings})
 	}
 }
 
@@ -183,18 +436,159 @@ func DeleteOrderItemByID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		orderItemID := chi.URLParam(r, "orderItem_id")
 
-		meta, err := orderItemCollection.RemoveDocument(context.TODO(), orderItemID)
+		var storedOrderItem model.OrderItem
+		_, err := orderItemCollection.ReadDocument(context.TODO(), orderItemID, &storedOrderItem)
 		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch orderItem"})
+			return
+		}
+		if orderItemLocked(w, storedOrderItem.OrderID) {
+			return
+		}
+
+		// the last item of an order gives its coupon back
+		var removedOrderItem model.OrderItem
+		var meta driver.DocumentMeta
+		collections := stockCollections(orderItemCollection.Name(), orderCollection.Name(), promotionCollection.Name())
+		err = runTransaction(collections, func(ctx context.Context) error {
+			meta, err = orderItemCollection.RemoveDocument(driver.WithReturnOld(withIfMatch(ctx, r), &removedOrderItem), orderItemID)
+			if err != nil {
+				return err
+			}
+			err = moveStock(ctx, removedOrderItem.Consumption, 1, "VOID", orderItemID)
+			if err != nil {
+				return err
+			}
+			err = applyPromotions(ctx, removedOrderItem.OrderID)
+			if err != nil {
+				return err
+			}
+			return releaseOrderCoupon(ctx, removedOrderItem.OrderID)
+		})
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to delete orderItem"})
 			return
 		}
 
+		releaseOrderItemPortions([]model.OrderItem{removedOrderItem})
+
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(meta.Key)
 	}
 }
 
+func releaseOrderItemPortions(orderItems []model.OrderItem) {
+	for _, orderItem := range orderItems {
+		err := releasePortions(*orderItem.FoodID, *orderItem.Quantity)
+		if err != nil {
+			log.Println("failed to release food portions:", err)
+		}
+	}
+}
+
+// swapPortions moves the portions held by an order item from its previous
+// food and quantity to the current ones, within the transaction of ctx so
+// that nothing changes when the new portions cannot be had. Lowering the
+// quantity of the same food only gives portions back, so it succeeds even for
+// 86'd foods. It returns the foods to publish once the transaction commits.
+func swapPortions(ctx context.Context, previous, current model.OrderItem) ([]*model.Food, error) {
+	if *previous.FoodID == *current.FoodID && *current.Quantity <= *previous.Quantity {
+		released, err := changePortions(ctx, releasePortionsQuery, *current.FoodID, *previous.Quantity-*current.Quantity)
+		return []*model.Food{released}, err
+	}
+
+	released, err := changePortions(ctx, releasePortionsQuery, *previous.FoodID, *previous.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := changePortions(ctx, reservePortionsQuery, *current.FoodID, *current.Quantity)
+	if err != nil {
+		return nil, err
+	} else if reserved == nil {
+		return nil, errFoodSoldOut
+	}
+	return []*model.Food{released, reserved}, nil
+}
+
+// priceOrderItem snapshots the current food name, combo components and unit
+// price including the selected modifiers into the order item and derives its
+// total from them.
+func priceOrderItem(orderItem *model.OrderItem, food model.Food) error {
+	modifiers, err := selectModifiers(food.ModifierGroups, orderItem.Modifiers)
+	if err != nil {
+		return err
+	}
+
+	unitPrice := *food.UnitPrice
+	for _, modifier := range modifiers {
+		unitPrice += modifier.PriceDelta
+	}
+	unitPrice = math.Round(unitPrice*100) / 100
+	totalPrice := math.Round(unitPrice*(*orderItem.Quantity)*100) / 100
+
+	orderItem.FoodName = *food.Name
+	orderItem.Modifiers = modifiers
+	orderItem.ComboItems = food.ComboItems
+	orderItem.UnitPrice = &unitPrice
+	orderItem.TotalPrice = &totalPrice
+	return nil
+}
+
+// selectModifiers resolves the requested options against the food's modifier
+// groups and enforces each group's selection limits.
+func selectModifiers(groups []model.ModifierGroup, requested []model.SelectedModifier) ([]model.SelectedModifier, error) {
+	selected := []model.SelectedModifier{}
+	counts := make(map[string]int)
+
+	for _, request := range requested {
+		option, ok := findModifierOption(groups, request.GroupID, request.OptionID)
+		if !ok {
+			return nil, fmt.Errorf("modifier option %s is not available for this food", request.OptionID)
+		}
+
+		counts[request.GroupID]++
+		selected = append(selected, model.SelectedModifier{
+			GroupID:    request.GroupID,
+			OptionID:   option.OptionID,
+			Name:       option.Name,
+			PriceDelta: option.PriceDelta,
+		})
+	}
+
+	for _, group := range groups {
+		minSelections := group.MinSelections
+		if group.Required && minSelections == 0 {
+			minSelections = 1
+		}
+		if counts[group.GroupID] < minSelections {
+			return nil, fmt.Errorf("modifier group %q needs at least %d selection(s)", group.Name, minSelections)
+		}
+		if group.MaxSelections > 0 && counts[group.GroupID] > group.MaxSelections {
+			return nil, fmt.Errorf("modifier group %q allows at most %d selection(s)", group.Name, group.MaxSelections)
+		}
+	}
+
+	return selected, nil
+}
+
+func findModifierOption(groups []model.ModifierGroup, groupID, optionID string) (model.ModifierOption, bool) {
+	for _, group := range groups {
+		if group.GroupID != groupID {
+			continue
+		}
+		for _, option := range group.Options {
+			if option.OptionID == optionID {
+				return option, true
+			}
+		}
+	}
+	return model.ModifierOption{}, false
+}
+
 func GetOrderItemsByOrder() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		orderID := chi.URLParam(r, "order_id")
@@ -212,23 +606,35 @@ func GetOrderItemsByOrder() http.HandlerFunc {
 }
 
 func ItemsByOrder(orderID string) (orderItemsByOrder []model.OrderItemsByOrder, err error) {
-	fmt.Println(orderID)
-	query := fmt.Sprintf(`
+	query := `
 	LET foodList = (
 	FOR orderItem IN orderItems
-		FILTER orderItem.order_id == '%s'
+		FILTER orderItem.order_id == @order_id
 			FOR food IN foods
 				FILTER food._key == orderItem.food_id
 				RETURN {
+					food_id: orderItem.food_id,
 					image: food.food_image,
-					name: food.name,
+					name: NOT_NULL(orderItem.food_name, food.name),
 					quantity: orderItem.quantity,
-					unit_price: food.unit_price,
-					total_price: orderItem.total_price
+					unit_price: NOT_NULL(orderItem.unit_price, food.unit_price),
+					total_price: orderItem.total_price,
+					modifiers: NOT_NULL(orderItem.modifiers, []),
+					special_instructions: NOT_NULL(orderItem.special_instructions, ''),
+					promotions: NOT_NULL(orderItem.promotions, []),
+					combo_items: (
+						FOR combo IN NOT_NULL(orderItem.combo_items, [])
+							FOR component IN foods
+								FILTER component._key == combo.food_id
+								RETURN {
+									name: component.name,
+									quantity: combo.quantity * orderItem.quantity
+								}
+					)
 				}
 	)
 	FOR orderItem IN orderItems
-		FILTER orderItem.order_id == '%s'
+		FILTER orderItem.order_id == @order_id
 			FOR order IN orders
 				FILTER order._key == orderItem.order_id
 				FOR table IN tables
@@ -238,12 +644,12 @@ func ItemsByOrder(orderID string) (orderItemsByOrder []model.OrderItemsByOrder,
 						table_number: table.table_number,
 						order_items: foodList,
 						payment_due: SUM(foodList[*].total_price)
-					}	
-	`, orderID, orderID)
+					}
+	`
 
-	cursor, err := db.Query(context.TODO(), query, nil)
+	cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"order_id": orderID})
 	if err != nil {
-		log.Fatal("Failed to run aggregation:", err)
+		return nil, err
 	}
 	defer cursor.Close()
 
@@ -253,7 +659,7 @@ func ItemsByOrder(orderID string) (orderItemsByOrder []model.OrderItemsByOrder,
 		if driver.IsNoMoreDocuments(err) {
 			return orderItemsByOrder, nil
 		} else if err != nil {
-			log.Fatal("failed to get all order items by order:", err)
+			return nil, err
 		}
 
 		orderItemsByOrder = append(orderItemsByOrder, orderItemByOrder)
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"main/database"
+	"main/export"
+	"main/model"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var printJobCollection = database.OpenCollection(db, "printJobs")
+
+const (
+	maxPrintAttempts  = 5
+	printPollInterval = 5 * time.Second
+)
+
+// wakes the print queue as soon as a job is queued instead of at the next poll
+var printQueueWake = make(chan struct{}, 1)
+
+func GetPrintJobs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := `
+		FOR job IN printJobs
+			FILTER @status == null OR job.status == @status
+			FILTER @printer_id == null OR job.printer_id == @printer_id
+			SORT job.created_at DESC
+			LIMIT @limit
+			RETURN UNSET(job, "payload")`
+		bindVars := map[string]interface{}{"status": nil, "printer_id": nil, "limit": listLimit(format)}
+		if s := r.URL.Query().Get("status"); s != "" {
+			bindVars["status"] = s
+		}
+		if printerID := r.URL.Query().Get("printer_id"); printerID != "" {
+			bindVars["printer_id"] = printerID
+		}
+
+		cursor, err := db.Query(exportContext(format), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.PrintJob](w, format, "print-jobs", cursor)
+			return
+		}
+
+		printJobs := []model.PrintJob{}
+		for {
+			var printJob model.PrintJob
+			_, err := cursor.ReadDocument(context.TODO(), &printJob)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read print jobs"})
+				return
+			}
+
+			printJobs = append(printJobs, printJob)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(printJobs)
+	}
+}
+
+func GetPrintJobByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		printJobID := chi.URLParam(r, "printJob_id")
+		var printJob model.PrintJob
+
+		meta, err := printJobCollection.ReadDocument(context.TODO(), printJobID, &printJob)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch print job"})
+			return
+		}
+
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(printJob)
+	}
+}
+
+// RetryPrintJob puts a failed job back into the queue with fresh attempts.
+func RetryPrintJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		printJobID := chi.URLParam(r, "printJob_id")
+
+		query := `
+		FOR job IN printJobs
+			FILTER job._key == @key AND job.status == "FAILED"
+			UPDATE job WITH { status: "QUEUED", attempts: 0, next_attempt_at: @now, updated_at: @now } IN printJobs
+			RETURN NEW._key`
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"key": printJobID, "now": now})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		var key string
+		_, err = cursor.ReadDocument(context.TODO(), &key)
+		if driver.IsNoMoreDocuments(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "only failed print jobs can be retried"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to retry print job"})
+			return
+		}
+
+		wakePrintQueue()
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(key)
+	}
+}
+
+func queuePrintJob(printerID, document, reference string, payload []byte) (string, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	job := model.PrintJob{
+		PrintJobID:    uuid.NewString(),
+		PrinterID:     printerID,
+		Document:      document,
+		Reference:     reference,
+		Payload:       payload,
+		Status:        "QUEUED",
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	meta, err := printJobCollection.CreateDocument(context.TODO(), job)
+	if err != nil {
+		return "", err
+	}
+
+	wakePrintQueue()
+	return meta.Key, nil
+}
+
+func wakePrintQueue() {
+	select {
+	case printQueueWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartPrintQueue sends queued jobs to their printers in the background.
+// Jobs left printing by a previous run are queued again first.
+func StartPrintQueue() {
+	query := `
+	FOR job IN printJobs
+		FILTER job.status == "PRINTING"
+		UPDATE job WITH { status: "QUEUED" } IN printJobs`
+	cursor, err := db.Query(context.TODO(), query, nil)
+	if err != nil {
+		log.Println("failed to requeue interrupted print jobs:", err)
+	} else {
+		cursor.Close()
+	}
+
+	go func() {
+		ticker := time.NewTicker(printPollInterval)
+		defer ticker.Stop()
+		for {
+			for printNextJob() {
+			}
+			select {
+			case <-ticker.C:
+			case <-printQueueWake:
+			}
+		}
+	}()
+}
+
+// printNextJob claims the oldest due job and prints it. It reports whether
+// a job was found so the queue can be drained without waiting.
+func printNextJob() bool {
+	query := `
+	FOR job IN printJobs
+		FILTER job.status == "QUEUED"
+		FILTER DATE_TIMESTAMP(job.next_attempt_at) <= @now
+		SORT job.created_at
+		LIMIT 1
+		UPDATE job WITH { status: "PRINTING", attempts: job.attempts + 1 } IN printJobs
+		RETURN NEW`
+	cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"now": time.Now().UnixMilli()})
+	if err != nil {
+		log.Println("failed to claim print job:", err)
+		return false
+	}
+
+	var job model.PrintJob
+	_, err = cursor.ReadDocument(context.TODO(), &job)
+	cursor.Close()
+	if driver.IsNoMoreDocuments(err) {
+		return false
+	} else if err != nil {
+		log.Println("failed to read print job:", err)
+		return false
+	}
+
+	device, err := openPrinter(job.PrinterID)
+	if err == nil {
+		err = device.Print(job.Payload)
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObject := map[string]interface{}{"updated_at": now}
+	if err == nil {
+		updateObject["status"] = "PRINTED"
+		updateObject["printed_at"] = now
+		updateObject["last_error"] = ""
+	} else {
+		log.Printf("print job %s failed on attempt %d: %v", job.PrintJobID, job.Attempts, err)
+		updateObject["last_error"] = err.Error()
+		if job.Attempts >= maxPrintAttempts {
+			updateObject["status"] = "FAILED"
+		} else {
+			// back off 2s, 4s, 8s... so a printer that is briefly offline
+			// or out of paper gets time to recover
+			updateObject["status"] = "QUEUED"
+			updateObject["next_attempt_at"] = now.Add(time.Duration(1<<job.Attempts) * time.Second)
+		}
+	}
+
+	_, err = printJobCollection.UpdateDocument(context.TODO(), job.PrintJobID, updateObject)
+	if err != nil {
+		log.Println("failed to update print job:", err)
+	}
+	return true
+}
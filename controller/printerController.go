@@ -0,0 +1,498 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"main/database"
+	"main/export"
+	"main/model"
+	"main/printer"
+	"main/receipt"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var printerCollection = database.OpenCollection(db, "printers")
+
+var printerTargets = openPrinterTargets()
+
+func openPrinterTargets() *printer.Targets {
+	targets, err := printer.TargetsFromEnv()
+	if err != nil {
+		log.Fatal("Failed to read printer targets:", err)
+	}
+	return targets
+}
+
+const (
+	receiptStation = "RECEIPT"
+	defaultStation = "KITCHEN"
+)
+
+func GetPrinters() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := "FOR printer IN printers SORT printer.name RETURN printer"
+		cursor, err := db.Query(exportContext(format), query, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.Printer](w, format, "printers", cursor)
+			return
+		}
+
+		printers := []model.Printer{}
+		for {
+			var printer model.Printer
+			_, err := cursor.ReadDocument(context.TODO(), &printer)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read printers"})
+				return
+			}
+
+			printers = append(printers, printer)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(printers)
+	}
+}
+
+func GetPrinterByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		printerID := chi.URLParam(r, "printer_id")
+		var printer model.Printer
+
+		meta, err := printerCollection.ReadDocument(context.TODO(), printerID, &printer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch printer"})
+			return
+		}
+
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(printer)
+	}
+}
+
+func CreatePrinter() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var printer model.Printer
+		err := json.NewDecoder(r.Body).Decode(&printer)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(printer)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		err = printerTargets.Check(*printer.Connection, *printer.Address)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		if printer.Enabled == nil {
+			enabled := true
+			printer.Enabled = &enabled
+		}
+
+		printer.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		printer.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		printer.PrinterID = uuid.NewString()
+
+		meta, err := printerCollection.CreateDocument(context.TODO(), printer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to create printer"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func UpdatePrinterByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		printerID := chi.URLParam(r, "printer_id")
+		var printer model.Printer
+		err := json.NewDecoder(r.Body).Decode(&printer)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		updateObject := make(map[string]interface{})
+
+		if printer.Name != nil {
+			updateObject["name"] = printer.Name
+		}
+		if printer.Connection != nil {
+			if validate.Var(*printer.Connection, "eq=NETWORK|eq=FILE") != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "connection must be NETWORK or FILE"})
+				return
+			}
+			updateObject["connection"] = printer.Connection
+		}
+		if printer.Address != nil {
+			updateObject["address"] = printer.Address
+		}
+		if printer.Connection != nil || printer.Address != nil {
+			// the address is checked against the connection it will be used with
+			var stored model.Printer
+			_, err = printerCollection.ReadDocument(context.TODO(), printerID, &stored)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to fetch printer"})
+				return
+			}
+			if printer.Connection == nil {
+				printer.Connection = stored.Connection
+			}
+			if printer.Address == nil {
+				printer.Address = stored.Address
+			}
+			err = printerTargets.Check(*printer.Connection, *printer.Address)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": err.Error()})
+				return
+			}
+		}
+		if printer.Stations != nil {
+			if validate.Var(printer.Stations, "min=1,dive,required") != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "a printer needs at least one station"})
+				return
+			}
+			updateObject["stations"] = printer.Stations
+		}
+		if printer.Width != 0 {
+			if validate.Var(printer.Width, "gte=24,lte=64") != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "width must be between 24 and 64 characters"})
+				return
+			}
+			updateObject["width"] = printer.Width
+		}
+		if printer.Enabled != nil {
+			updateObject["enabled"] = printer.Enabled
+		}
+
+		printer.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObject["updated_at"] = printer.UpdatedAt
+
+		meta, err := printerCollection.UpdateDocument(revisionContext(r), printerID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update printer"})
+			return
+		}
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func DeletePrinterByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		printerID := chi.URLParam(r, "printer_id")
+
+		meta, err := printerCollection.RemoveDocument(revisionContext(r), printerID)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to delete printer"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+// PrintTestPage queues a short ticket that shows the printer's stations.
+func PrintTestPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		printerID := chi.URLParam(r, "printer_id")
+
+		var printer model.Printer
+		_, err := printerCollection.ReadDocument(context.TODO(), printerID, &printer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch printer"})
+			return
+		}
+
+		ticket := model.KitchenTicket{Station: "TEST PAGE", Server: *printer.Name, CreatedAt: time.Now()}
+		for _, station := range printer.Stations {
+			ticket.Items = append(ticket.Items, model.KitchenTicketItem{Name: station, Quantity: 1})
+		}
+
+		var payload bytes.Buffer
+		receipt.RenderKitchenTicket(&payload, ticket, printer.Width)
+
+		key, err := queuePrintJob(printer.PrinterID, "TEST", printer.PrinterID, payload.Bytes())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to queue print job"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode([]string{key})
+	}
+}
+
+// PrintInvoiceReceipt queues the guest receipt on the given printer, or on
+// every printer of the receipt station.
+func PrintInvoiceReceipt() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID := chi.URLParam(r, "invoice_id")
+
+		var invoice model.Invoice
+		_, err := invoiceCollection.ReadDocument(context.TODO(), invoiceID, &invoice)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch invoice item"})
+			return
+		}
+
+		data, err := invoiceReceipt(invoice)
+		if err == nil {
+			locale, defaultLocale := requestLocale(r)
+			err = localizeReceipt(&data, locale, defaultLocale)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		var printers []model.Printer
+		if printerID := r.URL.Query().Get("printer_id"); printerID != "" {
+			var printer model.Printer
+			_, err = printerCollection.ReadDocument(context.TODO(), printerID, &printer)
+			printers = append(printers, printer)
+		} else {
+			printers, err = stationPrinters(receiptStation)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch printers"})
+			return
+		} else if len(printers) == 0 {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "no printer serves the receipt station"})
+			return
+		}
+
+		keys := []string{}
+		for _, printer := range printers {
+			data.Settings.Width = printer.Width
+			var payload bytes.Buffer
+			err = receipt.Render(&payload, receipt.ESCPOS, data)
+			if err == nil {
+				var key string
+				key, err = queuePrintJob(printer.PrinterID, "RECEIPT", invoice.InvoiceID, payload.Bytes())
+				keys = append(keys, key)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to queue print job"})
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+// PrintKitchenTickets sends every item of an order to the kitchen again.
+func PrintKitchenTickets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orderID := chi.URLParam(r, "order_id")
+
+		var order model.Order
+		_, err := orderCollection.ReadDocument(context.TODO(), orderID, &order)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch order item"})
+			return
+		}
+
+		query := `
+		FOR orderItem IN orderItems
+			FILTER orderItem.order_id == @order_id
+			SORT orderItem.created_at
+			RETURN orderItem`
+		cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"order_id": orderID})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		orderItems := []model.OrderItem{}
+		for {
+			var orderItem model.OrderItem
+			_, err := cursor.ReadDocument(context.TODO(), &orderItem)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read order items"})
+				return
+			}
+
+			orderItems = append(orderItems, orderItem)
+		}
+
+		keys, err := queueKitchenTickets(order, orderItems)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+// queueKitchenTickets groups order items by their station and queues one
+// ticket per station printer. Stations without a printer are skipped.
+func queueKitchenTickets(order model.Order, orderItems []model.OrderItem) ([]string, error) {
+	var table model.Table
+	_, err := tableCollection.ReadDocument(context.TODO(), *order.TableID, &table)
+	if err != nil {
+		return nil, errors.New("failed to fetch table")
+	}
+
+	tickets := make(map[string]*model.KitchenTicket)
+	stations := []string{}
+	for _, orderItem := range orderItems {
+		station := orderItem.Station
+		if station == "" {
+			station = defaultStation
+		}
+
+		ticket, ok := tickets[station]
+		if !ok {
+			ticket = &model.KitchenTicket{Station: station, OrderID: order.OrderID, TableNumber: *table.TableNumber, CreatedAt: time.Now()}
+			if order.Server != nil {
+				ticket.Server = *order.Server
+			}
+			tickets[station] = ticket
+			stations = append(stations, station)
+		}
+
+		item := model.KitchenTicketItem{Name: orderItem.FoodName, Quantity: *orderItem.Quantity}
+		for _, modifier := range orderItem.Modifiers {
+			item.Modifiers = append(item.Modifiers, modifier.Name)
+		}
+		if orderItem.SpecialInstructions != nil {
+			item.Notes = *orderItem.SpecialInstructions
+		}
+		ticket.Items = append(ticket.Items, item)
+	}
+
+	keys := []string{}
+	for _, station := range stations {
+		printers, err := stationPrinters(station)
+		if err != nil {
+			return keys, errors.New("failed to fetch printers")
+		}
+		if len(printers) == 0 {
+			log.Printf("no printer serves station %s, order %s was not printed there", station, order.OrderID)
+			continue
+		}
+
+		for _, printer := range printers {
+			var payload bytes.Buffer
+			receipt.RenderKitchenTicket(&payload, *tickets[station], printer.Width)
+
+			key, err := queuePrintJob(printer.PrinterID, "KITCHEN_TICKET", order.OrderID, payload.Bytes())
+			if err != nil {
+				return keys, errors.New("failed to queue print job")
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func stationPrinters(station string) ([]model.Printer, error) {
+	query := `
+	FOR printer IN printers
+		FILTER printer.enabled != false
+		FILTER @station IN printer.stations
+		RETURN printer`
+	cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"station": station})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	printers := []model.Printer{}
+	for {
+		var printer model.Printer
+		_, err := cursor.ReadDocument(context.TODO(), &printer)
+		if driver.IsNoMoreDocuments(err) {
+			return printers, nil
+		} else if err != nil {
+			return nil, err
+		}
+		printers = append(printers, printer)
+	}
+}
+
+func openPrinter(printerID string) (printer.Printer, error) {
+	var stored model.Printer
+	_, err := printerCollection.ReadDocument(context.TODO(), printerID, &stored)
+	if err != nil {
+		return nil, fmt.Errorf("printer %s was not found", printerID)
+	}
+	if stored.Enabled != nil && !*stored.Enabled {
+		return nil, fmt.Errorf("printer %s is disabled", printerID)
+	}
+	return printerTargets.New(*stored.Connection, *stored.Address)
+}
@@ -0,0 +1,479 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/database"
+	"main/export"
+	"main/model"
+	"main/promotion"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var promotionCollection = database.OpenCollection(db, "promotions")
+
+var errInvalidCoupon = errors.New("coupon code is not valid or has been used up")
+
+func init() {
+	database.EnsureUniqueIndex(promotionCollection, "coupon_code")
+}
+
+func GetPromotions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := "FOR promotion IN promotions SORT promotion.created_at LIMIT @limit RETURN promotion"
+		bindVars := map[string]interface{}{"limit": listLimit(format)}
+		cursor, err := db.Query(exportContext(format), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.Promotion](w, format, "promotions", cursor)
+			return
+		}
+
+		promotions := []model.Promotion{}
+		for {
+			var promotion model.Promotion
+			_, err := cursor.ReadDocument(context.TODO(), &promotion)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read promotions"})
+				return
+			}
+
+			promotions = append(promotions, promotion)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(promotions)
+	}
+}
+
+func GetPromotionByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		promotionID := chi.URLParam(r, "promotion_id")
+		var promotion model.Promotion
+
+		meta, err := promotionCollection.ReadDocument(context.TODO(), promotionID, &promotion)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": "promotion was not found"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch promotion"})
+			return
+		}
+
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(promotion)
+	}
+}
+
+func CreatePromotion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var promotion model.Promotion
+		err := json.NewDecoder(r.Body).Decode(&promotion)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(promotion)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		err = checkPromotion(promotion)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		promotion.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		promotion.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		promotion.PromotionID = uuid.NewString()
+		promotion.UsageCount = 0
+
+		meta, err := promotionCollection.CreateDocument(context.TODO(), promotion)
+		if driver.IsConflict(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "a promotion with this coupon code already exists"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to create promotion"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+// UpdatePromotionByID changes a promotion. Orders already placed keep the
+// discounts they were priced with until their items change.
+func UpdatePromotionByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		promotionID := chi.URLParam(r, "promotion_id")
+		var promotion model.Promotion
+		err := json.NewDecoder(r.Body).Decode(&promotion)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		var stored model.Promotion
+		meta, err := promotionCollection.ReadDocument(revisionContext(r), promotionID, &stored)
+		if revisionConflict(w, err) {
+			return
+		} else if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": "promotion was not found"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch promotion"})
+			return
+		}
+		// the rules depend on each other, so the changes are checked on the
+		// whole promotion
+		updateObject := make(map[string]interface{})
+
+		if promotion.Name != nil {
+			stored.Name = promotion.Name
+			updateObject["name"] = promotion.Name
+		}
+		if promotion.Type != nil {
+			stored.Type = promotion.Type
+			updateObject["type"] = promotion.Type
+		}
+		if promotion.Value != nil {
+			stored.Value = promotion.Value
+			updateObject["value"] = promotion.Value
+		}
+		if promotion.FoodIDs != nil {
+			stored.FoodIDs = promotion.FoodIDs
+			updateObject["food_ids"] = promotion.FoodIDs
+		}
+		if promotion.MenuIDs != nil {
+			stored.MenuIDs = promotion.MenuIDs
+			updateObject["menu_ids"] = promotion.MenuIDs
+		}
+		if promotion.BuyQuantity != 0 {
+			stored.BuyQuantity = promotion.BuyQuantity
+			updateObject["buy_quantity"] = promotion.BuyQuantity
+		}
+		if promotion.FreeQuantity != 0 {
+			stored.FreeQuantity = promotion.FreeQuantity
+			updateObject["free_quantity"] = promotion.FreeQuantity
+		}
+		if promotion.BundleItems != nil {
+			stored.BundleItems = promotion.BundleItems
+			updateObject["bundle_items"] = promotion.BundleItems
+		}
+		if promotion.CouponCode != nil {
+			if *promotion.CouponCode == "" {
+				promotion.CouponCode = nil
+			}
+			stored.CouponCode = promotion.CouponCode
+			updateObject["coupon_code"] = promotion.CouponCode
+		}
+		if promotion.UsageLimit != nil {
+			stored.UsageLimit = promotion.UsageLimit
+			updateObject["usage_limit"] = promotion.UsageLimit
+		}
+		if promotion.StartDate != nil {
+			stored.StartDate = promotion.StartDate
+			updateObject["start_date"] = promotion.StartDate
+		}
+		if promotion.EndDate != nil {
+			stored.EndDate = promotion.EndDate
+			updateObject["end_date"] = promotion.EndDate
+		}
+		if promotion.Timezone != "" {
+			stored.Timezone = promotion.Timezone
+			updateObject["timezone"] = promotion.Timezone
+		}
+		if promotion.Schedules != nil {
+			stored.Schedules = promotion.Schedules
+			updateObject["schedules"] = promotion.Schedules
+		}
+		if promotion.Active != nil {
+			stored.Active = promotion.Active
+			updateObject["active"] = promotion.Active
+		}
+
+		err = validate.Struct(stored)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+		err = checkPromotion(stored)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		promotion.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObject["updated_at"] = promotion.UpdatedAt
+
+		meta, err = promotionCollection.UpdateDocument(driver.WithRevision(context.TODO(), meta.Rev), promotionID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if driver.IsConflict(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "a promotion with this coupon code already exists"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update promotion"})
+			return
+		}
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func DeletePromotionByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		promotionID := chi.URLParam(r, "promotion_id")
+
+		meta, err := promotionCollection.RemoveDocument(revisionContext(r), promotionID)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to delete promotion"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+// checkPromotion validates the rules that depend on the promotion type.
+func checkPromotion(promotion model.Promotion) error {
+	switch *promotion.Type {
+	case "PERCENT":
+		if *promotion.Value <= 0 || *promotion.Value > 100 {
+			return errors.New("a percentage must be above 0 and at most 100")
+		}
+	case "FIXED":
+		if *promotion.Value <= 0 {
+			return errors.New("the amount off must be above 0")
+		}
+	case "BOGO":
+		if promotion.BuyQuantity < 1 || promotion.FreeQuantity < 1 {
+			return errors.New("buy_quantity and free_quantity must be at least 1")
+		}
+		if *promotion.Value <= 0 || *promotion.Value > 100 {
+			return errors.New("the percentage off the free items must be above 0 and at most 100")
+		}
+	case "BUNDLE":
+		units := 0.0
+		for _, item := range promotion.BundleItems {
+			units += item.Quantity
+		}
+		if units < 2 {
+			return errors.New("a bundle needs at least two items")
+		}
+	}
+	if promotion.UsageLimit != nil && promotion.CouponCode == nil {
+		return errors.New("usage limits need a coupon code")
+	}
+	if promotion.StartDate != nil && promotion.EndDate != nil && !promotion.EndDate.After(*promotion.StartDate) {
+		return errors.New("end date must be after start date")
+	}
+	if _, err := time.LoadLocation(promotion.Timezone); err != nil {
+		return errors.New("unknown timezone")
+	}
+	return nil
+}
+
+const couponQuery = `
+	FOR promotion IN promotions
+		FILTER promotion.coupon_code == @code AND promotion.active != false
+		FILTER promotion.start_date == null OR DATE_TIMESTAMP(promotion.start_date) <= @now
+		FILTER promotion.end_date == null OR DATE_TIMESTAMP(promotion.end_date) > @now
+		FILTER promotion.usage_limit == null OR promotion.usage_count < promotion.usage_limit`
+
+// checkCoupon reports errInvalidCoupon unless the coupon can still be used.
+func checkCoupon(code string) error {
+	return couponUpdate(context.TODO(), code, "RETURN promotion._key")
+}
+
+// claimCoupon counts a use of the coupon, unless its usage limit is reached.
+// It runs in the transaction that stores the order, so a coupon is only
+// counted for an order that exists.
+func claimCoupon(ctx context.Context, code string) error {
+	return couponUpdate(ctx, code, "UPDATE promotion WITH { usage_count: promotion.usage_count + 1 } IN promotions RETURN NEW._key")
+}
+
+func releaseCoupon(ctx context.Context, code string) error {
+	query := `
+	FOR promotion IN promotions
+		FILTER promotion.coupon_code == @code AND promotion.usage_count > 0
+		UPDATE promotion WITH { usage_count: promotion.usage_count - 1 } IN promotions`
+	cursor, err := db.Query(ctx, query, map[string]interface{}{"code": code})
+	if err != nil {
+		return err
+	}
+	return cursor.Close()
+}
+
+// releaseOrderCoupon gives back the coupon of an order once the order has no
+// items left, and takes it off the order so it is only given back once.
+func releaseOrderCoupon(ctx context.Context, orderID string) error {
+	query := `
+	FOR order IN orders
+		FILTER order._key == @order_id AND order.coupon_code != null
+		FILTER LENGTH(FOR orderItem IN orderItems FILTER orderItem.order_id == order._key LIMIT 1 RETURN 1) == 0
+		UPDATE order WITH { coupon_code: null } IN orders
+		RETURN OLD.coupon_code`
+	codes, err := readAll[string](ctx, query, map[string]interface{}{"order_id": orderID})
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		err = releaseCoupon(ctx, code)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func couponUpdate(ctx context.Context, code, operation string) error {
+	bindVars := map[string]interface{}{"code": code, "now": time.Now().UnixMilli()}
+	cursor, err := db.Query(ctx, couponQuery+"\n\t\t"+operation, bindVars)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+	if !cursor.HasMore() {
+		return errInvalidCoupon
+	}
+	return nil
+}
+
+// applyPromotions prices the promotions of an order and stores on each item
+// what they take off it. It runs in the transaction that changes the items
+// of the order, so the items are never stored with stale discounts.
+func applyPromotions(ctx context.Context, orderID string) error {
+	var order model.Order
+	_, err := orderCollection.ReadDocument(ctx, orderID, &order)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	FOR orderItem IN orderItems
+		FILTER orderItem.order_id == @order_id
+		SORT orderItem.created_at
+		RETURN MERGE(orderItem, { menu_id: DOCUMENT("foods", orderItem.food_id).menu_id })`
+	items, err := readAll[promotion.Item](ctx, query, map[string]interface{}{"order_id": orderID})
+	if err != nil {
+		return err
+	}
+
+	query = `
+	FOR promotion IN promotions
+		FILTER promotion.active != false
+		FILTER promotion.coupon_code == null OR promotion.coupon_code == @coupon_code
+		RETURN promotion`
+	promotions, err := readAll[model.Promotion](ctx, query, map[string]interface{}{"coupon_code": order.CouponCode})
+	if err != nil {
+		return err
+	}
+
+	for i, applied := range promotion.Evaluate(promotions, items) {
+		_, err = orderItemCollection.UpdateDocument(ctx, items[i].OrderItemID, map[string]interface{}{"promotions": applied})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderPromotionDiscounts sums the promotions of an order's items into one
+// invoice discount line per promotion.
+func orderPromotionDiscounts(orderID string) ([]model.InvoiceDiscount, error) {
+	query := `
+	FOR orderItem IN orderItems
+		FILTER orderItem.order_id == @order_id
+		FOR promotion IN NOT_NULL(orderItem.promotions, [])
+			COLLECT promotionID = promotion.promotion_id, name = promotion.name
+			AGGREGATE amount = SUM(promotion.amount)
+			SORT name
+			RETURN { discount_id: promotionID, label: name, amount: amount, source: "PROMOTION", reference: promotionID }`
+	discounts, err := readAll[model.InvoiceDiscount](context.TODO(), query, map[string]interface{}{"order_id": orderID})
+	for i := range discounts {
+		discounts[i].Amount = roundMoney(discounts[i].Amount)
+	}
+	return discounts, err
+}
+
+// promotionFailed writes the response for an error of a coupon check.
+func promotionFailed(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, errInvalidCoupon) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status{"error": err.Error()})
+		return true
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(status{"error": "failed to check coupon"})
+	return true
+}
+
+// readAll runs a query and reads every document it returns.
+func readAll[T any](ctx context.Context, query string, bindVars map[string]interface{}) ([]T, error) {
+	cursor, err := db.Query(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	documents := []T{}
+	for {
+		var document T
+		_, err := cursor.ReadDocument(ctx, &document)
+		if driver.IsNoMoreDocuments(err) {
+			return documents, nil
+		} else if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+}
@@ -0,0 +1,136 @@
+//go:build integration
+
+package controller_test
+
+import (
+	"context"
+	"main/model"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createCoupon creates a coupon for 10% off that can be used once and
+// returns its key and code.
+func createCoupon(t *testing.T) (promotionID, code string) {
+	t.Helper()
+	code = "TEST" + uuid.NewString()[:8]
+	promotionID = create(t, "/promotions", map[string]interface{}{
+		"name":        "Test coupon",
+		"type":        "PERCENT",
+		"value":       10,
+		"coupon_code": code,
+		"usage_limit": 1,
+	})
+	return promotionID, code
+}
+
+func couponUses(t *testing.T, promotionID string) int {
+	t.Helper()
+	var promotion model.Promotion
+	read(t, "promotions", promotionID, &promotion)
+	return promotion.UsageCount
+}
+
+func ordersWithCoupon(t *testing.T, code string) int {
+	t.Helper()
+	query := "RETURN LENGTH(FOR order IN orders FILTER order.coupon_code == @code RETURN 1)"
+	cursor, err := db.Query(context.Background(), query, map[string]interface{}{"code": code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+	var count int
+	if _, err := cursor.ReadDocument(context.Background(), &count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func orderWithCoupon(tableID, foodID, code string) map[string]interface{} {
+	return map[string]interface{}{
+		"table_id":    tableID,
+		"coupon_code": code,
+		"order_items": []map[string]interface{}{{"food_id": foodID, "quantity": 1}},
+	}
+}
+
+func TestCouponClaimAndRelease(t *testing.T) {
+	tableID, foodID := createFood(t, 10)
+	promotionID, code := createCoupon(t)
+
+	var created struct {
+		OrderItemIDs []string `json:"order_item_ids"`
+	}
+	if answer := call(t, http.MethodPost, "/orderItems", orderWithCoupon(tableID, foodID, code), &created); answer != http.StatusOK {
+		t.Fatalf("order with a coupon answered %d", answer)
+	}
+	var orderItem model.OrderItem
+	read(t, "orderItems", created.OrderItemIDs[0], &orderItem)
+	if uses := couponUses(t, promotionID); uses != 1 {
+		t.Fatalf("coupon was used %d times, want 1", uses)
+	}
+
+	// the usage limit is reached, so neither order is stored
+	if answer := call(t, http.MethodPost, "/orderItems", orderWithCoupon(tableID, foodID, code), nil); answer != http.StatusConflict {
+		t.Errorf("order items with a used up coupon answered %d, want 409", answer)
+	}
+	order := map[string]interface{}{"table_id": tableID, "coupon_code": code}
+	if answer := call(t, http.MethodPost, "/orders", order, nil); answer != http.StatusConflict {
+		t.Errorf("order with a used up coupon answered %d, want 409", answer)
+	}
+	if uses := couponUses(t, promotionID); uses != 1 {
+		t.Errorf("coupon was used %d times after refused orders, want 1", uses)
+	}
+	if count := ordersWithCoupon(t, code); count != 1 {
+		t.Errorf("%d orders hold the coupon, want 1", count)
+	}
+
+	// removing the last item gives the coupon back, and deleting the order
+	// afterwards does not give it back again
+	if answer := call(t, http.MethodDelete, "/orderItems/"+orderItem.OrderItemID, nil, nil); answer != http.StatusOK {
+		t.Fatalf("DELETE of the order item answered %d", answer)
+	}
+	if uses := couponUses(t, promotionID); uses != 0 {
+		t.Errorf("coupon was used %d times after its order was emptied, want 0", uses)
+	}
+	if answer := call(t, http.MethodDelete, "/orders/"+orderItem.OrderID, nil, nil); answer != http.StatusOK {
+		t.Fatalf("DELETE of the order answered %d", answer)
+	}
+	if uses := couponUses(t, promotionID); uses != 0 {
+		t.Errorf("coupon was used %d times after its order was deleted, want 0", uses)
+	}
+
+	// deleting an order gives its coupon back
+	orderID := create(t, "/orders", order)
+	if uses := couponUses(t, promotionID); uses != 1 {
+		t.Errorf("coupon was used %d times, want 1", uses)
+	}
+	if answer := call(t, http.MethodDelete, "/orders/"+orderID, nil, nil); answer != http.StatusOK {
+		t.Fatalf("DELETE of the order answered %d", answer)
+	}
+	if uses := couponUses(t, promotionID); uses != 0 {
+		t.Errorf("coupon was used %d times after its order was deleted, want 0", uses)
+	}
+}
+
+func TestFailedOrderKeepsCoupon(t *testing.T) {
+	tableID, foodID := createFood(t, 10)
+	promotionID, code := createCoupon(t)
+
+	// a sold out food fails the order after the coupon was checked
+	if answer := call(t, http.MethodPut, "/foods/"+foodID+"/availability", map[string]interface{}{"remaining_portions": 0}, nil); answer != http.StatusOK {
+		t.Fatalf("PUT of the availability answered %d", answer)
+	}
+	if answer := call(t, http.MethodPost, "/orderItems", orderWithCoupon(tableID, foodID, code), nil); answer == http.StatusOK {
+		t.Fatal("order of a sold out food was taken")
+	}
+
+	if uses := couponUses(t, promotionID); uses != 0 {
+		t.Errorf("coupon was used %d times by a failed order, want 0", uses)
+	}
+	if count := ordersWithCoupon(t, code); count != 0 {
+		t.Errorf("%d orders hold the coupon after a failed order, want 0", count)
+	}
+}
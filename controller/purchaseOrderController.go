@@ -0,0 +1,528 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"main/database"
+	"main/export"
+	"main/model"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	purchaseOrderCollection = database.OpenCollection(db, "purchaseOrders")
+	goodsReceiptCollection  = database.OpenCollection(db, "goodsReceipts")
+)
+
+// allowed manual status changes; receiving sets the received statuses
+var purchaseOrderTransitions = map[string][]string{
+	"DRAFT":              {"ORDERED", "CANCELLED"},
+	"ORDERED":            {"CANCELLED"},
+	"PARTIALLY_RECEIVED": {"RECEIVED"},
+}
+
+func GetPurchaseOrders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := `
+		FOR purchaseOrder IN purchaseOrders
+			FILTER @status == null OR purchaseOrder.status == @status
+			SORT purchaseOrder.created_at DESC
+			RETURN purchaseOrder`
+		bindVars := map[string]interface{}{"status": nil}
+		if s := r.URL.Query().Get("status"); s != "" {
+			bindVars["status"] = s
+		}
+
+		cursor, err := db.Query(exportContext(format), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.PurchaseOrder](w, format, "purchase-orders", cursor)
+			return
+		}
+
+		purchaseOrders := []model.PurchaseOrder{}
+		for {
+			var purchaseOrder model.PurchaseOrder
+			_, err := cursor.ReadDocument(context.TODO(), &purchaseOrder)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read purchase orders"})
+				return
+			}
+
+			purchaseOrders = append(purchaseOrders, purchaseOrder)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(purchaseOrders)
+	}
+}
+
+func GetPurchaseOrderByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		purchaseOrderID := chi.URLParam(r, "purchaseOrder_id")
+		var purchaseOrder model.PurchaseOrder
+
+		meta, err := purchaseOrderCollection.ReadDocument(context.TODO(), purchaseOrderID, &purchaseOrder)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch purchase order"})
+			return
+		}
+
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(purchaseOrder)
+	}
+}
+
+func CreatePurchaseOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var purchaseOrder model.PurchaseOrder
+		err := json.NewDecoder(r.Body).Decode(&purchaseOrder)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(purchaseOrder)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		var supplier model.Supplier
+		_, err = supplierCollection.ReadDocument(context.TODO(), *purchaseOrder.SupplierID, &supplier)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "supplier was not found"})
+			return
+		}
+
+		err = preparePurchaseOrderLines(purchaseOrder.Lines)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		purchaseOrderStatus := "DRAFT"
+		if purchaseOrder.Status == nil || *purchaseOrder.Status != "ORDERED" {
+			purchaseOrder.Status = &purchaseOrderStatus
+		}
+
+		purchaseOrder.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		purchaseOrder.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		purchaseOrder.PurchaseOrderID = uuid.NewString()
+
+		meta, err := purchaseOrderCollection.CreateDocument(context.TODO(), purchaseOrder)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to create purchase order"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func UpdatePurchaseOrderByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		purchaseOrderID := chi.URLParam(r, "purchaseOrder_id")
+		var purchaseOrder model.PurchaseOrder
+		err := json.NewDecoder(r.Body).Decode(&purchaseOrder)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		var storedPurchaseOrder model.PurchaseOrder
+		_, err = purchaseOrderCollection.ReadDocument(context.TODO(), purchaseOrderID, &storedPurchaseOrder)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch purchase order"})
+			return
+		}
+
+		updateObject := make(map[string]interface{})
+
+		if purchaseOrder.Lines != nil || purchaseOrder.ExpectedDate != nil {
+			if *storedPurchaseOrder.Status != "DRAFT" {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(status{"error": "only draft purchase orders can be edited"})
+				return
+			}
+		}
+		if purchaseOrder.Lines != nil {
+			err = validate.Var(purchaseOrder.Lines, "min=1,dive")
+			if err == nil {
+				err = preparePurchaseOrderLines(purchaseOrder.Lines)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "invalid purchase order lines"})
+				return
+			}
+			updateObject["lines"] = purchaseOrder.Lines
+		}
+		if purchaseOrder.ExpectedDate != nil {
+			updateObject["expected_date"] = purchaseOrder.ExpectedDate
+		}
+		if purchaseOrder.Status != nil {
+			if !purchaseOrderTransitionAllowed(*storedPurchaseOrder.Status, *purchaseOrder.Status) {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(status{"error": "purchase order status cannot change from " + *storedPurchaseOrder.Status + " to " + *purchaseOrder.Status})
+				return
+			}
+			updateObject["status"] = purchaseOrder.Status
+		}
+
+		purchaseOrder.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObject["updated_at"] = purchaseOrder.UpdatedAt
+
+		meta, err := purchaseOrderCollection.UpdateDocument(revisionContext(r), purchaseOrderID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update purchase order"})
+			return
+		}
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func DeletePurchaseOrderByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		purchaseOrderID := chi.URLParam(r, "purchaseOrder_id")
+
+		var purchaseOrder model.PurchaseOrder
+		_, err := purchaseOrderCollection.ReadDocument(context.TODO(), purchaseOrderID, &purchaseOrder)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch purchase order"})
+			return
+		}
+
+		if *purchaseOrder.Status != "DRAFT" && *purchaseOrder.Status != "CANCELLED" {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "only draft or cancelled purchase orders can be deleted"})
+			return
+		}
+
+		meta, err := purchaseOrderCollection.RemoveDocument(revisionContext(r), purchaseOrderID)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to delete purchase order"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+// ReceivePurchaseOrder books a (partial) delivery against the lines of a
+// purchase order and adds the received quantities to on-hand stock.
+func ReceivePurchaseOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		purchaseOrderID := chi.URLParam(r, "purchaseOrder_id")
+		var receipt model.GoodsReceipt
+		err := json.NewDecoder(r.Body).Decode(&receipt)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(receipt)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		var purchaseOrder model.PurchaseOrder
+		meta, err := purchaseOrderCollection.ReadDocument(context.TODO(), purchaseOrderID, &purchaseOrder)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch purchase order"})
+			return
+		}
+
+		if *purchaseOrder.Status != "ORDERED" && *purchaseOrder.Status != "PARTIALLY_RECEIVED" {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "purchase order is not awaiting delivery"})
+			return
+		}
+
+		err = applyGoodsReceipt(&purchaseOrder, receipt.Lines)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObject := map[string]interface{}{
+			"lines":      purchaseOrder.Lines,
+			"status":     purchaseOrder.Status,
+			"updated_at": now,
+		}
+
+		receipt.GoodsReceiptID = uuid.NewString()
+		receipt.PurchaseOrderID = purchaseOrderID
+		receipt.ReceivedAt = now
+
+		stockLines := []model.RecipeLine{}
+		for _, line := range receipt.Lines {
+			stockLines = append(stockLines, model.RecipeLine{IngredientID: line.IngredientID, Quantity: line.Quantity})
+		}
+
+		// the purchase order, the receipt and the stock change together, and
+		// the revision read above guards against booking the same delivery twice
+		var receiptMeta driver.DocumentMeta
+		collections := stockCollections(purchaseOrderCollection.Name(), goodsReceiptCollection.Name())
+		err = runTransaction(collections, func(ctx context.Context) error {
+			_, err := purchaseOrderCollection.UpdateDocument(driver.WithRevision(ctx, meta.Rev), purchaseOrderID, updateObject)
+			if err != nil {
+				return err
+			}
+			receiptMeta, err = goodsReceiptCollection.CreateDocument(ctx, receipt)
+			if err != nil {
+				return err
+			}
+			err = moveStock(ctx, stockLines, 1, "RECEIPT", "")
+			if err != nil {
+				return err
+			}
+			return updateIngredientCosts(ctx, receipt.Lines)
+		})
+		if driver.IsPreconditionFailed(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status{"error": "purchase order was changed while receiving, please retry"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to receive purchase order"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(receiptMeta.Key)
+	}
+}
+
+// GetReorderSuggestions proposes order quantities that bring every ingredient
+// back to its par level, taking into account what is already on order and
+// what will be used up while waiting for the supplier to deliver.
+func GetReorderSuggestions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		days := 14
+		if d := r.URL.Query().Get("days"); d != "" {
+			parsed, err := strconv.Atoi(d)
+			if err != nil || parsed <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "days must be a positive number"})
+				return
+			}
+			days = parsed
+		}
+
+		query := `
+		LET usage = (
+			FOR orderItem IN orderItems
+				FILTER orderItem.created_at >= @since
+				FOR line IN NOT_NULL(orderItem.consumption, [])
+					COLLECT ingredientID = line.ingredient_id AGGREGATE used = SUM(line.quantity)
+					RETURN { ingredientID, used }
+		)
+		LET onOrder = (
+			FOR purchaseOrder IN purchaseOrders
+				FILTER purchaseOrder.status IN ["ORDERED", "PARTIALLY_RECEIVED"]
+				FOR line IN purchaseOrder.lines
+					COLLECT ingredientID = line.ingredient_id
+					AGGREGATE outstanding = SUM(line.quantity_ordered - line.quantity_received)
+					RETURN { ingredientID, outstanding }
+		)
+		FOR ingredient IN ingredients
+			FILTER ingredient.par_level != null
+			LET supplier = ingredient.supplier_id == null ? null : DOCUMENT(suppliers, ingredient.supplier_id)
+			RETURN {
+				ingredient_id: ingredient._key,
+				name: ingredient.name,
+				unit: ingredient.unit,
+				supplier_id: NOT_NULL(ingredient.supplier_id, ""),
+				stock_on_hand: ingredient.stock_on_hand,
+				on_order: NOT_NULL(FIRST(FOR o IN onOrder FILTER o.ingredientID == ingredient._key RETURN o.outstanding), 0),
+				par_level: ingredient.par_level,
+				average_daily_usage: NOT_NULL(FIRST(FOR u IN usage FILTER u.ingredientID == ingredient._key RETURN u.used), 0) / @days,
+				lead_time_days: NOT_NULL(supplier.lead_time_days, 0)
+			}`
+		since, _ := time.Parse(time.RFC3339, time.Now().AddDate(0, 0, -days).Format(time.RFC3339))
+		bindVars := map[string]interface{}{
+			"since": since,
+			"days":  days,
+		}
+
+		cursor, err := db.Query(context.TODO(), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		suggestions := []model.ReorderSuggestion{}
+		for {
+			var suggestion model.ReorderSuggestion
+			_, err := cursor.ReadDocument(context.TODO(), &suggestion)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read reorder suggestions"})
+				return
+			}
+
+			needed := suggestion.ParLevel + suggestion.AverageDailyUsage*float64(suggestion.LeadTimeDays) -
+				suggestion.StockOnHand - suggestion.OnOrder
+			if needed <= 0 {
+				continue
+			}
+			suggestion.AverageDailyUsage = math.Round(suggestion.AverageDailyUsage*1000) / 1000
+			suggestion.SuggestedQuantity = math.Ceil(needed*1000) / 1000
+			suggestions = append(suggestions, suggestion)
+		}
+
+		if format != "" {
+			exportSlice(w, format, "reorder-suggestions", suggestions)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(suggestions)
+	}
+}
+
+func purchaseOrderTransitionAllowed(from, to string) bool {
+	for _, allowed := range purchaseOrderTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// preparePurchaseOrderLines assigns line ids, resets received quantities and
+// defaults the unit cost to the ingredient's current cost.
+func preparePurchaseOrderLines(lines []model.PurchaseOrderLine) error {
+	for i := range lines {
+		line := &lines[i]
+
+		var ingredient model.Ingredient
+		_, err := ingredientCollection.ReadDocument(context.TODO(), line.IngredientID, &ingredient)
+		if err != nil {
+			return fmt.Errorf("ingredient %s was not found", line.IngredientID)
+		}
+
+		line.LineID = uuid.NewString()
+		line.QuantityReceived = 0
+		if line.UnitCost == 0 && ingredient.CostPerUnit != nil {
+			line.UnitCost = *ingredient.CostPerUnit
+		}
+	}
+	return nil
+}
+
+// applyGoodsReceipt adds the received quantities to the purchase order lines
+// and derives the new purchase order status.
+func applyGoodsReceipt(purchaseOrder *model.PurchaseOrder, received []model.GoodsReceiptLine) error {
+	for i := range received {
+		receivedLine := &received[i]
+
+		found := false
+		for j := range purchaseOrder.Lines {
+			line := &purchaseOrder.Lines[j]
+			if line.LineID != receivedLine.LineID {
+				continue
+			}
+
+			if line.QuantityReceived+receivedLine.Quantity > line.QuantityOrdered {
+				return fmt.Errorf("line %s would receive more than was ordered", line.LineID)
+			}
+			line.QuantityReceived += receivedLine.Quantity
+			receivedLine.IngredientID = line.IngredientID
+			if receivedLine.UnitCost == nil {
+				unitCost := line.UnitCost
+				receivedLine.UnitCost = &unitCost
+			}
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("line %s is not part of this purchase order", receivedLine.LineID)
+		}
+	}
+
+	purchaseOrderStatus := "RECEIVED"
+	for _, line := range purchaseOrder.Lines {
+		if line.QuantityReceived < line.QuantityOrdered {
+			purchaseOrderStatus = "PARTIALLY_RECEIVED"
+		}
+	}
+	purchaseOrder.Status = &purchaseOrderStatus
+	return nil
+}
+
+// updateIngredientCosts folds received unit costs into each ingredient's
+// weighted average cost. It runs after the received stock has been booked.
+func updateIngredientCosts(ctx context.Context, lines []model.GoodsReceiptLine) error {
+	query := `
+	FOR line IN @lines
+		LET ingredient = DOCUMENT(ingredients, line.ingredient_id)
+		FILTER ingredient != null
+		LET previousStock = ingredient.stock_on_hand - line.quantity
+		UPDATE ingredient WITH {
+			cost_per_unit: previousStock > 0 AND ingredient.cost_per_unit != null
+				? (previousStock * ingredient.cost_per_unit + line.quantity * line.unit_cost) / ingredient.stock_on_hand
+				: line.unit_cost
+		} IN ingredients`
+
+	cursor, err := db.Query(ctx, query, map[string]interface{}{"lines": lines})
+	if err != nil {
+		return err
+	}
+	return cursor.Close()
+}
@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"main/database"
+	"main/model"
+	"main/receipt"
+	"net/http"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+)
+
+var settingsCollection = database.OpenCollection(db, "settings")
+
+const receiptSettingsKey = "receipt"
+
+func GetReceiptSettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings, err := readReceiptSettings()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch receipt settings"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+func UpdateReceiptSettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var settings model.ReceiptSettings
+		err := json.NewDecoder(r.Body).Decode(&settings)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(settings)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		// reject broken templates now rather than when a receipt is printed
+		if _, err := receipt.ParseText(settings.TextTemplate, settings.Currency, receipt.DefaultWidth); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid text template: " + err.Error()})
+			return
+		}
+		if _, err := receipt.ParseHTML(settings.HTMLTemplate, settings.Currency); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid html template: " + err.Error()})
+			return
+		}
+
+		document := struct {
+			Key string `json:"_key"`
+			model.ReceiptSettings
+		}{receiptSettingsKey, settings}
+
+		exists, err := settingsCollection.DocumentExists(context.TODO(), receiptSettingsKey)
+		if err == nil && exists {
+			_, err = settingsCollection.ReplaceDocument(context.TODO(), receiptSettingsKey, document)
+		} else if err == nil {
+			_, err = settingsCollection.CreateDocument(context.TODO(), document)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update receipt settings"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// GetInvoiceReceipt renders an invoice as html, plain text, ESC/POS or pdf.
+func GetInvoiceReceipt() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID := chi.URLParam(r, "invoice_id")
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = receipt.HTML
+		}
+		if !receipt.ValidFormat(format) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "format must be html, text, escpos or pdf"})
+			return
+		}
+
+		var invoice model.Invoice
+		_, err := invoiceCollection.ReadDocument(context.TODO(), invoiceID, &invoice)
+		if driver.IsNotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": "invoice was not found"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch invoice item"})
+			return
+		}
+
+		data, err := invoiceReceipt(invoice)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+		locale, defaultLocale := requestLocale(r)
+		err = localizeReceipt(&data, locale, defaultLocale)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to translate receipt"})
+			return
+		}
+
+		setContentLanguage(w, locale)
+		w.Header().Set("Content-Type", receipt.ContentType(format))
+		if format == receipt.PDF || format == receipt.ESCPOS {
+			extension := map[string]string{receipt.PDF: "pdf", receipt.ESCPOS: "bin"}[format]
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="receipt-%s.%s"`, invoice.InvoiceID, extension))
+		}
+		w.WriteHeader(http.StatusOK)
+
+		err = receipt.Render(w, format, data)
+		if err != nil {
+			log.Println("failed to render receipt:", err)
+		}
+	}
+}
+
+// readReceiptSettings returns the stored receipt settings, or defaults when
+// none were saved yet.
+func readReceiptSettings() (model.ReceiptSettings, error) {
+	settings := model.ReceiptSettings{RestaurantName: "Restaurant", TaxName: "Tax"}
+	_, err := settingsCollection.ReadDocument(context.TODO(), receiptSettingsKey, &settings)
+	if driver.IsNotFound(err) {
+		return settings, nil
+	}
+	return settings, err
+}
+
+// invoiceReceipt collects everything printed on the receipt of an invoice.
+func invoiceReceipt(invoice model.Invoice) (model.Receipt, error) {
+	settings, err := readReceiptSettings()
+	if err != nil {
+		return model.Receipt{}, errors.New("failed to fetch receipt settings")
+	}
+
+	var order model.Order
+	_, err = orderCollection.ReadDocument(context.TODO(), invoice.OrderID, &order)
+	if err != nil {
+		return model.Receipt{}, errors.New("failed to fetch order item")
+	}
+
+	allOrderItems, err := ItemsByOrder(invoice.OrderID)
+	if err != nil || len(allOrderItems) != 1 {
+		return model.Receipt{}, errors.New("error occured while listing order items by order id")
+	}
+	orderItems := allOrderItems[0]
+
+	data := model.Receipt{
+		Settings:      settings,
+		InvoiceID:     invoice.InvoiceID,
+		Number:        invoice.InvoiceID,
+		OrderID:       invoice.OrderID,
+		TableNumber:   orderItems.TableNumber,
+		IssuedAt:      invoice.CreatedAt,
+		Subtotal:      roundMoney(orderItems.PaymentDue),
+		Tip:           invoice.TipAmount,
+		Payments:      receiptPayments(invoice),
+		PaymentMethod: invoice.PaymentMethod,
+	}
+	if order.Server != nil {
+		data.Server = *order.Server
+	}
+	if invoice.PaymentStatus != nil {
+		data.PaymentStatus = *invoice.PaymentStatus
+	}
+	if invoice.InvoiceNumber != nil {
+		data.Number = *invoice.InvoiceNumber
+	}
+
+	// an issued invoice is reprinted exactly as it was billed
+	if invoice.Lines != nil {
+		if invoice.PaidAt != nil {
+			data.IssuedAt = *invoice.PaidAt
+		}
+		data.Subtotal = invoice.Subtotal
+		data.Total = invoice.Total
+		data.Discounts = receiptDiscounts(invoice)
+		for _, line := range invoice.Lines {
+			data.Items = append(data.Items, model.ReceiptLine{
+				FoodID:    line.FoodID,
+				Name:      line.Name,
+				Quantity:  line.Quantity,
+				UnitPrice: line.UnitPrice,
+				Total:     line.TotalPrice,
+				Modifiers: line.Modifiers,
+				Notes:     line.Notes,
+			})
+		}
+		for _, tax := range invoice.Taxes {
+			data.Taxes = append(data.Taxes, model.ReceiptTax{Label: tax.Label, Amount: tax.Amount})
+		}
+		return data, nil
+	}
+
+	for _, item := range orderItems.OrderItems {
+		line := model.ReceiptLine{
+			FoodID:    item.FoodID,
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Total:     item.TotalPrice,
+			Notes:     item.SpecialInstructions,
+		}
+		for _, modifier := range item.Modifiers {
+			line.Modifiers = append(line.Modifiers, modifier.Name)
+		}
+		for _, component := range item.ComboItems {
+			line.Modifiers = append(line.Modifiers, fmt.Sprintf("%g x %s", component.Quantity, component.Name))
+		}
+		data.Items = append(data.Items, line)
+	}
+
+	// discounts come off before tax and never below zero
+	promotions, err := orderPromotionDiscounts(invoice.OrderID)
+	if err != nil {
+		return model.Receipt{}, errors.New("failed to fetch promotions")
+	}
+	invoice.Discounts = append(promotions, invoice.Discounts...)
+	data.Discounts = receiptDiscounts(invoice)
+	data.Total = data.Subtotal
+	for _, discount := range data.Discounts {
+		data.Total -= discount.Amount
+	}
+	if data.Total < 0 {
+		data.Total = 0
+	}
+	taxable := data.Total
+	if settings.TaxRate > 0 {
+		tax := model.ReceiptTax{Label: fmt.Sprintf("%s %g%%", settings.TaxName, settings.TaxRate)}
+		if settings.PricesIncludeTax {
+			tax.Label += " incl."
+			tax.Amount = roundMoney(taxable - taxable/(1+settings.TaxRate/100))
+		} else {
+			tax.Amount = roundMoney(taxable * settings.TaxRate / 100)
+			data.Total += tax.Amount
+		}
+		data.Taxes = append(data.Taxes, tax)
+	}
+	if data.Tip != nil {
+		data.Total += *data.Tip
+	}
+	data.Total = roundMoney(data.Total)
+
+	return data, nil
+}
+
+func receiptDiscounts(invoice model.Invoice) []model.ReceiptDiscount {
+	discounts := []model.ReceiptDiscount{}
+	for _, discount := range invoice.Discounts {
+		discounts = append(discounts, model.ReceiptDiscount{Label: discount.Label, Amount: discount.Amount})
+	}
+	return discounts
+}
+
+func receiptPayments(invoice model.Invoice) []model.ReceiptPayment {
+	payments := []model.ReceiptPayment{}
+	for _, payment := range invoice.GiftCards {
+		payments = append(payments, model.ReceiptPayment{Label: "Gift card", Reference: "****" + payment.CardEnding, Amount: payment.Amount})
+	}
+	return payments
+}
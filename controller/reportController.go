@@ -0,0 +1,282 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/export"
+	"main/menuengineering"
+	"main/model"
+	"main/money"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+)
+
+// foodCostQuery expects a bound `food` variable and computes its theoretical
+// cost from the recipe, following combo components to their own recipes.
+const foodCostQuery = `
+	LET recipeLines = APPEND(
+		NOT_NULL(food.recipe, []),
+		FLATTEN(
+			FOR combo IN NOT_NULL(food.combo_items, [])
+				LET component = DOCUMENT(foods, combo.food_id)
+				RETURN (
+					FOR line IN NOT_NULL(component.recipe, [])
+						RETURN MERGE(line, { quantity: line.quantity * combo.quantity })
+				)
+		)
+	)
+	LET lineCosts = (
+		FOR line IN recipeLines
+			LET ingredient = DOCUMENT(ingredients, line.ingredient_id)
+			RETURN {
+				cost: line.quantity * NOT_NULL(ingredient.cost_per_unit, 0),
+				missing: ingredient.cost_per_unit == null
+			}
+	)
+	LET cost = SUM(lineCosts[*].cost)
+	LET missingCosts = LENGTH(recipeLines) == 0 OR LENGTH(lineCosts[* FILTER CURRENT.missing]) > 0
+`
+
+func GetFoodCosts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := `
+		FOR food IN foods
+			FILTER @menu_id == null OR food.menu_id == @menu_id
+			` + foodCostQuery + `
+			SORT food.name
+			RETURN {
+				food_id: food._key,
+				name: food.name,
+				unit_price: food.unit_price,
+				cost: cost,
+				missing_costs: missingCosts
+			}`
+		bindVars := map[string]interface{}{"menu_id": nil}
+		if menuID := r.URL.Query().Get("menu_id"); menuID != "" {
+			bindVars["menu_id"] = menuID
+		}
+
+		cursor, err := db.Query(context.TODO(), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		foodCosts := []model.FoodCost{}
+		for {
+			var foodCost model.FoodCost
+			_, err := cursor.ReadDocument(context.TODO(), &foodCost)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read food costs"})
+				return
+			}
+
+			foodCosts = append(foodCosts, completeFoodCost(foodCost))
+		}
+
+		if format != "" {
+			exportSlice(w, format, "food-costs", foodCosts)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(foodCosts)
+	}
+}
+
+func GetFoodCostByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		foodID := chi.URLParam(r, "food_id")
+
+		query := `
+		FOR food IN foods
+			FILTER food._key == @food_id
+			` + foodCostQuery + `
+			RETURN {
+				food_id: food._key,
+				name: food.name,
+				unit_price: food.unit_price,
+				cost: cost,
+				missing_costs: missingCosts
+			}`
+
+		cursor, err := db.Query(context.TODO(), query, map[string]interface{}{"food_id": foodID})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		var foodCost model.FoodCost
+		_, err = cursor.ReadDocument(context.TODO(), &foodCost)
+		if driver.IsNoMoreDocuments(err) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(status{"error": "food was not found"})
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to read food cost"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(completeFoodCost(foodCost))
+	}
+}
+
+// GetMenuEngineeringReport classifies foods into stars, plowhorses, puzzles
+// and dogs by comparing their sales mix and contribution margin with the
+// averages over the requested period.
+func GetMenuEngineeringReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		from, to, err := parseReportRange(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		query := `
+		FOR food IN foods
+			FILTER @menu_id == null OR food.menu_id == @menu_id
+			` + foodCostQuery + `
+			LET sales = FIRST(
+				FOR orderItem IN orderItems
+					FILTER orderItem.food_id == food._key
+					FILTER DATE_TIMESTAMP(orderItem.created_at) >= @from
+					FILTER DATE_TIMESTAMP(orderItem.created_at) < @to
+					COLLECT AGGREGATE sold = SUM(orderItem.quantity), revenue = SUM(orderItem.total_price)
+					RETURN { sold, revenue }
+			)
+			RETURN {
+				food_id: food._key,
+				name: food.name,
+				unit_price: food.unit_price,
+				cost: cost,
+				missing_costs: missingCosts,
+				quantity_sold: NOT_NULL(sales.sold, 0),
+				revenue: NOT_NULL(sales.revenue, 0)
+			}`
+		bindVars := map[string]interface{}{
+			"menu_id": nil,
+			"from":    from.UnixMilli(),
+			"to":      to.UnixMilli(),
+		}
+		if menuID := r.URL.Query().Get("menu_id"); menuID != "" {
+			bindVars["menu_id"] = menuID
+		}
+
+		cursor, err := db.Query(context.TODO(), query, bindVars)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		report := model.MenuEngineeringReport{From: from, To: to, Items: []model.MenuEngineeringItem{}}
+		for {
+			var item model.MenuEngineeringItem
+			_, err := cursor.ReadDocument(context.TODO(), &item)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read menu engineering items"})
+				return
+			}
+
+			item.FoodCost = completeFoodCost(item.FoodCost)
+			report.Items = append(report.Items, item)
+		}
+
+		menuengineering.Classify(&report)
+
+		if format != "" {
+			exportSlice(w, format, "menu-engineering", report.Items)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+func completeFoodCost(foodCost model.FoodCost) model.FoodCost {
+	foodCost.Cost = roundMoney(foodCost.Cost)
+	foodCost.Margin = roundMoney(foodCost.UnitPrice - foodCost.Cost)
+	if foodCost.UnitPrice > 0 {
+		foodCost.MarginPercent = math.Round(foodCost.Margin/foodCost.UnitPrice*10000) / 100
+	}
+	return foodCost
+}
+
+// parseReportRange reads the from/to query parameters as dates or RFC3339
+// timestamps in the timezone given by tz. A date in `to` includes that whole
+// day. Without parameters the last 30 days are reported.
+func parseReportRange(r *http.Request) (time.Time, time.Time, error) {
+	location, err := reportLocation(r.URL.Query().Get("tz"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("unknown timezone")
+	}
+
+	now := time.Now().In(location)
+	to := now
+	from := now.AddDate(0, 0, -30)
+
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = parseReportTime(value, location, false)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be a date or an RFC3339 timestamp")
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = parseReportTime(value, location, true)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be a date or an RFC3339 timestamp")
+		}
+	}
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, errors.New("to must be after from")
+	}
+
+	return from, to, nil
+}
+
+// reportLocation loads the timezone of a report. "Local" is refused because
+// the database, which groups by the same timezone, only knows IANA names.
+func reportLocation(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, errors.New("unknown timezone")
+	}
+	return time.LoadLocation(name)
+}
+
+func parseReportTime(value string, location *time.Location, endOfDay bool) (time.Time, error) {
+	if day, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		if endOfDay {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func roundMoney(amount float64) float64 {
+	return money.Round(amount)
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/arangodb/go-driver"
+)
+
+// Only single documents carry an ETag. A list is put together from many
+// documents and has no revision of its own, so list endpoints answer without
+// an ETag and ignore If-None-Match; clients holding a list revalidate the
+// documents in it one by one.
+
+// writeETag sets the ETag header from a document revision and answers with
+// 304 Not Modified when the client already holds that revision.
+func writeETag(w http.ResponseWriter, r *http.Request, rev string) bool {
+	setETag(w, rev)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !matchesRevision(header, rev) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+func setETag(w http.ResponseWriter, rev string) {
+	w.Header().Set("ETag", `"`+rev+`"`)
+}
+
+// derivedETag is the ETag of a response that also shows other documents:
+// the revision of the document itself followed by a digest of the revisions
+// of the others. ArangoDB revisions never contain a dot, so revisionContext
+// can cut the digest off again.
+func derivedETag(rev string, revs []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(revs, ",")))
+	return rev + "." + hex.EncodeToString(sum[:8])
+}
+
+// localizedETag tells the translations of one revision apart the same way.
+func localizedETag(rev, locale string) string {
+	return rev + "." + locale
+}
+
+// revisionContext turns an If-Match header into a driver context so that
+// ArangoDB rejects the write when the document was changed in the meantime.
+func revisionContext(r *http.Request) context.Context {
+	return withIfMatch(context.TODO(), r)
+}
+
+// withIfMatch adds the revision of an If-Match header to ctx, for writes that
+// run inside a transaction.
+func withIfMatch(ctx context.Context, r *http.Request) context.Context {
+	for _, tag := range strings.Split(r.Header.Get("If-Match"), ",") {
+		rev, _, _ := strings.Cut(parseETag(tag), ".")
+		if rev != "" && rev != "*" {
+			return driver.WithRevision(ctx, rev)
+		}
+	}
+
+	return ctx
+}
+
+// revisionConflict writes 412 Precondition Failed when err was caused by a
+// stale If-Match revision.
+func revisionConflict(w http.ResponseWriter, err error) bool {
+	if !driver.IsPreconditionFailed(err) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(status{"error": "document was modified by another request"})
+	return true
+}
+
+func matchesRevision(header, rev string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		parsed := parseETag(tag)
+		if parsed == "*" || parsed == rev {
+			return true
+		}
+	}
+	return false
+}
+
+func parseETag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	tag = strings.TrimPrefix(tag, "W/")
+	return strings.Trim(tag, `"`)
+}
@@ -0,0 +1,437 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"main/export"
+	"main/model"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arangodb/go-driver"
+)
+
+// reportOrdersQuery collects the orders placed between @from and @to together
+// with their items, table, local order time in @tz, total and covers. Totals
+// are net of promotions, invoice discounts and credit notes; paid invoices
+// repeat the promotions of the items, so those lines are skipped. Credit notes
+// count against the order they were issued for, not the day they were issued.
+// Replaced invoices are left out because their reissue credits them in full.
+// For the food and menu rows each item carries its own promotions and a
+// share of the invoice discounts and of the credit notes without lines in
+// proportion to its price; credited lines are scaled to the subtotal of their
+// credit note. That way the item rows add up to the order totals.
+const reportOrdersQuery = `
+	LET reportOrders = (
+		FOR order IN orders
+			FILTER DATE_TIMESTAMP(order.order_date) >= @from
+			FILTER DATE_TIMESTAMP(order.order_date) < @to
+			LET items = (
+				FOR orderItem IN orderItems
+					FILTER orderItem.order_id == order._key
+					RETURN orderItem
+			)
+			LET orderInvoices = (
+				FOR invoice IN invoices
+					FILTER invoice.order_id == order._key AND invoice.replaced_by == null
+					RETURN invoice
+			)
+			LET credits = (
+				FOR note IN creditNotes
+					FILTER note.invoice_id IN orderInvoices[*]._key
+					RETURN note
+			)
+			LET promotions = FLATTEN(items[*].promotions)[* FILTER CURRENT != null]
+			LET invoiceDiscounts = FLATTEN(orderInvoices[*].discounts)[* FILTER CURRENT != null AND CURRENT.source != "PROMOTION"]
+			LET discounts = APPEND(promotions, invoiceDiscounts)
+			LET creditedItems = (
+				FOR note IN credits
+					LET lines = NOT_NULL(note.lines, [])
+					LET linesTotal = SUM(lines[*].total_price)
+					FOR line IN lines
+						RETURN {
+							food_id: line.food_id,
+							quantity: -line.quantity,
+							revenue: linesTotal > 0 ? -line.total_price * note.subtotal / linesTotal : 0
+						}
+			)
+			LET afterPromotions = SUM(items[*].total_price) - SUM(promotions[*].amount)
+			LET spread = SUM(invoiceDiscounts[*].amount) + SUM(credits[* FILTER LENGTH(CURRENT.lines) == 0].subtotal)
+			LET itemShare = afterPromotions > 0 ? (afterPromotions - spread) / afterPromotions : 0
+			LET table = DOCUMENT(tables, order.table_id)
+			RETURN {
+				order: order,
+				items: items[* RETURN MERGE(CURRENT, {
+					revenue: (CURRENT.total_price - SUM(NOT_NULL(CURRENT.promotions, [])[*].amount)) * itemShare
+				})],
+				creditedItems: creditedItems,
+				table: table,
+				local: DATE_UTCTOLOCAL(order.order_date, @tz),
+				total: SUM(items[*].total_price) - SUM(discounts[*].amount) - SUM(credits[*].subtotal),
+				discounted: SUM(discounts[*].amount),
+				credited: SUM(credits[*].subtotal),
+				itemsSold: SUM(items[*].quantity) + SUM(creditedItems[*].quantity),
+				covers: NOT_NULL(order.number_of_guest, table.number_of_guest, 0)
+			}
+	)
+`
+
+type salesDimension struct {
+	itemLevel bool
+	key       string
+	label     string
+}
+
+// sales report groupings; item level groupings split orders into their items
+var salesDimensions = map[string]salesDimension{
+	"day":     {false, `DATE_FORMAT(reportOrder.local, "%yyyy-%mm-%dd")`, `key`},
+	"hour":    {false, `DATE_HOUR(reportOrder.local)`, `key`},
+	"weekday": {false, `DATE_DAYOFWEEK(reportOrder.local)`, `key`},
+	"table":   {false, `reportOrder.order.table_id`, `TO_STRING(NOT_NULL(DOCUMENT(tables, key).table_number, key))`},
+	"server":  {false, `NOT_NULL(reportOrder.order.server, "")`, `key`},
+	"food":    {true, `orderItem.food_id`, `NOT_NULL(DOCUMENT(foods, key).name, key)`},
+	"menu":    {true, `DOCUMENT(foods, orderItem.food_id).menu_id`, `NOT_NULL(DOCUMENT(menus, key).name, key)`},
+}
+
+func GetSalesReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		from, to, err := parseReportRange(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		groupBy := r.URL.Query().Get("group_by")
+		if groupBy == "" {
+			groupBy = "day"
+		}
+		if _, ok := salesDimensions[groupBy]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "group_by must be one of day, hour, weekday, table, server, food or menu"})
+			return
+		}
+
+		rows, err := salesRows(groupBy, from, to, reportTimezone(r))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+
+		if format != "" {
+			exportSlice(w, format, "sales-by-"+groupBy, rows)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(model.SalesReport{From: from, To: to, GroupBy: groupBy, Rows: rows})
+	}
+}
+
+func GetSalesSummary() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		from, to, err := parseReportRange(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		summary, err := salesSummary(from, to, reportTimezone(r))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+
+		if format != "" {
+			exportSlice(w, format, "sales-summary", []model.SalesSummary{summary})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(summary)
+	}
+}
+
+func GetPaymentMethodReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		from, to, err := parseReportRange(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": err.Error()})
+			return
+		}
+
+		shares, err := paymentMethodShares(from, to, reportTimezone(r))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+
+		if format != "" {
+			exportSlice(w, format, "payment-methods", shares)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(shares)
+	}
+}
+
+// GetZReport closes a business day: totals, payment mix, invoice state and
+// breakdowns by food and server for the given date in the given timezone.
+func GetZReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		timezone := reportTimezone(r)
+		location, err := reportLocation(timezone)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "unknown timezone"})
+			return
+		}
+
+		businessDate := r.URL.Query().Get("date")
+		if businessDate == "" {
+			businessDate = time.Now().In(location).Format("2006-01-02")
+		}
+		from, err := time.ParseInLocation("2006-01-02", businessDate, location)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "date must be formatted as YYYY-MM-DD"})
+			return
+		}
+		to := from.AddDate(0, 0, 1)
+
+		summary, err := salesSummary(from, to, timezone)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+
+		report := model.ZReport{SalesSummary: summary, BusinessDate: businessDate, Timezone: timezone}
+
+		report.Foods, err = salesRows("food", from, to, timezone)
+		if err == nil {
+			report.Servers, err = salesRows("server", from, to, timezone)
+		}
+		if err == nil {
+			err = readZReportTotals(&report, from, to, timezone)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+
+		report.GeneratedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		if format != "" {
+			exportSlice(w, format, "z-report-"+businessDate, []model.ZReport{report})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+func salesRows(groupBy string, from, to time.Time, timezone string) ([]model.SalesReportRow, error) {
+	dimension := salesDimensions[groupBy]
+
+	query := reportOrdersQuery
+	if dimension.itemLevel {
+		query += `
+		FOR reportOrder IN reportOrders
+			FOR orderItem IN APPEND(reportOrder.items, reportOrder.creditedItems)
+				COLLECT key = ` + dimension.key + `
+				AGGREGATE orderCount = COUNT_DISTINCT(reportOrder.order._key),
+					itemsSold = SUM(orderItem.quantity),
+					revenue = SUM(orderItem.revenue)
+				SORT revenue DESC
+				RETURN { key: TO_STRING(key), label: TO_STRING(` + dimension.label + `), orders: orderCount, items_sold: itemsSold, revenue: revenue, covers: 0 }`
+	} else {
+		query += `
+		FOR reportOrder IN reportOrders
+			COLLECT key = ` + dimension.key + `
+			AGGREGATE orderCount = LENGTH(1),
+				itemsSold = SUM(reportOrder.itemsSold),
+				revenue = SUM(reportOrder.total),
+				covers = SUM(reportOrder.covers)
+			SORT key
+			RETURN { key: TO_STRING(key), label: TO_STRING(` + dimension.label + `), orders: orderCount, items_sold: itemsSold, revenue: revenue, covers: covers }`
+	}
+
+	cursor, err := db.Query(context.TODO(), query, reportBindVars(from, to, timezone))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	rows := []model.SalesReportRow{}
+	for {
+		var row model.SalesReportRow
+		_, err := cursor.ReadDocument(context.TODO(), &row)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		row.Revenue = roundMoney(row.Revenue)
+		if row.Orders > 0 {
+			row.AverageCheck = roundMoney(row.Revenue / float64(row.Orders))
+		}
+		row.Label = salesRowLabel(groupBy, row.Label)
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func salesSummary(from, to time.Time, timezone string) (model.SalesSummary, error) {
+	summary := model.SalesSummary{From: from, To: to}
+
+	query := reportOrdersQuery + `
+	RETURN {
+		orders: LENGTH(reportOrders),
+		items_sold: NOT_NULL(SUM(reportOrders[*].itemsSold), 0),
+		revenue: NOT_NULL(SUM(reportOrders[*].total), 0),
+		discounted: NOT_NULL(SUM(reportOrders[*].discounted), 0),
+		credited: NOT_NULL(SUM(reportOrders[*].credited), 0),
+		covers: NOT_NULL(SUM(reportOrders[*].covers), 0)
+	}`
+
+	cursor, err := db.Query(context.TODO(), query, reportBindVars(from, to, timezone))
+	if err != nil {
+		return summary, err
+	}
+	defer cursor.Close()
+
+	_, err = cursor.ReadDocument(context.TODO(), &summary)
+	if err != nil {
+		return summary, err
+	}
+
+	summary.Revenue = roundMoney(summary.Revenue)
+	summary.Discounted = roundMoney(summary.Discounted)
+	summary.Credited = roundMoney(summary.Credited)
+	if summary.Orders > 0 {
+		summary.AverageCheck = roundMoney(summary.Revenue / float64(summary.Orders))
+	}
+	if summary.Covers > 0 {
+		summary.RevenuePerCover = roundMoney(summary.Revenue / float64(summary.Covers))
+	}
+
+	summary.PaymentMethods, err = paymentMethodShares(from, to, timezone)
+	return summary, err
+}
+
+func paymentMethodShares(from, to time.Time, timezone string) ([]model.PaymentMethodShare, error) {
+	query := reportOrdersQuery + `
+	FOR reportOrder IN reportOrders
+		FOR invoice IN invoices
+			FILTER invoice.order_id == reportOrder.order._key AND invoice.replaced_by == null
+			LET method = invoice.payment_method == null OR invoice.payment_method == "" ? "UNSPECIFIED" : invoice.payment_method
+			COLLECT paymentMethod = method
+			AGGREGATE invoiceCount = LENGTH(1), amount = SUM(reportOrder.total)
+			SORT amount DESC
+			RETURN { payment_method: paymentMethod, invoices: invoiceCount, amount: amount }`
+
+	cursor, err := db.Query(context.TODO(), query, reportBindVars(from, to, timezone))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	shares := []model.PaymentMethodShare{}
+	var total float64
+	for {
+		var share model.PaymentMethodShare
+		_, err := cursor.ReadDocument(context.TODO(), &share)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		share.Amount = roundMoney(share.Amount)
+		total += share.Amount
+		shares = append(shares, share)
+	}
+
+	for i := range shares {
+		if total > 0 {
+			shares[i].Percent = roundMoney(shares[i].Amount / total * 100)
+		}
+	}
+	return shares, nil
+}
+
+func readZReportTotals(report *model.ZReport, from, to time.Time, timezone string) error {
+	query := reportOrdersQuery + `
+	LET invoiceStates = (
+		FOR reportOrder IN reportOrders
+			LET invoice = FIRST(FOR invoice IN invoices FILTER invoice.order_id == reportOrder.order._key AND invoice.replaced_by == null RETURN invoice)
+			RETURN invoice == null ? "NONE" : invoice.payment_status
+	)
+	RETURN {
+		first_order_at: FIRST(FOR reportOrder IN reportOrders SORT reportOrder.order.order_date RETURN reportOrder.order.order_date),
+		last_order_at: FIRST(FOR reportOrder IN reportOrders SORT reportOrder.order.order_date DESC RETURN reportOrder.order.order_date),
+		paid_invoices: LENGTH(invoiceStates[* FILTER CURRENT == "PAID"]),
+		open_invoices: LENGTH(invoiceStates[* FILTER CURRENT != "PAID" AND CURRENT != "NONE"]),
+		uninvoiced_orders: LENGTH(invoiceStates[* FILTER CURRENT == "NONE"])
+	}`
+
+	cursor, err := db.Query(context.TODO(), query, reportBindVars(from, to, timezone))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	_, err = cursor.ReadDocument(context.TODO(), report)
+	return err
+}
+
+func reportBindVars(from, to time.Time, timezone string) map[string]interface{} {
+	return map[string]interface{}{
+		"from": from.UnixMilli(),
+		"to":   to.UnixMilli(),
+		"tz":   timezone,
+	}
+}
+
+func reportTimezone(r *http.Request) string {
+	if timezone := r.URL.Query().Get("tz"); timezone != "" {
+		return timezone
+	}
+	return "UTC"
+}
+
+func salesRowLabel(groupBy, label string) string {
+	switch groupBy {
+	case "weekday":
+		day, err := strconv.Atoi(label)
+		if err == nil && day >= 0 && day < 7 {
+			return time.Weekday(day).String()
+		}
+	case "hour":
+		hour, err := strconv.Atoi(label)
+		if err == nil {
+			return time.Date(0, 1, 1, hour, 0, 0, 0, time.UTC).Format("15:04")
+		}
+	case "server":
+		if label == "" {
+			return "unassigned"
+		}
+	}
+	return label
+}
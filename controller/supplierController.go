@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"main/database"
+	"main/export"
+	"main/model"
+	"net/http"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var supplierCollection = database.OpenCollection(db, "suppliers")
+
+func GetSuppliers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := export.Negotiate(r)
+		query := "FOR supplier IN suppliers SORT supplier.name RETURN supplier"
+		cursor, err := db.Query(exportContext(format), query, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
+			return
+		}
+		defer cursor.Close()
+
+		if format != "" {
+			exportCursor[model.Supplier](w, format, "suppliers", cursor)
+			return
+		}
+
+		suppliers := []model.Supplier{}
+		for {
+			var supplier model.Supplier
+			_, err := cursor.ReadDocument(context.TODO(), &supplier)
+
+			if driver.IsNoMoreDocuments(err) {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(status{"error": "failed to read suppliers"})
+				return
+			}
+
+			suppliers = append(suppliers, supplier)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(suppliers)
+	}
+}
+
+func GetSupplierByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		supplierID := chi.URLParam(r, "supplier_id")
+		var supplier model.Supplier
+
+		meta, err := supplierCollection.ReadDocument(context.TODO(), supplierID, &supplier)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to fetch supplier"})
+			return
+		}
+
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(supplier)
+	}
+}
+
+func CreateSupplier() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var supplier model.Supplier
+		err := json.NewDecoder(r.Body).Decode(&supplier)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		err = validate.Struct(supplier)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "failed to validate json:"})
+			return
+		}
+
+		supplier.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		supplier.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		supplier.SupplierID = uuid.NewString()
+
+		meta, err := supplierCollection.CreateDocument(context.TODO(), supplier)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to create supplier"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func UpdateSupplierByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		supplierID := chi.URLParam(r, "supplier_id")
+		var supplier model.Supplier
+		err := json.NewDecoder(r.Body).Decode(&supplier)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(status{"error": "invalid json format:"})
+			return
+		}
+
+		updateObject := make(map[string]interface{})
+
+		if supplier.Name != nil {
+			updateObject["name"] = supplier.Name
+		}
+		if supplier.ContactName != nil {
+			updateObject["contact_name"] = supplier.ContactName
+		}
+		if supplier.Phone != nil {
+			updateObject["phone"] = supplier.Phone
+		}
+		if supplier.Email != nil {
+			if validate.Var(*supplier.Email, "email") != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(status{"error": "invalid email address"})
+				return
+			}
+			updateObject["email"] = supplier.Email
+		}
+		if supplier.LeadTimeDays != nil {
+			updateObject["lead_time_days"] = supplier.LeadTimeDays
+		}
+
+		supplier.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObject["updated_at"] = supplier.UpdatedAt
+
+		meta, err := supplierCollection.UpdateDocument(revisionContext(r), supplierID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to update supplier"})
+			return
+		}
+
+		setETag(w, meta.Rev)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
+
+func DeleteSupplierByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		supplierID := chi.URLParam(r, "supplier_id")
+
+		meta, err := supplierCollection.RemoveDocument(revisionContext(r), supplierID)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(status{"error": "failed to delete supplier"})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(meta.Key)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"main/database"
+	"main/export"
 	"main/model"
 	"net/http"
 	"time"
@@ -17,8 +18,10 @@ var tableCollection = database.OpenCollection(db, "tables")
 
 func GetTables() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		query := "FOR table IN tables LIMIT 10 RETURN table"
-		cursor, err := db.Query(context.TODO(), query, nil)
+		format := export.Negotiate(r)
+		query := "FOR table IN tables LIMIT @limit RETURN table"
+		bindVars := map[string]interface{}{"limit": listLimit(format)}
+		cursor, err := db.Query(exportContext(format), query, bindVars)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to execute query"})
@@ -26,6 +29,11 @@ func GetTables() http.HandlerFunc {
 		}
 		defer cursor.Close()
 
+		if format != "" {
+			exportCursor[model.Table](w, format, "tables", cursor)
+			return
+		}
+
 		tables := []model.Table{}
 		for {
 			var table model.Table
@@ -52,13 +60,17 @@ func GetTableByID() http.HandlerFunc {
 		tableID := chi.URLParam(r, "table_id")
 		var table model.Table
 
-		_, err := tableCollection.ReadDocument(context.TODO(), tableID, &table)
+		meta, err := tableCollection.ReadDocument(context.TODO(), tableID, &table)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to fetch table item"})
 			return
 		}
 
+		if writeETag(w, r, meta.Rev) {
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(table)
 	}
@@ -120,13 +132,16 @@ func UpdateTableByID() http.HandlerFunc {
 		table.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObject["updated_at"] = table.UpdatedAt
 
-		meta, err := tableCollection.UpdateDocument(context.TODO(), tableID, updateObject)
-		if err != nil {
+		meta, err := tableCollection.UpdateDocument(revisionContext(r), tableID, updateObject)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to update table item"})
 			return
 		}
 
+		setETag(w, meta.Rev)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(meta.Key)
 	}
@@ -136,8 +151,10 @@ func DeleteTableByID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		tableID := chi.URLParam(r, "table_id")
 
-		meta, err := tableCollection.RemoveDocument(context.TODO(), tableID)
-		if err != nil {
+		meta, err := tableCollection.RemoveDocument(revisionContext(r), tableID)
+		if revisionConflict(w, err) {
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(status{"error": "failed to delete table item"})
 			return
@@ -69,3 +69,29 @@ func OpenCollection(db driver.Database, collectionName string) driver.Collection
 
 	return col
 }
+
+func EnsureTTLIndex(col driver.Collection, field string, expireAfter int) {
+	_, _, err := col.EnsureTTLIndex(context.TODO(), field, expireAfter, nil)
+	if err != nil {
+		log.Fatal("Failed to create ttl index:", err)
+	}
+}
+
+func EnsureUniqueIndex(col driver.Collection, field string) {
+	_, _, err := col.EnsurePersistentIndex(context.TODO(), []string{field}, &driver.EnsurePersistentIndexOptions{
+		Unique: true,
+		Sparse: true,
+	})
+	if err != nil {
+		log.Fatal("Failed to create unique index:", err)
+	}
+}
+
+func EnsurePersistentIndex(col driver.Collection, field string) {
+	_, _, err := col.EnsurePersistentIndex(context.TODO(), []string{field}, &driver.EnsurePersistentIndexOptions{
+		Sparse: true,
+	})
+	if err != nil {
+		log.Fatal("Failed to create persistent index:", err)
+	}
+}
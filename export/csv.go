@@ -0,0 +1,76 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type csvWriter struct {
+	writer  *csv.Writer
+	columns []column
+}
+
+func newCSVWriter(w io.Writer, columns []column) (*csvWriter, error) {
+	writer := csv.NewWriter(w)
+
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.name
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &csvWriter{writer: writer, columns: columns}, nil
+}
+
+func (c *csvWriter) Write(row interface{}) error {
+	value := rowValue(row)
+
+	record := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		record[i] = csvCell(cellValue(value, col))
+	}
+	if err := c.writer.Write(record); err != nil {
+		return err
+	}
+
+	// flush every row so that large exports stream instead of buffering
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// csvCell prefixes text that a spreadsheet would run as a formula, such as a
+// food named "=HYPERLINK(...)", with a quote. Numbers are left alone so that
+// negative amounts stay numbers.
+func csvCell(cell interface{}) string {
+	if text, ok := cell.(string); ok && text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return formatCell(cell)
+}
+
+func formatCell(cell interface{}) string {
+	switch v := cell.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		cell interface{}
+		want string
+	}{
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+1+1", "'+1+1"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1:A2)", "'@SUM(A1:A2)"},
+		{"\t=1+1", "'\t=1+1"},
+		{"\r=1+1", "'\r=1+1"},
+		{"Pad Thai", "Pad Thai"},
+		{"a=b", "a=b"},
+		{"", ""},
+		{nil, ""},
+		{int64(-12), "-12"},
+		{float64(-4.5), "-4.5"},
+		{uint64(7), "7"},
+		{true, "true"},
+	}
+	for _, test := range tests {
+		if got := csvCell(test.cell); got != test.want {
+			t.Errorf("csvCell(%#v) = %q, want %q", test.cell, got, test.want)
+		}
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	type row struct {
+		Name  string   `json:"name"`
+		Price float64  `json:"price"`
+		Tags  []string `json:"tags"`
+	}
+
+	var buf bytes.Buffer
+	writer, err := NewWriter(&buf, CSV, reflect.TypeOf(row{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []row{
+		{Name: "=cmd", Price: -2.5, Tags: []string{"vegan"}},
+		{Name: "Soup"},
+	}
+	for _, r := range rows {
+		if err := writer.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "price", "tags"},
+		{"'=cmd", "-2.5", `["vegan"]`},
+		{"Soup", "0", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %q, want %q", records, want)
+	}
+}
@@ -0,0 +1,169 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+	XLSX   = "xlsx"
+)
+
+var contentTypes = map[string]string{
+	CSV:    "text/csv",
+	NDJSON: "application/x-ndjson",
+	XLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Writer writes rows of a single struct type in an export format.
+type Writer interface {
+	Write(row interface{}) error
+	Close() error
+}
+
+// Negotiate picks an export format from the format query parameter or the
+// Accept header. It returns an empty string when plain JSON was requested.
+func Negotiate(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := contentTypes[format]; ok {
+			return format
+		}
+		return ""
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		for format, contentType := range contentTypes {
+			if mediaType == contentType {
+				return format
+			}
+		}
+	}
+	return ""
+}
+
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// NewWriter starts an export of rows of the given struct type. Columns
+// follow the order of the struct fields and are named after their json tags.
+func NewWriter(w io.Writer, format string, rowType reflect.Type) (Writer, error) {
+	for rowType.Kind() == reflect.Pointer {
+		rowType = rowType.Elem()
+	}
+	if rowType.Kind() != reflect.Struct {
+		return nil, errors.New("export rows must be structs")
+	}
+
+	switch format {
+	case CSV:
+		return newCSVWriter(w, columnsOf(rowType))
+	case NDJSON:
+		return newNDJSONWriter(w), nil
+	case XLSX:
+		return newXLSXWriter(w, columnsOf(rowType))
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+type column struct {
+	name  string
+	index []int
+}
+
+func columnsOf(rowType reflect.Type) []column {
+	columns := []column{}
+
+	for i := 0; i < rowType.NumField(); i++ {
+		field := rowType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for _, embedded := range columnsOf(field.Type) {
+				embedded.index = append([]int{i}, embedded.index...)
+				columns = append(columns, embedded)
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, column{name: name, index: []int{i}})
+	}
+
+	return columns
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// cellValue flattens a struct field into a scalar: pointers are followed,
+// times are formatted as RFC3339 and composite values become JSON text.
+func cellValue(row reflect.Value, col column) interface{} {
+	value := row.FieldByIndex(col.index)
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	if value.Type() == timeType {
+		t := value.Interface().(time.Time)
+		if t.IsZero() {
+			return nil
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return value.Uint()
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	case reflect.Slice, reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+	}
+
+	encoded, err := json.Marshal(value.Interface())
+	if err != nil {
+		return nil
+	}
+	return string(encoded)
+}
+
+func rowValue(row interface{}) reflect.Value {
+	value := reflect.ValueOf(row)
+	for value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+	return value
+}
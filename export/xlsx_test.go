@@ -0,0 +1,157 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Ref   string     `xml:"r,attr"`
+		Cells []xlsxCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readSheet(t *testing.T, data []byte) xlsxSheet {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	var sheet xlsxSheet
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+		if file.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := xml.Unmarshal(content, &sheet); err != nil {
+			t.Fatalf("sheet is not valid XML: %v", err)
+		}
+	}
+
+	want := []string{
+		"[Content_Types].xml",
+		"_rels/.rels",
+		"xl/workbook.xml",
+		"xl/_rels/workbook.xml.rels",
+		"xl/worksheets/sheet1.xml",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("archive parts = %q, want %q", names, want)
+	}
+	return sheet
+}
+
+func TestXLSXWriterRoundTrip(t *testing.T) {
+	type row struct {
+		Name      string     `json:"name"`
+		Quantity  int        `json:"quantity"`
+		Price     float64    `json:"price"`
+		Active    bool       `json:"active"`
+		Note      *string    `json:"note"`
+		CreatedAt time.Time  `json:"created_at"`
+		Tags      []string   `json:"tags"`
+		Ignored   string     `json:"-"`
+		DeletedAt *time.Time `json:"deleted_at"`
+	}
+
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	note := "<b>&\"hot\"</b>"
+	var buf bytes.Buffer
+	writer, err := NewWriter(&buf, XLSX, reflect.TypeOf(&row{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []row{
+		{Name: "=Curry", Quantity: 3, Price: -1.25, Active: true, Note: &note, CreatedAt: created, Tags: []string{"spicy"}, Ignored: "x"},
+		{Name: "Rice"},
+	}
+	for _, r := range rows {
+		if err := writer.Write(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sheet := readSheet(t, buf.Bytes())
+	want := [][]xlsxCell{
+		{
+			{Ref: "A1", Type: "inlineStr", Inline: "name"},
+			{Ref: "B1", Type: "inlineStr", Inline: "quantity"},
+			{Ref: "C1", Type: "inlineStr", Inline: "price"},
+			{Ref: "D1", Type: "inlineStr", Inline: "active"},
+			{Ref: "E1", Type: "inlineStr", Inline: "note"},
+			{Ref: "F1", Type: "inlineStr", Inline: "created_at"},
+			{Ref: "G1", Type: "inlineStr", Inline: "tags"},
+			{Ref: "H1", Type: "inlineStr", Inline: "deleted_at"},
+		},
+		{
+			{Ref: "A2", Type: "inlineStr", Inline: "=Curry"},
+			{Ref: "B2", Value: "3"},
+			{Ref: "C2", Value: "-1.25"},
+			{Ref: "D2", Type: "b", Value: "1"},
+			{Ref: "E2", Type: "inlineStr", Inline: note},
+			{Ref: "F2", Type: "inlineStr", Inline: "2024-03-01T12:30:00Z"},
+			{Ref: "G2", Type: "inlineStr", Inline: `["spicy"]`},
+		},
+		{
+			{Ref: "A3", Type: "inlineStr", Inline: "Rice"},
+			{Ref: "B3", Value: "0"},
+			{Ref: "C3", Value: "0"},
+			{Ref: "D3", Type: "b", Value: "0"},
+		},
+	}
+	if len(sheet.Rows) != len(want) {
+		t.Fatalf("sheet has %d rows, want %d", len(sheet.Rows), len(want))
+	}
+	for i, r := range sheet.Rows {
+		if !reflect.DeepEqual(r.Cells, want[i]) {
+			t.Errorf("row %s = %+v, want %+v", r.Ref, r.Cells, want[i])
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+	for _, test := range tests {
+		if got := columnName(test.index); got != test.want {
+			t.Errorf("columnName(%d) = %q, want %q", test.index, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Package fiscal hashes and chains numbered invoices and credit notes and
+// prices credit notes. It does not touch the database, the controllers read
+// the documents and hand them over.
+package fiscal
+
+import "fmt"
+
+// Link is one numbered document of a series as the chain sees it.
+type Link struct {
+	Number         string
+	SequenceNumber int
+	PreviousHash   string
+	Hash           string
+	// Recomputed is the hash of the document's current content.
+	Recomputed string
+}
+
+// Chain walks the documents of a series in sequence order.
+type Chain struct {
+	Count    int
+	LastHash string
+}
+
+// Next checks that link follows the documents seen so far and returns why
+// it does not, or "" when it does.
+func (chain *Chain) Next(link Link) string {
+	expected := chain.Count + 1
+	switch {
+	case link.SequenceNumber != expected:
+		return fmt.Sprintf("expected sequence number %d", expected)
+	case link.PreviousHash != chain.LastHash:
+		return "previous hash does not match the preceding document"
+	case link.Recomputed != link.Hash:
+		return "document content does not match its hash"
+	}
+
+	chain.Count = expected
+	chain.LastHash = link.Hash
+	return ""
+}
+
+// End compares the chain with the last number and hash kept by the
+// sequence, which catches documents removed from the end of the chain.
+func (chain *Chain) End(lastNumber int, lastHash string) string {
+	if lastNumber != chain.Count || lastHash != chain.LastHash {
+		return fmt.Sprintf("sequence ends at %d but %d documents were found", lastNumber, chain.Count)
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package fiscal
+
+import "testing"
+
+func link(sequenceNumber int, previousHash, hash string) Link {
+	return Link{Number: hash, SequenceNumber: sequenceNumber, PreviousHash: previousHash, Hash: hash, Recomputed: hash}
+}
+
+func TestChain(t *testing.T) {
+	tampered := link(2, "a", "b")
+	tampered.Recomputed = "changed"
+
+	tests := []struct {
+		name   string
+		links  []Link
+		failAt int
+		reason string
+	}{
+		{"empty", nil, -1, ""},
+		{"valid", []Link{link(1, "", "a"), link(2, "a", "b"), link(3, "b", "c")}, -1, ""},
+		{"first not numbered one", []Link{link(2, "", "a")}, 0, "expected sequence number 1"},
+		{"gap", []Link{link(1, "", "a"), link(3, "a", "c")}, 1, "expected sequence number 2"},
+		{"duplicate number", []Link{link(1, "", "a"), link(1, "a", "b")}, 1, "expected sequence number 2"},
+		{"first has a previous hash", []Link{link(1, "x", "a")}, 0, "previous hash does not match the preceding document"},
+		{"broken link", []Link{link(1, "", "a"), link(2, "x", "b")}, 1, "previous hash does not match the preceding document"},
+		{"tampered content", []Link{link(1, "", "a"), tampered}, 1, "document content does not match its hash"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain := Chain{}
+			failAt, reason := -1, ""
+			for i, next := range test.links {
+				if reason = chain.Next(next); reason != "" {
+					failAt = i
+					break
+				}
+			}
+			if failAt != test.failAt || reason != test.reason {
+				t.Errorf("failed at %d with %q, want %d with %q", failAt, reason, test.failAt, test.reason)
+			}
+			if failAt >= 0 && chain.Count != failAt {
+				t.Errorf("count = %d, want %d", chain.Count, failAt)
+			}
+		})
+	}
+}
+
+func TestChainEnd(t *testing.T) {
+	chain := Chain{}
+	for _, next := range []Link{link(1, "", "a"), link(2, "a", "b")} {
+		if reason := chain.Next(next); reason != "" {
+			t.Fatal(reason)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		lastNumber int
+		lastHash   string
+		want       string
+	}{
+		{"matches", 2, "b", ""},
+		{"documents removed from the end", 3, "c", "sequence ends at 3 but 2 documents were found"},
+		{"sequence behind", 1, "a", "sequence ends at 1 but 2 documents were found"},
+		{"hash differs", 2, "x", "sequence ends at 2 but 2 documents were found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := chain.End(test.lastNumber, test.lastHash); got != test.want {
+				t.Errorf("End(%d, %q) = %q, want %q", test.lastNumber, test.lastHash, got, test.want)
+			}
+		})
+	}
+
+	if got := (&Chain{}).End(0, ""); got != "" {
+		t.Errorf("empty chain without a sequence = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,119 @@
+package fiscal
+
+import (
+	"errors"
+	"main/model"
+	"main/money"
+)
+
+var (
+	ErrCreditExceeded     = errors.New("the credit exceeds what remains on the invoice")
+	ErrUnknownInvoiceLine = errors.New("the invoice has no such line")
+)
+
+// CreditNoteAmounts prices the credit note from the invoice snapshot. Taxes
+// are credited in proportion to the credited subtotal and the tip only with
+// a full credit.
+func CreditNoteAmounts(creditNote *model.CreditNote, invoice model.Invoice, previous []model.CreditNote) error {
+	var creditedSubtotal, creditedTip, creditedTotal float64
+	creditedQuantity := map[int]float64{}
+	for _, note := range previous {
+		creditedSubtotal += note.Subtotal
+		creditedTip += note.TipAmount
+		creditedTotal += note.Total
+		for _, line := range note.Lines {
+			creditedQuantity[*line.Line] += line.Quantity
+		}
+	}
+	// discounts are spread over the lines, so a credited line gives back what
+	// was actually paid for it
+	net := invoice.Subtotal - DiscountTotal(invoice)
+	share := 0.0
+	if invoice.Subtotal > 0 {
+		share = net / invoice.Subtotal
+	}
+	remaining := money.Round(net - creditedSubtotal)
+	tip := 0.0
+	if invoice.TipAmount != nil {
+		tip = *invoice.TipAmount
+	}
+
+	creditNote.Subtotal = 0
+	creditNote.TipAmount = 0
+	full := len(creditNote.Lines) == 0 && creditNote.Amount == nil
+	switch {
+	case full:
+		for i, billed := range invoice.Lines {
+			quantity := billed.Quantity - creditedQuantity[i]
+			if quantity <= 0 {
+				continue
+			}
+			creditNote.Lines = append(creditNote.Lines, creditNoteLine(i, billed, quantity, share))
+		}
+		creditNote.Subtotal = remaining
+		creditNote.TipAmount = money.Round(tip - creditedTip)
+		creditNote.Total = money.Round(invoice.Total - creditedTotal)
+	case creditNote.Amount != nil:
+		creditNote.Subtotal = money.Round(*creditNote.Amount)
+	default:
+		for i, line := range creditNote.Lines {
+			if *line.Line >= len(invoice.Lines) {
+				return ErrUnknownInvoiceLine
+			}
+			billed := invoice.Lines[*line.Line]
+			creditedQuantity[*line.Line] += line.Quantity
+			if creditedQuantity[*line.Line] > billed.Quantity+1e-9 {
+				return ErrCreditExceeded
+			}
+			creditNote.Lines[i] = creditNoteLine(*line.Line, billed, line.Quantity, share)
+			creditNote.Subtotal += creditNote.Lines[i].TotalPrice
+		}
+		creditNote.Subtotal = money.Round(creditNote.Subtotal)
+	}
+
+	if creditNote.Subtotal > remaining {
+		return ErrCreditExceeded
+	}
+
+	ratio := 0.0
+	if net > 0 {
+		ratio = creditNote.Subtotal / net
+	}
+	creditNote.Taxes = []model.InvoiceTax{}
+	for _, tax := range invoice.Taxes {
+		creditNote.Taxes = append(creditNote.Taxes, model.InvoiceTax{Label: tax.Label, Amount: money.Round(tax.Amount * ratio)})
+	}
+	if !full {
+		// whatever the invoice charged on top of subtotal and tip is tax
+		addedTax := invoice.Total - net - tip
+		creditNote.Total = money.Round(creditNote.Subtotal + addedTax*ratio)
+	}
+
+	if creditNote.Total <= 0 || creditNote.Total > money.Round(invoice.Total-creditedTotal) {
+		return ErrCreditExceeded
+	}
+	return nil
+}
+
+func creditNoteLine(index int, billed model.InvoiceLine, quantity, share float64) model.CreditNoteLine {
+	return model.CreditNoteLine{
+		Line:       &index,
+		FoodID:     billed.FoodID,
+		Name:       billed.Name,
+		Quantity:   quantity,
+		UnitPrice:  billed.UnitPrice,
+		TotalPrice: money.Round(billed.TotalPrice * quantity / billed.Quantity * share),
+	}
+}
+
+// DiscountTotal is what the discounts of an invoice take off its subtotal.
+func DiscountTotal(invoice model.Invoice) float64 {
+	total := 0.0
+	for _, discount := range invoice.Discounts {
+		total += discount.Amount
+	}
+	if total > invoice.Subtotal {
+		return invoice.Subtotal
+	}
+	return total
+}
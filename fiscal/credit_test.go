@@ -0,0 +1,113 @@
+package fiscal
+
+import (
+	"errors"
+	"main/model"
+	"reflect"
+	"testing"
+)
+
+// testInvoice bills 2 x 10 and 1 x 5 with 5 off, 10% tax on the 20 left and
+// a tip of 3.
+func testInvoice() model.Invoice {
+	tip := 3.0
+	return model.Invoice{
+		Lines: []model.InvoiceLine{
+			{FoodID: "pasta", Name: "Pasta", Quantity: 2, UnitPrice: 10, TotalPrice: 20},
+			{FoodID: "soup", Name: "Soup", Quantity: 1, UnitPrice: 5, TotalPrice: 5},
+		},
+		Discounts: []model.InvoiceDiscount{{Label: "Happy hour", Amount: 5}},
+		Taxes:     []model.InvoiceTax{{Label: "VAT 10%", Amount: 2}},
+		Subtotal:  25,
+		TipAmount: &tip,
+		Total:     25,
+	}
+}
+
+func creditLine(line int, quantity float64) model.CreditNoteLine {
+	return model.CreditNoteLine{Line: &line, Quantity: quantity}
+}
+
+func TestCreditNoteAmounts(t *testing.T) {
+	amount := func(value float64) *float64 { return &value }
+	pastaCredited := model.CreditNote{
+		Lines:    []model.CreditNoteLine{creditLine(0, 2)},
+		Subtotal: 16,
+		Total:    17.6,
+	}
+
+	tests := []struct {
+		name     string
+		note     model.CreditNote
+		previous []model.CreditNote
+		subtotal float64
+		tip      float64
+		tax      float64
+		total    float64
+		lines    []float64
+		err      error
+	}{
+		{name: "full", subtotal: 20, tip: 3, tax: 2, total: 25, lines: []float64{16, 4}},
+		{name: "one line", note: model.CreditNote{Lines: []model.CreditNoteLine{creditLine(0, 1)}}, subtotal: 8, tax: 0.8, total: 8.8, lines: []float64{8}},
+		{name: "amount", note: model.CreditNote{Amount: amount(10)}, subtotal: 10, tax: 1, total: 11},
+		{name: "rest after a line", previous: []model.CreditNote{pastaCredited}, subtotal: 4, tip: 3, tax: 0.4, total: 7.4, lines: []float64{4}},
+		{name: "unknown line", note: model.CreditNote{Lines: []model.CreditNoteLine{creditLine(5, 1)}}, err: ErrUnknownInvoiceLine},
+		{name: "more than billed", note: model.CreditNote{Lines: []model.CreditNoteLine{creditLine(0, 3)}}, err: ErrCreditExceeded},
+		{name: "line already credited", note: model.CreditNote{Lines: []model.CreditNoteLine{creditLine(0, 1)}}, previous: []model.CreditNote{pastaCredited}, err: ErrCreditExceeded},
+		{name: "amount above what was paid", note: model.CreditNote{Amount: amount(25)}, err: ErrCreditExceeded},
+		{name: "zero amount", note: model.CreditNote{Amount: amount(0)}, err: ErrCreditExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			note := test.note
+			err := CreditNoteAmounts(&note, testInvoice(), test.previous)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+			if test.err != nil {
+				return
+			}
+
+			if note.Subtotal != test.subtotal || note.TipAmount != test.tip || note.Total != test.total {
+				t.Errorf("subtotal, tip, total = %g, %g, %g, want %g, %g, %g", note.Subtotal, note.TipAmount, note.Total, test.subtotal, test.tip, test.total)
+			}
+			if want := []model.InvoiceTax{{Label: "VAT 10%", Amount: test.tax}}; !reflect.DeepEqual(note.Taxes, want) {
+				t.Errorf("taxes = %v, want %v", note.Taxes, want)
+			}
+			lines := []float64{}
+			for _, line := range note.Lines {
+				lines = append(lines, line.TotalPrice)
+			}
+			if test.lines == nil {
+				test.lines = []float64{}
+			}
+			if !reflect.DeepEqual(lines, test.lines) {
+				t.Errorf("line totals = %v, want %v", lines, test.lines)
+			}
+		})
+	}
+}
+
+func TestDiscountTotal(t *testing.T) {
+	tests := []struct {
+		name      string
+		subtotal  float64
+		discounts []float64
+		want      float64
+	}{
+		{"none", 20, nil, 0},
+		{"summed", 20, []float64{5, 2.5}, 7.5},
+		{"capped at the subtotal", 20, []float64{15, 10}, 20},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			invoice := model.Invoice{Subtotal: test.subtotal}
+			for _, amount := range test.discounts {
+				invoice.Discounts = append(invoice.Discounts, model.InvoiceDiscount{Amount: amount})
+			}
+			if got := DiscountTotal(invoice); got != test.want {
+				t.Errorf("DiscountTotal() = %g, want %g", got, test.want)
+			}
+		})
+	}
+}
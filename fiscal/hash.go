@@ -0,0 +1,106 @@
+package fiscal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"main/model"
+	"time"
+)
+
+// The hashed shapes are frozen: a stored hash is recomputed from them for as
+// long as the document is kept. Fields added later must be omitempty so that
+// documents hashed before they existed still verify.
+
+type invoiceLine struct {
+	FoodID     string   `json:"food_id,omitempty"`
+	Name       string   `json:"name"`
+	Quantity   float64  `json:"quantity"`
+	UnitPrice  float64  `json:"unit_price"`
+	TotalPrice float64  `json:"total_price"`
+	Modifiers  []string `json:"modifiers"`
+	Notes      string   `json:"notes"`
+}
+
+// InvoiceHash covers everything printed on a paid invoice together with the
+// hash of the invoice before it.
+func InvoiceHash(invoice model.Invoice) string {
+	content := struct {
+		InvoiceNumber string                  `json:"invoice_number"`
+		Location      string                  `json:"location"`
+		PaidAt        string                  `json:"paid_at"`
+		OrderID       string                  `json:"order_id"`
+		PaymentMethod *string                 `json:"payment_method"`
+		Lines         []invoiceLine           `json:"lines"`
+		Discounts     []model.InvoiceDiscount `json:"discounts,omitempty"`
+		Taxes         []model.InvoiceTax      `json:"taxes"`
+		Subtotal      float64                 `json:"subtotal"`
+		TipAmount     *float64                `json:"tip_amount"`
+		Total         float64                 `json:"total"`
+		Replaces      *string                 `json:"replaces,omitempty"`
+		PreviousHash  string                  `json:"previous_hash"`
+	}{
+		Location:      invoice.Location,
+		OrderID:       invoice.OrderID,
+		PaymentMethod: invoice.PaymentMethod,
+		Discounts:     invoice.Discounts,
+		Taxes:         invoice.Taxes,
+		Subtotal:      invoice.Subtotal,
+		TipAmount:     invoice.TipAmount,
+		Total:         invoice.Total,
+		Replaces:      invoice.Replaces,
+		PreviousHash:  invoice.PreviousHash,
+	}
+	if invoice.InvoiceNumber != nil {
+		content.InvoiceNumber = *invoice.InvoiceNumber
+	}
+	if invoice.PaidAt != nil {
+		content.PaidAt = invoice.PaidAt.UTC().Format(time.RFC3339)
+	}
+	if invoice.Lines != nil {
+		content.Lines = []invoiceLine{}
+	}
+	for _, line := range invoice.Lines {
+		content.Lines = append(content.Lines, invoiceLine(line))
+	}
+
+	return hash(content)
+}
+
+// CreditNoteHash covers everything printed on a credit note together with
+// the hash of the credit note before it.
+func CreditNoteHash(creditNote model.CreditNote) string {
+	content := struct {
+		CreditNoteNumber string                 `json:"credit_note_number"`
+		InvoiceID        string                 `json:"invoice_id"`
+		Location         string                 `json:"location"`
+		CreatedAt        string                 `json:"created_at"`
+		Reason           string                 `json:"reason"`
+		Lines            []model.CreditNoteLine `json:"lines"`
+		Taxes            []model.InvoiceTax     `json:"taxes"`
+		Subtotal         float64                `json:"subtotal"`
+		TipAmount        float64                `json:"tip_amount"`
+		Total            float64                `json:"total"`
+		PreviousHash     string                 `json:"previous_hash"`
+	}{
+		CreditNoteNumber: creditNote.CreditNoteNumber,
+		InvoiceID:        creditNote.InvoiceID,
+		Location:         creditNote.Location,
+		CreatedAt:        creditNote.CreatedAt.UTC().Format(time.RFC3339),
+		Reason:           creditNote.Reason,
+		Lines:            creditNote.Lines,
+		Taxes:            creditNote.Taxes,
+		Subtotal:         creditNote.Subtotal,
+		TipAmount:        creditNote.TipAmount,
+		Total:            creditNote.Total,
+		PreviousHash:     creditNote.PreviousHash,
+	}
+
+	return hash(content)
+}
+
+func hash(content interface{}) string {
+	encoded, _ := json.Marshal(content)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
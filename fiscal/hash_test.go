@@ -0,0 +1,87 @@
+package fiscal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"main/model"
+	"testing"
+)
+
+// storedInvoice is a paid invoice as it was stored before invoices had
+// line food ids, discounts or replaced other invoices.
+const storedInvoice = `{
+	"_key": "5f0c1b7e-1d2a-4b8e-9a51-7a0f6f3c2d10",
+	"order_id": "order-1",
+	"payment_method": "CARD",
+	"payment_status": "PAID",
+	"tip_amount": 2,
+	"location": "MAIN",
+	"invoice_number": "MAIN-2026-000002",
+	"fiscal_year": 2026,
+	"sequence_number": 2,
+	"lines": [
+		{"name": "Pasta", "quantity": 2, "unit_price": 10, "total_price": 20, "modifiers": ["extra cheese"], "notes": ""},
+		{"name": "Soup", "quantity": 1, "unit_price": 5.5, "total_price": 5.5, "modifiers": null, "notes": "no salt"}
+	],
+	"taxes": [{"label": "VAT 10%", "amount": 2.55}],
+	"subtotal": 25.5,
+	"total": 30.05,
+	"previous_hash": "9b1f0e",
+	"hash": "",
+	"paid_at": "2026-03-14T19:30:00+01:00"
+}`
+
+// storedContent is what the hash of storedInvoice was computed from.
+const storedContent = `{"invoice_number":"MAIN-2026-000002","location":"MAIN","paid_at":"2026-03-14T18:30:00Z","order_id":"order-1","payment_method":"CARD",` +
+	`"lines":[{"name":"Pasta","quantity":2,"unit_price":10,"total_price":20,"modifiers":["extra cheese"],"notes":""},` +
+	`{"name":"Soup","quantity":1,"unit_price":5.5,"total_price":5.5,"modifiers":null,"notes":"no salt"}],` +
+	`"taxes":[{"label":"VAT 10%","amount":2.55}],"subtotal":25.5,"tip_amount":2,"total":30.05,"previous_hash":"9b1f0e"}`
+
+func sha(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInvoiceHashOfStoredInvoice(t *testing.T) {
+	var invoice model.Invoice
+	if err := json.Unmarshal([]byte(storedInvoice), &invoice); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := InvoiceHash(invoice), sha(storedContent); got != want {
+		t.Errorf("InvoiceHash() = %s, want %s", got, want)
+	}
+}
+
+func TestInvoiceHashCoversNewFields(t *testing.T) {
+	var stored model.Invoice
+	if err := json.Unmarshal([]byte(storedInvoice), &stored); err != nil {
+		t.Fatal(err)
+	}
+	original := InvoiceHash(stored)
+
+	replaced := "0d4c7b1a-2f6e-4f0a-8d3b-5c9e1a7f2b64"
+	tests := []struct {
+		name   string
+		change func(invoice *model.Invoice)
+	}{
+		{"line food id", func(invoice *model.Invoice) { invoice.Lines[0].FoodID = "pasta" }},
+		{"discount", func(invoice *model.Invoice) {
+			invoice.Discounts = []model.InvoiceDiscount{{Label: "Happy hour", Amount: 1}}
+		}},
+		{"replaces", func(invoice *model.Invoice) { invoice.Replaces = &replaced }},
+		{"total", func(invoice *model.Invoice) { invoice.Total = 30 }},
+		{"previous hash", func(invoice *model.Invoice) { invoice.PreviousHash = "" }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var invoice model.Invoice
+			json.Unmarshal([]byte(storedInvoice), &invoice)
+			test.change(&invoice)
+			if InvoiceHash(invoice) == original {
+				t.Error("hash did not change")
+			}
+		})
+	}
+}
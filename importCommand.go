@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"main/controller"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runImportCommand imports a catalog file from the command line, e.g.
+// `go run . import -dry-run menu.csv`, and prints the import report.
+func runImportCommand(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "validate the file without writing anything")
+	format := flags.String("format", "", "csv or json, taken from the file extension by default")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: import [-dry-run] [-format csv|json] file")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	path := flags.Arg(0)
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal("Failed to open import file:", err)
+	}
+	defer file.Close()
+
+	if *format == "" {
+		*format = strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	}
+
+	report, err := controller.RunCatalogImport(file, *format, *dryRun)
+	if err != nil {
+		log.Fatal("Failed to import catalog:", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
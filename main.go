@@ -1,14 +1,26 @@
 package main
 
 import (
+	"main/controller"
 	"main/routes"
 	"net/http"
+	"os"
+	_ "time/tzdata"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImportCommand(os.Args[2:])
+		return
+	}
+
+	controller.StartPrintQueue()
+	controller.StartDunning()
+	controller.StartLoyalty()
+
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
 	routes.Use(router)
@@ -0,0 +1,64 @@
+// Package menuengineering sorts menu items into stars, plowhorses, puzzles
+// and dogs by popularity and contribution margin.
+package menuengineering
+
+import (
+	"main/model"
+	"main/money"
+	"math"
+)
+
+// Classify applies the usual menu engineering rules: an item is popular when
+// its share of sales reaches 70% of an even share, and profitable when its
+// contribution margin reaches the weighted average.
+func Classify(report *model.MenuEngineeringReport) {
+	var totalMargin float64
+	for i := range report.Items {
+		item := &report.Items[i]
+		if item.QuantitySold > 0 {
+			// the realised price includes modifiers and historical prices
+			item.ContributionMargin = money.Round(item.Revenue/item.QuantitySold - item.Cost)
+		} else {
+			item.ContributionMargin = item.Margin
+		}
+		report.TotalSold += item.QuantitySold
+		totalMargin += item.ContributionMargin * item.QuantitySold
+	}
+
+	if len(report.Items) == 0 {
+		return
+	}
+	report.PopularityThreshold = math.Round(70/float64(len(report.Items))*100) / 100
+	if report.TotalSold > 0 {
+		report.AverageContributionMargin = money.Round(totalMargin / report.TotalSold)
+	}
+
+	for i := range report.Items {
+		item := &report.Items[i]
+		if report.TotalSold > 0 {
+			item.MenuMixPercent = math.Round(item.QuantitySold/report.TotalSold*10000) / 100
+		}
+
+		popular := item.MenuMixPercent >= report.PopularityThreshold
+		profitable := item.ContributionMargin >= report.AverageContributionMargin
+
+		item.Popularity, item.Profitability = "LOW", "LOW"
+		if popular {
+			item.Popularity = "HIGH"
+		}
+		if profitable {
+			item.Profitability = "HIGH"
+		}
+
+		switch {
+		case popular && profitable:
+			item.Category = "STAR"
+		case popular:
+			item.Category = "PLOWHORSE"
+		case profitable:
+			item.Category = "PUZZLE"
+		default:
+			item.Category = "DOG"
+		}
+	}
+}
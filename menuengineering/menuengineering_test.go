@@ -0,0 +1,89 @@
+package menuengineering
+
+import (
+	"main/model"
+	"testing"
+)
+
+func item(foodID string, price, cost, sold, revenue float64) model.MenuEngineeringItem {
+	return model.MenuEngineeringItem{
+		FoodCost:     model.FoodCost{FoodID: foodID, UnitPrice: price, Cost: cost, Margin: price - cost},
+		QuantitySold: sold,
+		Revenue:      revenue,
+	}
+}
+
+func TestClassify(t *testing.T) {
+	type want struct {
+		margin   float64
+		mix      float64
+		category string
+	}
+	tests := []struct {
+		name      string
+		items     []model.MenuEngineeringItem
+		sold      float64
+		threshold float64
+		average   float64
+		want      []want
+	}{
+		{
+			name: "all four categories",
+			items: []model.MenuEngineeringItem{
+				item("burger", 10, 4, 50, 500),
+				// sold with paid modifiers above the menu price
+				item("steak", 12, 8, 30, 390),
+				item("salad", 9, 2, 5, 45),
+				item("fries", 8, 6, 15, 120),
+				item("soup", 7, 4, 0, 0),
+			},
+			sold:      100,
+			threshold: 14,
+			average:   5.15,
+			want: []want{
+				{6, 50, "STAR"},
+				{5, 30, "PLOWHORSE"},
+				{7, 5, "PUZZLE"},
+				{2, 15, "PLOWHORSE"},
+				{3, 0, "DOG"},
+			},
+		},
+		{
+			name: "nothing sold",
+			items: []model.MenuEngineeringItem{
+				item("burger", 10, 4, 0, 0),
+				item("water", 2, 3, 0, 0),
+			},
+			threshold: 35,
+			want: []want{
+				{6, 0, "PUZZLE"},
+				{-1, 0, "DOG"},
+			},
+		},
+		{
+			name:      "single item",
+			items:     []model.MenuEngineeringItem{item("burger", 10, 4, 3, 30)},
+			sold:      3,
+			threshold: 70,
+			average:   6,
+			want:      []want{{6, 100, "STAR"}},
+		},
+		{name: "no items"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := model.MenuEngineeringReport{Items: test.items}
+			Classify(&report)
+
+			if report.TotalSold != test.sold || report.PopularityThreshold != test.threshold || report.AverageContributionMargin != test.average {
+				t.Errorf("sold, threshold, average = %g, %g, %g, want %g, %g, %g", report.TotalSold, report.PopularityThreshold, report.AverageContributionMargin, test.sold, test.threshold, test.average)
+			}
+			for i, item := range report.Items {
+				got := want{item.ContributionMargin, item.MenuMixPercent, item.Category}
+				if got != test.want[i] {
+					t.Errorf("%s = %+v, want %+v", item.FoodID, got, test.want[i])
+				}
+			}
+		})
+	}
+}
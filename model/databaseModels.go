@@ -6,55 +6,427 @@ import (
 
 // food model
 type Food struct {
-	FoodID    string    `json:"_key"`
-	Name      *string   `json:"name" validate:"required,min=3,max=30"`
-	UnitPrice *float64  `json:"unit_price" validate:"required"`
-	FoodImage *string   `json:"food_image" validate:"required"`
-	MenuID    *string   `json:"menu_id" validate:"required"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	FoodID            string          `json:"_key"`
+	SKU               *string         `json:"sku"`
+	Name              *string         `json:"name" validate:"required,min=3,max=30"`
+	Description       *string         `json:"description" validate:"omitempty,max=500"`
+	Translations      Translations    `json:"translations" validate:"dive,keys,min=2,max=5,endkeys"`
+	UnitPrice         *float64        `json:"unit_price" validate:"required"`
+	FoodImage         *string         `json:"food_image" validate:"omitempty,max=500"`
+	Images            []StoredImage   `json:"images"`
+	MenuID            *string         `json:"menu_id" validate:"required"`
+	ModifierGroups    []ModifierGroup `json:"modifier_groups" validate:"dive"`
+	ComboItems        []ComboItem     `json:"combo_items" validate:"dive"`
+	Recipe            []RecipeLine    `json:"recipe" validate:"dive"`
+	Available         *bool           `json:"available"`
+	RemainingPortions *float64        `json:"remaining_portions" validate:"omitempty,gte=0"`
+	Station           *string         `json:"station"`
+	Allergens         []string        `json:"allergens" validate:"dive,oneof=gluten crustaceans eggs fish peanuts soybeans milk nuts celery mustard sesame sulphites lupin molluscs"`
+	DietaryTags       []string        `json:"dietary_tags" validate:"dive,oneof=vegan vegetarian gluten-free halal"`
+	Nutrition         *Nutrition      `json:"nutrition"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
+
+// nutrition per serving, calories in kcal and the rest in grams
+type Nutrition struct {
+	Calories      *float64 `json:"calories" validate:"omitempty,gte=0"`
+	Protein       *float64 `json:"protein" validate:"omitempty,gte=0"`
+	Carbohydrates *float64 `json:"carbohydrates" validate:"omitempty,gte=0"`
+	Sugars        *float64 `json:"sugars" validate:"omitempty,gte=0"`
+	Fat           *float64 `json:"fat" validate:"omitempty,gte=0"`
+	SaturatedFat  *float64 `json:"saturated_fat" validate:"omitempty,gte=0"`
+	Salt          *float64 `json:"salt" validate:"omitempty,gte=0"`
+}
+
+// uploaded image file; variant is original, medium or thumbnail
+type StoredImage struct {
+	Variant     string `json:"variant"`
+	Key         string `json:"key"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int    `json:"size"`
+}
+
+// food modifier model
+type ModifierGroup struct {
+	GroupID       string           `json:"group_id"`
+	Name          string           `json:"name" validate:"required"`
+	Required      bool             `json:"required"`
+	MinSelections int              `json:"min_selections" validate:"gte=0"`
+	MaxSelections int              `json:"max_selections" validate:"gte=0"`
+	Options       []ModifierOption `json:"options" validate:"required,min=1,dive"`
+}
+
+type ModifierOption struct {
+	OptionID   string   `json:"option_id"`
+	Name       string   `json:"name" validate:"required"`
+	PriceDelta float64  `json:"price_delta"`
+	Allergens  []string `json:"allergens"`
+}
+
+// combo component model
+type ComboItem struct {
+	FoodID   string  `json:"food_id" validate:"required"`
+	Quantity float64 `json:"quantity" validate:"required,gt=0"`
 }
 
 // order model
 type Order struct {
-	OrderID   string    `json:"_key"`
-	TableID   *string   `json:"table_id" validate:"required"`
-	OrderDate time.Time `json:"order_date"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	OrderID       string    `json:"_key"`
+	TableID       *string   `json:"table_id" validate:"required"`
+	Server        *string   `json:"server"`
+	NumberOfGuest *int      `json:"number_of_guest" validate:"omitempty,gt=0"`
+	CustomerID    *string   `json:"customer_id"`
+	CouponCode    *string   `json:"coupon_code"`
+	OrderDate     time.Time `json:"order_date"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // orderItem model
 type OrderItem struct {
-	OrderItemID string    `json:"_key"`
-	FoodID      *string   `json:"food_id" validate:"required"`
-	Quantity    *float64  `json:"quantity" validate:"required"`
-	TotalPrice  *float64  `json:"total_price"`
-	OrderID     string    `json:"order_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	OrderItemID         string             `json:"_key"`
+	FoodID              *string            `json:"food_id" validate:"required"`
+	FoodName            string             `json:"food_name"`
+	Quantity            *float64           `json:"quantity" validate:"required,gt=0"`
+	UnitPrice           *float64           `json:"unit_price"`
+	TotalPrice          *float64           `json:"total_price"`
+	Modifiers           []SelectedModifier `json:"modifiers" validate:"dive"`
+	SpecialInstructions *string            `json:"special_instructions" validate:"omitempty,max=200"`
+	ComboItems          []ComboItem        `json:"combo_items"`
+	Consumption         []RecipeLine       `json:"consumption"`
+	Promotions          []AppliedPromotion `json:"promotions"`
+	Station             string             `json:"station"`
+	OrderID             string             `json:"order_id"`
+	CreatedAt           time.Time          `json:"created_at"`
+	UpdatedAt           time.Time          `json:"updated_at"`
+}
+
+type SelectedModifier struct {
+	GroupID    string  `json:"group_id" validate:"required"`
+	OptionID   string  `json:"option_id" validate:"required"`
+	Name       string  `json:"name"`
+	PriceDelta float64 `json:"price_delta"`
+}
+
+// part of an order item's price taken off by a promotion
+type AppliedPromotion struct {
+	PromotionID string  `json:"promotion_id"`
+	Name        string  `json:"name"`
+	Amount      float64 `json:"amount"`
 }
 
 // invoice model
 type Invoice struct {
-	InvoiceID      string    `json:"_key"`
-	OrderID        string    `json:"order_id" validate:"required"`
-	PaymentMethod  *string   `json:"payment_method" validate:"eq=CARD|eq=CASH|eq="`
-	PaymentStatus  *string   `json:"payment_status" validate:"required,eq=PENDING|eq=PAID"`
-	PaymentDueDate time.Time `json:"payment_due_date"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	InvoiceID      string            `json:"_key"`
+	OrderID        string            `json:"order_id" validate:"required"`
+	PaymentMethod  *string           `json:"payment_method" validate:"eq=CARD|eq=CASH|eq=ACCOUNT|eq=GIFT_CARD|eq="`
+	PaymentStatus  *string           `json:"payment_status" validate:"required,eq=PENDING|eq=OVERDUE|eq=PAID"`
+	TipAmount      *float64          `json:"tip_amount" validate:"omitempty,gte=0"`
+	PaymentDueDate time.Time         `json:"payment_due_date"`
+	AccountID      *string           `json:"account_id"`
+	CustomerID     *string           `json:"customer_id"`
+	RemindersSent  int               `json:"reminders_sent"`
+	LastReminderAt *time.Time        `json:"last_reminder_at"`
+	Location       string            `json:"location" validate:"omitempty,alphanum,max=20"`
+	InvoiceNumber  *string           `json:"invoice_number"`
+	FiscalYear     int               `json:"fiscal_year"`
+	SequenceNumber int               `json:"sequence_number"`
+	Lines          []InvoiceLine     `json:"lines"`
+	Discounts      []InvoiceDiscount `json:"discounts"`
+	GiftCards      []GiftCardPayment `json:"gift_cards"`
+	Taxes          []InvoiceTax      `json:"taxes"`
+	Subtotal       float64           `json:"subtotal"`
+	Total          float64           `json:"total"`
+	PreviousHash   string            `json:"previous_hash"`
+	Hash           string            `json:"hash"`
+	PaidAt         *time.Time        `json:"paid_at"`
+	SettledAt      *time.Time        `json:"settled_at"`
+	CreditedTotal  float64           `json:"credited_total"`
+	Replaces       *string           `json:"replaces"`
+	ReplacedBy     *string           `json:"replaced_by"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// snapshot of the billed items, frozen when the invoice is paid
+type InvoiceLine struct {
+	FoodID     string   `json:"food_id"`
+	Name       string   `json:"name"`
+	Quantity   float64  `json:"quantity"`
+	UnitPrice  float64  `json:"unit_price"`
+	TotalPrice float64  `json:"total_price"`
+	Modifiers  []string `json:"modifiers"`
+	Notes      string   `json:"notes"`
+}
+
+type InvoiceTax struct {
+	Label  string  `json:"label"`
+	Amount float64 `json:"amount"`
+}
+
+// discount taken off the subtotal before tax
+type InvoiceDiscount struct {
+	DiscountID string  `json:"discount_id"`
+	Label      string  `json:"label"`
+	Amount     float64 `json:"amount"`
+	Source     string  `json:"source"`
+	Reference  string  `json:"reference"`
+}
+
+// part of an invoice paid from a gift card; payment_id is the redemption in
+// the gift card ledger
+type GiftCardPayment struct {
+	PaymentID  string  `json:"payment_id"`
+	GiftCardID string  `json:"gift_card_id"`
+	CardEnding string  `json:"card_ending"`
+	Amount     float64 `json:"amount"`
+}
+
+// fiscal numbering model, one sequence per location and year
+type InvoiceSequence struct {
+	SequenceID string `json:"_key"`
+	Series     string `json:"series"`
+	Location   string `json:"location"`
+	Year       int    `json:"year"`
+	LastNumber int    `json:"last_number"`
+	LastHash   string `json:"last_hash"`
+}
+
+// customer model; phone and email are stored normalized so that returning
+// guests and duplicates can be matched on them
+type Customer struct {
+	CustomerID       string     `json:"_key"`
+	Name             *string    `json:"name" validate:"required,min=2,max=100"`
+	Phone            *string    `json:"phone" validate:"omitempty,min=5,max=20"`
+	Email            *string    `json:"email" validate:"omitempty,email"`
+	Allergies        []string   `json:"allergies" validate:"omitempty,dive,min=2,max=50"`
+	Preferences      []string   `json:"preferences" validate:"omitempty,dive,min=2,max=100"`
+	Notes            *string    `json:"notes" validate:"omitempty,max=500"`
+	MarketingConsent *bool      `json:"marketing_consent"`
+	ConsentedAt      *time.Time `json:"consented_at"`
+	LoyaltyPoints    int        `json:"loyalty_points"`
+	LifetimePoints   int        `json:"lifetime_points"`
+	LoyaltyTier      string     `json:"loyalty_tier"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// loyalty program settings; day multipliers follow the weekday in timezone
+type LoyaltySettings struct {
+	Enabled        bool                   `json:"enabled"`
+	PointsPerUnit  float64                `json:"points_per_unit" validate:"gte=0"`
+	BonusItems     []LoyaltyBonusItem     `json:"bonus_items" validate:"dive"`
+	DayMultipliers []LoyaltyDayMultiplier `json:"day_multipliers" validate:"dive"`
+	ExpiryDays     int                    `json:"expiry_days" validate:"gte=0"`
+	Timezone       string                 `json:"timezone"`
+	Tiers          []LoyaltyTier          `json:"tiers" validate:"dive"`
+	Rewards        []LoyaltyReward        `json:"rewards" validate:"dive"`
+}
+
+// extra points for every unit of a food sold
+type LoyaltyBonusItem struct {
+	FoodID string `json:"food_id" validate:"required"`
+	Points int    `json:"points" validate:"gt=0"`
+}
+
+// weekday follows time.Weekday, 0 is Sunday
+type LoyaltyDayMultiplier struct {
+	Weekday    int     `json:"weekday" validate:"gte=0,lte=6"`
+	Multiplier float64 `json:"multiplier" validate:"gt=0"`
+}
+
+// customers reach a tier once their lifetime points reach min_points
+type LoyaltyTier struct {
+	Name       string  `json:"name" validate:"required,max=30"`
+	MinPoints  int     `json:"min_points" validate:"gte=0"`
+	Multiplier float64 `json:"multiplier" validate:"gt=0"`
+}
+
+type LoyaltyReward struct {
+	Code     string  `json:"code" validate:"required,alphanum,max=20"`
+	Name     string  `json:"name" validate:"required,max=50"`
+	Points   int     `json:"points" validate:"gt=0"`
+	Discount float64 `json:"discount" validate:"gt=0"`
+}
+
+// loyalty ledger entry; remaining is what is left of credited points after
+// redemptions, and expires at expires_at
+type LoyaltyTransaction struct {
+	TransactionID string     `json:"_key"`
+	CustomerID    string     `json:"customer_id"`
+	Type          string     `json:"type"`
+	Points        int        `json:"points"`
+	Remaining     int        `json:"remaining"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	InvoiceID     *string    `json:"invoice_id"`
+	CreditNoteID  *string    `json:"credit_note_id"`
+	RewardCode    *string    `json:"reward_code"`
+	Reversed      bool       `json:"reversed"`
+	Description   string     `json:"description"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// gift card model; the balance is what the card can still pay
+type GiftCard struct {
+	GiftCardID    string     `json:"_key"`
+	Code          string     `json:"code"`
+	InitialAmount float64    `json:"initial_amount"`
+	Balance       float64    `json:"balance"`
+	IssuedTo      *string    `json:"issued_to" validate:"omitempty,max=100"`
+	CustomerID    *string    `json:"customer_id"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	Active        *bool      `json:"active"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// gift card ledger entry; amount is positive for money put on the card and
+// balance is what the card held afterwards
+type GiftCardTransaction struct {
+	TransactionID string    `json:"_key"`
+	GiftCardID    string    `json:"gift_card_id"`
+	Type          string    `json:"type"`
+	Amount        float64   `json:"amount"`
+	Balance       float64   `json:"balance"`
+	InvoiceID     *string   `json:"invoice_id"`
+	CreditNoteID  *string   `json:"credit_note_id"`
+	PaymentMethod *string   `json:"payment_method"`
+	Note          string    `json:"note"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// house account model; invoices charged to an account are due after the
+// account's payment terms
+type Account struct {
+	AccountID        string    `json:"_key"`
+	Name             *string   `json:"name" validate:"required,min=2,max=100"`
+	ContactName      *string   `json:"contact_name"`
+	Email            *string   `json:"email" validate:"omitempty,email"`
+	Phone            *string   `json:"phone"`
+	BillingAddress   *string   `json:"billing_address"`
+	PaymentTermsDays *int      `json:"payment_terms_days" validate:"omitempty,oneof=0 7 15 30 45 60"`
+	CreditLimit      *float64  `json:"credit_limit" validate:"omitempty,gte=0"`
+	Active           *bool     `json:"active"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// payment reminder sent for an overdue invoice
+type InvoiceReminder struct {
+	ReminderID  string    `json:"_key"`
+	InvoiceID   string    `json:"invoice_id"`
+	AccountID   *string   `json:"account_id"`
+	Level       int       `json:"level"`
+	DueDate     time.Time `json:"due_date"`
+	DaysOverdue int       `json:"days_overdue"`
+	AmountDue   float64   `json:"amount_due"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// credit note model
+type CreditNote struct {
+	CreditNoteID     string           `json:"_key"`
+	InvoiceID        string           `json:"invoice_id" validate:"required"`
+	OrderID          string           `json:"order_id"`
+	Location         string           `json:"location"`
+	CreditNoteNumber string           `json:"credit_note_number"`
+	FiscalYear       int              `json:"fiscal_year"`
+	SequenceNumber   int              `json:"sequence_number"`
+	Reason           string           `json:"reason" validate:"required,max=200"`
+	Lines            []CreditNoteLine `json:"lines" validate:"dive"`
+	Amount           *float64         `json:"amount" validate:"omitempty,gt=0"`
+	Taxes            []InvoiceTax     `json:"taxes"`
+	Subtotal         float64          `json:"subtotal"`
+	TipAmount        float64          `json:"tip_amount"`
+	Total            float64          `json:"total"`
+	PreviousHash     string           `json:"previous_hash"`
+	Hash             string           `json:"hash"`
+	CreatedAt        time.Time        `json:"created_at"`
+}
+
+// credits part of an invoice line; line is the index in the invoice lines
+type CreditNoteLine struct {
+	Line       *int    `json:"line" validate:"required,gte=0"`
+	FoodID     string  `json:"food_id"`
+	Name       string  `json:"name"`
+	Quantity   float64 `json:"quantity" validate:"gt=0"`
+	UnitPrice  float64 `json:"unit_price"`
+	TotalPrice float64 `json:"total_price"`
+}
+
+// request to credit an invoice and open a corrected one in its place
+type InvoiceCorrection struct {
+	Reason        string   `json:"reason" validate:"required,max=200"`
+	PaymentMethod *string  `json:"payment_method" validate:"omitempty,eq=CARD|eq=CASH|eq=ACCOUNT|eq=GIFT_CARD|eq="`
+	PaymentStatus *string  `json:"payment_status" validate:"omitempty,eq=PENDING|eq=PAID"`
+	TipAmount     *float64 `json:"tip_amount" validate:"omitempty,gte=0"`
 }
 
 // menu model
 type Menu struct {
-	MenuID    string     `json:"_key"`
-	Name      string     `json:"name" validate:"required"`
-	Category  string     `json:"category" validate:"required"`
-	StartDate *time.Time `json:"start_date"`
-	EndDate   *time.Time `json:"end_date"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
+	MenuID       string                 `json:"_key"`
+	SKU          *string                `json:"sku"`
+	Name         string                 `json:"name" validate:"required"`
+	Category     string                 `json:"category" validate:"required"`
+	Description  string                 `json:"description" validate:"max=500"`
+	Translations Translations           `json:"translations" validate:"dive,keys,min=2,max=5,endkeys"`
+	StartDate    *time.Time             `json:"start_date"`
+	EndDate      *time.Time             `json:"end_date"`
+	Timezone     string                 `json:"timezone"`
+	Schedules    []AvailabilitySchedule `json:"schedules" validate:"dive"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+}
+
+// texts in other languages keyed by language code; empty fields fall back
+// to the default locale
+type Translations map[string]Translation
+
+type Translation struct {
+	Name        string `json:"name" validate:"max=100"`
+	Category    string `json:"category" validate:"max=100"`
+	Description string `json:"description" validate:"max=500"`
+}
+
+// language settings; the untranslated names are in the default locale
+type LocalizationSettings struct {
+	DefaultLocale string   `json:"default_locale" validate:"required,min=2,max=5"`
+	Locales       []string `json:"locales" validate:"dive,min=2,max=5"`
+}
+
+// menu availability model
+type AvailabilitySchedule struct {
+	Days      []string `json:"days" validate:"dive,oneof=MON TUE WED THU FRI SAT SUN"`
+	StartTime string   `json:"start_time" validate:"required,datetime=15:04"`
+	EndTime   string   `json:"end_time" validate:"required,datetime=15:04"`
+}
+
+// promotion model; value is the percentage off for PERCENT and BOGO, the
+// amount off every unit for FIXED and the price of the whole set for BUNDLE
+type Promotion struct {
+	PromotionID  string                 `json:"_key"`
+	Name         *string                `json:"name" validate:"required,min=2,max=50"`
+	Type         *string                `json:"type" validate:"required,oneof=PERCENT FIXED BOGO BUNDLE"`
+	Value        *float64               `json:"value" validate:"required,gte=0"`
+	FoodIDs      []string               `json:"food_ids" validate:"dive,required"`
+	MenuIDs      []string               `json:"menu_ids" validate:"dive,required"`
+	BuyQuantity  int                    `json:"buy_quantity" validate:"gte=0"`
+	FreeQuantity int                    `json:"free_quantity" validate:"gte=0"`
+	BundleItems  []ComboItem            `json:"bundle_items" validate:"dive"`
+	CouponCode   *string                `json:"coupon_code" validate:"omitempty,alphanum,min=3,max=30"`
+	UsageLimit   *int                   `json:"usage_limit" validate:"omitempty,gt=0"`
+	UsageCount   int                    `json:"usage_count"`
+	StartDate    *time.Time             `json:"start_date"`
+	EndDate      *time.Time             `json:"end_date"`
+	Timezone     string                 `json:"timezone"`
+	Schedules    []AvailabilitySchedule `json:"schedules" validate:"dive"`
+	Active       *bool                  `json:"active"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
 }
 
 // table model
@@ -65,3 +437,148 @@ type Table struct {
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
+
+// receipt settings model
+type ReceiptSettings struct {
+	RestaurantName   string  `json:"restaurant_name" validate:"required"`
+	Address          string  `json:"address"`
+	Phone            string  `json:"phone"`
+	TaxID            string  `json:"tax_id"`
+	Footer           string  `json:"footer"`
+	Currency         string  `json:"currency"`
+	TaxName          string  `json:"tax_name"`
+	TaxRate          float64 `json:"tax_rate" validate:"gte=0,lte=100"`
+	PricesIncludeTax bool    `json:"prices_include_tax"`
+	Width            int     `json:"width" validate:"omitempty,gte=24,lte=64"`
+	TextTemplate     string  `json:"text_template"`
+	HTMLTemplate     string  `json:"html_template"`
+}
+
+// printer model
+type Printer struct {
+	PrinterID  string    `json:"_key"`
+	Name       *string   `json:"name" validate:"required"`
+	Connection *string   `json:"connection" validate:"required,eq=NETWORK|eq=FILE"`
+	Address    *string   `json:"address" validate:"required"`
+	Stations   []string  `json:"stations" validate:"required,min=1,dive,required"`
+	Width      int       `json:"width" validate:"omitempty,gte=24,lte=64"`
+	Enabled    *bool     `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type PrintJob struct {
+	PrintJobID    string     `json:"_key"`
+	PrinterID     string     `json:"printer_id"`
+	Document      string     `json:"document"`
+	Reference     string     `json:"reference"`
+	Payload       []byte     `json:"payload"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	PrintedAt     *time.Time `json:"printed_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// idempotency model
+type IdempotencyRecord struct {
+	RecordID    string `json:"_key"`
+	Key         string `json:"key"`
+	Path        string `json:"path"`
+	RequestHash string `json:"request_hash"`
+	Completed   bool   `json:"completed"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+// ingredient model
+type Ingredient struct {
+	IngredientID      string    `json:"_key"`
+	Name              *string   `json:"name" validate:"required,min=2,max=50"`
+	Unit              *string   `json:"unit" validate:"required,oneof=g kg ml l pcs"`
+	StockOnHand       *float64  `json:"stock_on_hand" validate:"required"`
+	LowStockThreshold *float64  `json:"low_stock_threshold" validate:"omitempty,gte=0"`
+	ParLevel          *float64  `json:"par_level" validate:"omitempty,gte=0"`
+	CostPerUnit       *float64  `json:"cost_per_unit" validate:"omitempty,gte=0"`
+	SupplierID        *string   `json:"supplier_id"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// recipe model
+type RecipeLine struct {
+	IngredientID string  `json:"ingredient_id" validate:"required"`
+	Quantity     float64 `json:"quantity" validate:"required,gt=0"`
+	Unit         string  `json:"unit" validate:"omitempty,oneof=g kg ml l pcs"`
+}
+
+// stock movement model
+type StockMovement struct {
+	StockMovementID string    `json:"_key"`
+	IngredientID    string    `json:"ingredient_id"`
+	Quantity        float64   `json:"quantity"`
+	Reason          string    `json:"reason"`
+	OrderItemID     string    `json:"order_item_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// stock alert model
+type StockAlert struct {
+	StockAlertID string    `json:"_key"`
+	IngredientID string    `json:"ingredient_id"`
+	Name         string    `json:"name"`
+	StockOnHand  float64   `json:"stock_on_hand"`
+	Threshold    float64   `json:"threshold"`
+	Acknowledged bool      `json:"acknowledged"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// supplier model
+type Supplier struct {
+	SupplierID   string    `json:"_key"`
+	Name         *string   `json:"name" validate:"required,min=2,max=50"`
+	ContactName  *string   `json:"contact_name"`
+	Phone        *string   `json:"phone"`
+	Email        *string   `json:"email" validate:"omitempty,email"`
+	LeadTimeDays *int      `json:"lead_time_days" validate:"omitempty,gte=0"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// purchase order model
+type PurchaseOrder struct {
+	PurchaseOrderID string              `json:"_key"`
+	SupplierID      *string             `json:"supplier_id" validate:"required"`
+	Status          *string             `json:"status" validate:"omitempty,eq=DRAFT|eq=ORDERED|eq=PARTIALLY_RECEIVED|eq=RECEIVED|eq=CANCELLED"`
+	Lines           []PurchaseOrderLine `json:"lines" validate:"required,min=1,dive"`
+	ExpectedDate    *time.Time          `json:"expected_date"`
+	CreatedAt       time.Time           `json:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at"`
+}
+
+type PurchaseOrderLine struct {
+	LineID           string  `json:"line_id"`
+	IngredientID     string  `json:"ingredient_id" validate:"required"`
+	QuantityOrdered  float64 `json:"quantity_ordered" validate:"required,gt=0"`
+	QuantityReceived float64 `json:"quantity_received"`
+	UnitCost         float64 `json:"unit_cost" validate:"gte=0"`
+}
+
+// goods receipt model
+type GoodsReceipt struct {
+	GoodsReceiptID  string             `json:"_key"`
+	PurchaseOrderID string             `json:"purchase_order_id"`
+	Lines           []GoodsReceiptLine `json:"lines" validate:"required,min=1,dive"`
+	ReceivedAt      time.Time          `json:"received_at"`
+}
+
+type GoodsReceiptLine struct {
+	LineID       string   `json:"line_id" validate:"required"`
+	IngredientID string   `json:"ingredient_id"`
+	Quantity     float64  `json:"quantity" validate:"required,gt=0"`
+	UnitCost     *float64 `json:"unit_cost" validate:"omitempty,gte=0"`
+}
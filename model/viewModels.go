@@ -5,30 +5,421 @@ import (
 )
 
 type OrderItemPack struct {
-	TableID    *string     `json:"table_id"`
-	OrderItems []OrderItem `json:"order_items"`
+	TableID       *string     `json:"table_id" validate:"required"`
+	Server        *string     `json:"server"`
+	NumberOfGuest *int        `json:"number_of_guest" validate:"omitempty,gt=0"`
+	CustomerID    *string     `json:"customer_id"`
+	CouponCode    *string     `json:"coupon_code" validate:"omitempty,alphanum,max=30"`
+	OrderItems    []OrderItem `json:"order_items"`
 }
 
 type OrderItemsByOrder struct {
 	OrderItems []struct {
-		Image      string `json:"image"`
-		Name       string `json:"name"`
-		Quantity   int    `json:"quantity"`
-		TotalPrice int    `json:"total_price"`
-		UnitPrice  int    `json:"unit_price"`
+		FoodID              string             `json:"food_id"`
+		Image               string             `json:"image"`
+		Name                string             `json:"name"`
+		Quantity            float64            `json:"quantity"`
+		TotalPrice          float64            `json:"total_price"`
+		UnitPrice           float64            `json:"unit_price"`
+		Modifiers           []SelectedModifier `json:"modifiers"`
+		SpecialInstructions string             `json:"special_instructions"`
+		Promotions          []AppliedPromotion `json:"promotions"`
+		ComboItems          []struct {
+			Name     string  `json:"name"`
+			Quantity float64 `json:"quantity"`
+		} `json:"combo_items"`
 	} `json:"order_items"`
-	PaymentDue  int `json:"payment_due"`
-	TableNumber int `json:"table_number"`
-	TotalCount  int `json:"total_count"`
+	PaymentDue  float64 `json:"payment_due"`
+	TableNumber int     `json:"table_number"`
+	TotalCount  int     `json:"total_count"`
 }
 
 type InvoiceViewFormat struct {
-	InvoiceID      string
-	PaymentMethod  string
-	OrderID        string
-	PaymentStatus  *string
-	OrderDetails   interface{}
-	PaymentDue     interface{}
-	TableNumber    interface{}
-	PaymentDueDate time.Time
+	InvoiceID      string            `json:"invoice_id"`
+	InvoiceNumber  *string           `json:"invoice_number"`
+	CreditedTotal  float64           `json:"credited_total"`
+	Replaces       *string           `json:"replaces"`
+	ReplacedBy     *string           `json:"replaced_by"`
+	AccountID      *string           `json:"account_id"`
+	CustomerID     *string           `json:"customer_id"`
+	PaymentMethod  *string           `json:"payment_method"`
+	OrderID        string            `json:"order_id"`
+	PaymentStatus  *string           `json:"payment_status"`
+	SettledAt      *time.Time        `json:"settled_at"`
+	OrderDetails   interface{}       `json:"order_details"`
+	PaymentDue     float64           `json:"payment_due"`
+	TipAmount      *float64          `json:"tip_amount"`
+	GiftCards      []GiftCardPayment `json:"gift_cards"`
+	TableNumber    int               `json:"table_number"`
+	PaymentDueDate time.Time         `json:"payment_due_date"`
+}
+
+// receipt models
+type Receipt struct {
+	Settings      ReceiptSettings
+	Locale        string
+	InvoiceID     string
+	Number        string
+	OrderID       string
+	TableNumber   int
+	Server        string
+	IssuedAt      time.Time
+	Items         []ReceiptLine
+	Subtotal      float64
+	Discounts     []ReceiptDiscount
+	Taxes         []ReceiptTax
+	Tip           *float64
+	Total         float64
+	Payments      []ReceiptPayment
+	PaymentMethod *string
+	PaymentStatus string
+}
+
+type ReceiptLine struct {
+	FoodID    string
+	Name      string
+	Quantity  float64
+	UnitPrice float64
+	Total     float64
+	Modifiers []string
+	Notes     string
+}
+
+type ReceiptDiscount struct {
+	Label  string
+	Amount float64
+}
+
+type ReceiptPayment struct {
+	Label     string
+	Reference string
+	Amount    float64
+}
+
+type ReceiptTax struct {
+	Label  string
+	Amount float64
+}
+
+type KitchenTicket struct {
+	Station     string
+	OrderID     string
+	TableNumber int
+	Server      string
+	CreatedAt   time.Time
+	Items       []KitchenTicketItem
+}
+
+type KitchenTicketItem struct {
+	Name      string
+	Quantity  float64
+	Modifiers []string
+	Notes     string
+}
+
+// catalog import models
+type CatalogRow struct {
+	MenuSKU        *string         `json:"menu_sku" validate:"required"`
+	MenuName       *string         `json:"menu_name"`
+	MenuCategory   *string         `json:"menu_category"`
+	MenuStartDate  *time.Time      `json:"menu_start_date"`
+	MenuEndDate    *time.Time      `json:"menu_end_date"`
+	MenuTimezone   *string         `json:"menu_timezone"`
+	SKU            *string         `json:"sku" validate:"required"`
+	Name           *string         `json:"name"`
+	UnitPrice      *float64        `json:"unit_price"`
+	FoodImage      *string         `json:"food_image"`
+	Available      *bool           `json:"available"`
+	ModifierGroups []ModifierGroup `json:"modifier_groups"`
+	Recipe         []RecipeLine    `json:"recipe"`
+}
+
+type CatalogImportError struct {
+	Row   int    `json:"row"`
+	SKU   string `json:"sku"`
+	Error string `json:"error"`
+}
+
+type CatalogImportReport struct {
+	DryRun       bool                 `json:"dry_run"`
+	Rows         int                  `json:"rows"`
+	MenusCreated int                  `json:"menus_created"`
+	MenusUpdated int                  `json:"menus_updated"`
+	FoodsCreated int                  `json:"foods_created"`
+	FoodsUpdated int                  `json:"foods_updated"`
+	Errors       []CatalogImportError `json:"errors"`
+}
+
+// batch operation models
+type BatchResult struct {
+	Index int    `json:"index"`
+	Key   string `json:"key"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+type BatchResponse struct {
+	Atomic    bool          `json:"atomic"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+type StockAdjustment struct {
+	Quantity *float64 `json:"quantity" validate:"required"`
+}
+
+type FoodAvailability struct {
+	Available         *bool    `json:"available"`
+	RemainingPortions *float64 `json:"remaining_portions" validate:"omitempty,gte=0"`
+	ClearPortions     bool     `json:"clear_portions"`
+}
+
+type FoodAvailabilityEvent struct {
+	FoodID            string   `json:"food_id"`
+	Name              string   `json:"name"`
+	Available         bool     `json:"available"`
+	RemainingPortions *float64 `json:"remaining_portions"`
+	SoldOut           bool     `json:"sold_out"`
+}
+
+type ReorderSuggestion struct {
+	IngredientID      string  `json:"ingredient_id"`
+	Name              string  `json:"name"`
+	Unit              string  `json:"unit"`
+	SupplierID        string  `json:"supplier_id"`
+	StockOnHand       float64 `json:"stock_on_hand"`
+	OnOrder           float64 `json:"on_order"`
+	ParLevel          float64 `json:"par_level"`
+	AverageDailyUsage float64 `json:"average_daily_usage"`
+	LeadTimeDays      int     `json:"lead_time_days"`
+	SuggestedQuantity float64 `json:"suggested_quantity"`
+}
+
+type FoodCost struct {
+	FoodID        string  `json:"food_id"`
+	Name          string  `json:"name"`
+	UnitPrice     float64 `json:"unit_price"`
+	Cost          float64 `json:"cost"`
+	Margin        float64 `json:"margin"`
+	MarginPercent float64 `json:"margin_percent"`
+	MissingCosts  bool    `json:"missing_costs"`
+}
+
+type MenuEngineeringItem struct {
+	FoodCost
+	QuantitySold       float64 `json:"quantity_sold"`
+	Revenue            float64 `json:"revenue"`
+	ContributionMargin float64 `json:"contribution_margin"`
+	MenuMixPercent     float64 `json:"menu_mix_percent"`
+	Popularity         string  `json:"popularity"`
+	Profitability      string  `json:"profitability"`
+	Category           string  `json:"category"`
+}
+
+type MenuEngineeringReport struct {
+	From                      time.Time             `json:"from"`
+	To                        time.Time             `json:"to"`
+	TotalSold                 float64               `json:"total_sold"`
+	PopularityThreshold       float64               `json:"popularity_threshold"`
+	AverageContributionMargin float64               `json:"average_contribution_margin"`
+	Items                     []MenuEngineeringItem `json:"items"`
+}
+
+type SalesReportRow struct {
+	Key          string  `json:"key"`
+	Label        string  `json:"label"`
+	Orders       int     `json:"orders"`
+	ItemsSold    float64 `json:"items_sold"`
+	Revenue      float64 `json:"revenue"`
+	Covers       int     `json:"covers"`
+	AverageCheck float64 `json:"average_check"`
+}
+
+type SalesReport struct {
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	GroupBy string           `json:"group_by"`
+	Rows    []SalesReportRow `json:"rows"`
+}
+
+type PaymentMethodShare struct {
+	PaymentMethod string  `json:"payment_method"`
+	Invoices      int     `json:"invoices"`
+	Amount        float64 `json:"amount"`
+	Percent       float64 `json:"percent"`
+}
+
+type SalesSummary struct {
+	From            time.Time            `json:"from"`
+	To              time.Time            `json:"to"`
+	Orders          int                  `json:"orders"`
+	ItemsSold       float64              `json:"items_sold"`
+	Revenue         float64              `json:"revenue"`
+	Discounted      float64              `json:"discounted"`
+	Credited        float64              `json:"credited"`
+	Covers          int                  `json:"covers"`
+	AverageCheck    float64              `json:"average_check"`
+	RevenuePerCover float64              `json:"revenue_per_cover"`
+	PaymentMethods  []PaymentMethodShare `json:"payment_methods"`
+}
+
+type ZReport struct {
+	SalesSummary
+	BusinessDate     string           `json:"business_date"`
+	Timezone         string           `json:"timezone"`
+	FirstOrderAt     *time.Time       `json:"first_order_at"`
+	LastOrderAt      *time.Time       `json:"last_order_at"`
+	PaidInvoices     int              `json:"paid_invoices"`
+	OpenInvoices     int              `json:"open_invoices"`
+	UninvoicedOrders int              `json:"uninvoiced_orders"`
+	Foods            []SalesReportRow `json:"foods"`
+	Servers          []SalesReportRow `json:"servers"`
+	GeneratedAt      time.Time        `json:"generated_at"`
+}
+
+// house account models
+type OverdueInvoice struct {
+	InvoiceID     string    `json:"invoice_id"`
+	InvoiceNumber *string   `json:"invoice_number"`
+	AccountID     *string   `json:"account_id"`
+	OrderID       string    `json:"order_id"`
+	PaymentStatus string    `json:"payment_status"`
+	DueDate       time.Time `json:"due_date"`
+	DaysOverdue   int       `json:"days_overdue"`
+	AmountDue     float64   `json:"amount_due"`
+	RemindersSent int       `json:"reminders_sent"`
+}
+
+type StatementLine struct {
+	Date      time.Time  `json:"date"`
+	Type      string     `json:"type"`
+	InvoiceID string     `json:"invoice_id"`
+	Reference string     `json:"reference"`
+	DueDate   *time.Time `json:"due_date"`
+	Amount    float64    `json:"amount"`
+	Balance   float64    `json:"balance"`
+}
+
+type AccountStatement struct {
+	Account        Account         `json:"account"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance float64         `json:"opening_balance"`
+	Charges        float64         `json:"charges"`
+	Payments       float64         `json:"payments"`
+	Credits        float64         `json:"credits"`
+	ClosingBalance float64         `json:"closing_balance"`
+	Overdue        float64         `json:"overdue"`
+	Lines          []StatementLine `json:"lines"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+}
+
+// customer models
+type CustomerOrderItem struct {
+	FoodID     string  `json:"food_id"`
+	Name       string  `json:"name"`
+	Quantity   float64 `json:"quantity"`
+	TotalPrice float64 `json:"total_price"`
+}
+
+type CustomerOrder struct {
+	OrderID       string              `json:"order_id"`
+	OrderDate     time.Time           `json:"order_date"`
+	TableID       *string             `json:"table_id"`
+	Server        *string             `json:"server"`
+	NumberOfGuest *int                `json:"number_of_guest"`
+	Items         []CustomerOrderItem `json:"items"`
+	Total         float64             `json:"total"`
+	InvoiceID     *string             `json:"invoice_id"`
+	InvoiceNumber *string             `json:"invoice_number"`
+	PaymentStatus *string             `json:"payment_status"`
+}
+
+type CustomerHistory struct {
+	Customer    Customer        `json:"customer"`
+	Visits      int             `json:"visits"`
+	TotalSpent  float64         `json:"total_spent"`
+	LastVisitAt *time.Time      `json:"last_visit_at"`
+	Orders      []CustomerOrder `json:"orders"`
+}
+
+// customers that share a phone number or email address
+type CustomerDuplicates struct {
+	MatchedOn string     `json:"matched_on"`
+	Value     string     `json:"value"`
+	Customers []Customer `json:"customers"`
+}
+
+type CustomerMerge struct {
+	DuplicateIDs []string `json:"duplicate_ids" validate:"required,min=1,max=50,dive,required"`
+}
+
+// loyalty models
+type LoyaltyAccount struct {
+	CustomerID       string               `json:"customer_id"`
+	Points           int                  `json:"points"`
+	LifetimePoints   int                  `json:"lifetime_points"`
+	Tier             string               `json:"tier"`
+	NextTier         *string              `json:"next_tier"`
+	PointsToNextTier int                  `json:"points_to_next_tier"`
+	ExpiringSoon     int                  `json:"expiring_soon"`
+	Transactions     []LoyaltyTransaction `json:"transactions"`
+}
+
+type LoyaltyRedemption struct {
+	RewardCode string `json:"reward_code" validate:"required"`
+}
+
+type LoyaltyAdjustment struct {
+	Points int    `json:"points" validate:"required,ne=0"`
+	Reason string `json:"reason" validate:"required,max=200"`
+}
+
+// gift card models
+type GiftCardIssue struct {
+	Amount        float64    `json:"amount" validate:"required,gt=0,lte=10000"`
+	PaymentMethod string     `json:"payment_method" validate:"required,eq=CARD|eq=CASH"`
+	IssuedTo      *string    `json:"issued_to" validate:"omitempty,max=100"`
+	CustomerID    *string    `json:"customer_id"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+}
+
+type GiftCardLoad struct {
+	Amount        float64 `json:"amount" validate:"required,gt=0,lte=10000"`
+	PaymentMethod string  `json:"payment_method" validate:"required,eq=CARD|eq=CASH"`
+}
+
+type GiftCardRedemption struct {
+	Code   string   `json:"code" validate:"required"`
+	Amount *float64 `json:"amount" validate:"omitempty,gt=0"`
+}
+
+type GiftCardBalance struct {
+	CardEnding string     `json:"card_ending"`
+	Balance    float64    `json:"balance"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Usable     bool       `json:"usable"`
+}
+
+// outstanding gift card liability; the ledger balance must match the sum of
+// the card balances
+type GiftCardLiability struct {
+	Cards         int     `json:"cards"`
+	Issued        float64 `json:"issued"`
+	Reloaded      float64 `json:"reloaded"`
+	Redeemed      float64 `json:"redeemed"`
+	Refunded      float64 `json:"refunded"`
+	LedgerBalance float64 `json:"ledger_balance"`
+	Outstanding   float64 `json:"outstanding"`
+	Difference    float64 `json:"difference"`
+	Reconciled    bool    `json:"reconciled"`
+}
+
+// ordered item containing allergens the order's customer declared
+type AllergenWarning struct {
+	OrderItemID string   `json:"order_item_id"`
+	FoodID      string   `json:"food_id"`
+	FoodName    string   `json:"food_name"`
+	Allergens   []string `json:"allergens"`
 }
@@ -0,0 +1,10 @@
+// Package money holds the rounding every amount shown to a guest goes
+// through.
+package money
+
+import "math"
+
+// Round rounds an amount to cents.
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,186 @@
+package printer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	Network = "NETWORK"
+	File    = "FILE"
+)
+
+// DefaultPort is the raw printing port most network receipt printers use.
+const DefaultPort = "9100"
+
+// receipt printers sit on the local network, so only private ranges are
+// reachable unless PRINTER_NETWORKS says otherwise
+const defaultNetworks = "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+
+var (
+	DialTimeout  = 5 * time.Second
+	WriteTimeout = 10 * time.Second
+)
+
+var errSpoolName = errors.New("file printers are addressed by the name of a directory inside the spool directory")
+
+// Printer sends a complete ESC/POS byte stream to a device.
+type Printer interface {
+	Print(data []byte) error
+}
+
+// Targets limits where printers may send their jobs. Printer addresses come
+// from API clients, so file printers only name a directory inside SpoolDir
+// and network printers must be in one of Networks and listen on one of Ports.
+type Targets struct {
+	SpoolDir string
+	Networks []*net.IPNet
+	Ports    []string
+}
+
+// TargetsFromEnv reads the spool directory from PRINTER_SPOOL_DIR, the
+// allowed networks as comma separated CIDR ranges from PRINTER_NETWORKS and
+// the allowed ports from PRINTER_PORTS.
+func TargetsFromEnv() (*Targets, error) {
+	targets := &Targets{SpoolDir: getenv("PRINTER_SPOOL_DIR", "spool")}
+	for _, cidr := range strings.Split(getenv("PRINTER_NETWORKS", defaultNetworks), ",") {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid printer network %q", cidr)
+		}
+		targets.Networks = append(targets.Networks, network)
+	}
+	for _, port := range strings.Split(getenv("PRINTER_PORTS", DefaultPort), ",") {
+		targets.Ports = append(targets.Ports, strings.TrimSpace(port))
+	}
+	return targets, nil
+}
+
+// New returns the printer for a connection type. Network printers are
+// addressed as host or host:port, file printers by a directory name.
+func (t *Targets) New(connection, address string) (Printer, error) {
+	switch connection {
+	case Network:
+		host, port, err := t.networkAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		return networkPrinter{targets: t, host: host, port: port}, nil
+	case File:
+		if address == "." || address == ".." || address != filepath.Base(address) || strings.ContainsAny(address, `/\`) {
+			return nil, errSpoolName
+		}
+		return filePrinter{dir: filepath.Join(t.SpoolDir, address)}, nil
+	}
+	return nil, fmt.Errorf("unknown printer connection %q", connection)
+}
+
+// Check reports why a printer cannot be given the address, if it cannot.
+func (t *Targets) Check(connection, address string) error {
+	_, err := t.New(connection, address)
+	return err
+}
+
+func (t *Targets) networkAddress(address string) (string, string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, DefaultPort
+	}
+	if host == "" {
+		return "", "", errors.New("network printers need a host")
+	}
+	if !contains(t.Ports, port) {
+		return "", "", fmt.Errorf("network printers may only use port %s", strings.Join(t.Ports, ", "))
+	}
+	// host names are checked once they are resolved
+	if ip := net.ParseIP(host); ip != nil && !t.allowed(ip) {
+		return "", "", fmt.Errorf("%s is outside the printer networks", host)
+	}
+	return host, port, nil
+}
+
+func (t *Targets) allowed(ip net.IP) bool {
+	for _, network := range t.Networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type networkPrinter struct {
+	targets *Targets
+	host    string
+	port    string
+}
+
+// Print connects to the first address of the host inside the printer
+// networks, so a name that resolves elsewhere is never dialled.
+func (p networkPrinter) Print(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DialTimeout)
+	defer cancel()
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, p.host)
+	if err != nil {
+		return err
+	}
+	address := ""
+	for _, candidate := range addresses {
+		if p.targets.allowed(candidate.IP) {
+			address = net.JoinHostPort(candidate.IP.String(), p.port)
+			break
+		}
+	}
+	if address == "" {
+		return fmt.Errorf("%s does not resolve to an address in the printer networks", p.host)
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	_, err = conn.Write(data)
+	return err
+}
+
+// filePrinter stands in for a real device by writing every job to its own
+// file, so tickets can be inspected without hardware.
+type filePrinter struct {
+	dir string
+}
+
+var fileSequence atomic.Int64
+
+func (p filePrinter) Print(data []byte) error {
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%04d.escpos", time.Now().Format("20060102-150405.000"), fileSequence.Add(1)%10000)
+	return os.WriteFile(filepath.Join(p.dir, name), data, 0o644)
+}
+
+func getenv(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
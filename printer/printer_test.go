@@ -0,0 +1,109 @@
+package printer
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func testTargets(t *testing.T) *Targets {
+	t.Setenv("PRINTER_SPOOL_DIR", "/var/spool/pos")
+	t.Setenv("PRINTER_NETWORKS", "192.168.0.0/16, fd00::/8")
+	t.Setenv("PRINTER_PORTS", "9100,9101")
+	targets, err := TargetsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return targets
+}
+
+func TestTargetsFilePrinter(t *testing.T) {
+	targets := testTargets(t)
+	tests := []struct {
+		address string
+		dir     string
+	}{
+		{"kitchen", "/var/spool/pos/kitchen"},
+		{"bar-2", "/var/spool/pos/bar-2"},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"../etc", ""},
+		{"/etc", ""},
+		{"kitchen/../../etc", ""},
+		{`..\windows`, ""},
+	}
+	for _, test := range tests {
+		p, err := targets.New(File, test.address)
+		if test.dir == "" {
+			if err == nil {
+				t.Errorf("New(FILE, %q) was allowed", test.address)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("New(FILE, %q) failed: %v", test.address, err)
+			continue
+		}
+		if dir := p.(filePrinter).dir; dir != filepath.FromSlash(test.dir) {
+			t.Errorf("New(FILE, %q) writes to %q, want %q", test.address, dir, test.dir)
+		}
+	}
+}
+
+func TestTargetsNetworkPrinter(t *testing.T) {
+	targets := testTargets(t)
+	tests := []struct {
+		address string
+		host    string
+		port    string
+	}{
+		{"192.168.1.20", "192.168.1.20", "9100"},
+		{"192.168.1.20:9101", "192.168.1.20", "9101"},
+		{"[fd00::20]:9100", "fd00::20", "9100"},
+		{"printer.local", "printer.local", "9100"},
+		{"192.168.1.20:22", "", ""},
+		{"10.0.0.5", "", ""},
+		{"127.0.0.1:9100", "", ""},
+		{"169.254.169.254", "", ""},
+		{":9100", "", ""},
+	}
+	for _, test := range tests {
+		p, err := targets.New(Network, test.address)
+		if test.host == "" {
+			if err == nil {
+				t.Errorf("New(NETWORK, %q) was allowed", test.address)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("New(NETWORK, %q) failed: %v", test.address, err)
+			continue
+		}
+		network := p.(networkPrinter)
+		if network.host != test.host || network.port != test.port {
+			t.Errorf("New(NETWORK, %q) = %s port %s, want %s port %s", test.address, network.host, network.port, test.host, test.port)
+		}
+	}
+}
+
+func TestNetworkPrinterRefusesResolvedAddressOutsideNetworks(t *testing.T) {
+	targets := testTargets(t)
+	p, err := targets.New(Network, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Print([]byte("test")); err == nil {
+		t.Error("printing to localhost was allowed")
+	}
+}
+
+func TestTargetsFromEnvRejectsInvalidNetwork(t *testing.T) {
+	t.Setenv("PRINTER_NETWORKS", "192.168.0.0")
+	if _, err := TargetsFromEnv(); err == nil {
+		t.Error("invalid network was accepted")
+	}
+	if (&Targets{}).allowed(net.ParseIP("192.168.1.1")) {
+		t.Error("an empty network list allows addresses")
+	}
+}
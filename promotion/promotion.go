@@ -0,0 +1,157 @@
+// Package promotion works out what the running promotions take off the
+// items of an order.
+package promotion
+
+import (
+	"main/model"
+	"main/money"
+	"main/schedule"
+	"math"
+	"sort"
+)
+
+// Item is an order item together with the menu of its food.
+type Item struct {
+	model.OrderItem
+	MenuID string `json:"menu_id"`
+}
+
+var rank = map[string]int{"BUNDLE": 0, "BOGO": 1, "FIXED": 2, "PERCENT": 3}
+
+// Evaluate works out what every promotion takes off the items.
+// A unit takes part in one promotion at most: bundles are matched first,
+// then multi-buys, then plain discounts, each in the order they were created.
+// An item only qualifies when the promotion was running when it was ordered.
+func Evaluate(promotions []model.Promotion, items []Item) [][]model.AppliedPromotion {
+	sort.SliceStable(promotions, func(i, j int) bool {
+		if rank[*promotions[i].Type] != rank[*promotions[j].Type] {
+			return rank[*promotions[i].Type] < rank[*promotions[j].Type]
+		}
+		return promotions[i].CreatedAt.Before(promotions[j].CreatedAt)
+	})
+
+	// units of each item not yet taken by a promotion
+	free := make([]float64, len(items))
+	for i, item := range items {
+		free[i] = *item.Quantity
+	}
+	applied := make([][]model.AppliedPromotion, len(items))
+	give := func(i int, promotion model.Promotion, amount float64) {
+		amount = money.Round(amount)
+		if amount <= 0 {
+			return
+		}
+		for j := range applied[i] {
+			if applied[i][j].PromotionID == promotion.PromotionID {
+				applied[i][j].Amount = money.Round(applied[i][j].Amount + amount)
+				return
+			}
+		}
+		applied[i] = append(applied[i], model.AppliedPromotion{PromotionID: promotion.PromotionID, Name: *promotion.Name, Amount: amount})
+	}
+
+	for _, promotion := range promotions {
+		eligible := func(i int) bool {
+			item := items[i]
+			return free[i] > 0 &&
+				(len(promotion.FoodIDs) == 0 || contains(promotion.FoodIDs, *item.FoodID)) &&
+				(len(promotion.MenuIDs) == 0 || contains(promotion.MenuIDs, item.MenuID)) &&
+				schedule.Active(promotion.StartDate, promotion.EndDate, promotion.Timezone, promotion.Schedules, item.CreatedAt)
+		}
+		value := *promotion.Value
+
+		switch *promotion.Type {
+		case "PERCENT", "FIXED":
+			for i, item := range items {
+				if !eligible(i) {
+					continue
+				}
+				off := *item.UnitPrice * value / 100
+				if *promotion.Type == "FIXED" {
+					off = math.Min(value, *item.UnitPrice)
+				}
+				give(i, promotion, off*free[i])
+				free[i] = 0
+			}
+
+		case "BOGO":
+			// whole units, dearest first, so the cheapest of every group is free
+			units := []int{}
+			for i := range items {
+				if eligible(i) {
+					for n := 0; n < int(free[i]); n++ {
+						units = append(units, i)
+					}
+				}
+			}
+			sort.SliceStable(units, func(a, b int) bool {
+				return *items[units[a]].UnitPrice > *items[units[b]].UnitPrice
+			})
+			group := promotion.BuyQuantity + promotion.FreeQuantity
+			for start := 0; start+group <= len(units); start += group {
+				for k, i := range units[start : start+group] {
+					free[i]--
+					if k >= promotion.BuyQuantity {
+						give(i, promotion, *items[i].UnitPrice*value/100)
+					}
+				}
+			}
+
+		case "BUNDLE":
+			for {
+				taken := make(map[int]float64)
+				complete := true
+				for _, component := range promotion.BundleItems {
+					needed := component.Quantity
+					for i, item := range items {
+						if needed <= 0 {
+							break
+						}
+						if *item.FoodID != component.FoodID || !eligible(i) {
+							continue
+						}
+						take := math.Min(free[i]-taken[i], needed)
+						if take > 0 {
+							taken[i] += take
+							needed -= take
+						}
+					}
+					if needed > 1e-9 {
+						complete = false
+						break
+					}
+				}
+				if !complete {
+					break
+				}
+
+				gross := 0.0
+				for i, quantity := range taken {
+					gross += *items[i].UnitPrice * quantity
+				}
+				for i, quantity := range taken {
+					free[i] -= quantity
+					if gross > value {
+						give(i, promotion, (gross-value)*(*items[i].UnitPrice*quantity)/gross)
+					}
+				}
+			}
+		}
+	}
+
+	for i := range applied {
+		if applied[i] == nil {
+			applied[i] = []model.AppliedPromotion{}
+		}
+	}
+	return applied
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
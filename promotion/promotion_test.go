@@ -0,0 +1,153 @@
+package promotion
+
+import (
+	"main/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var ordered = time.Date(2026, 3, 16, 12, 0, 0, 0, time.UTC)
+
+func item(foodID, menuID string, quantity, unitPrice float64) Item {
+	return Item{
+		OrderItem: model.OrderItem{FoodID: &foodID, Quantity: &quantity, UnitPrice: &unitPrice, CreatedAt: ordered},
+		MenuID:    menuID,
+	}
+}
+
+func promotion(id, kind string, value float64, created int) model.Promotion {
+	return model.Promotion{
+		PromotionID: id,
+		Name:        &id,
+		Type:        &kind,
+		Value:       &value,
+		CreatedAt:   ordered.AddDate(0, 0, created-30),
+	}
+}
+
+func off(id string, amount float64) []model.AppliedPromotion {
+	return []model.AppliedPromotion{{PromotionID: id, Name: id, Amount: amount}}
+}
+
+var none = []model.AppliedPromotion{}
+
+func TestEvaluate(t *testing.T) {
+	pastaOnly := promotion("pasta-3-off", "FIXED", 3, 1)
+	pastaOnly.FoodIDs = []string{"pasta"}
+
+	drinks := promotion("drinks-half", "PERCENT", 50, 1)
+	drinks.MenuIDs = []string{"drinks"}
+
+	bogo := promotion("bogo", "BOGO", 100, 1)
+	bogo.BuyQuantity, bogo.FreeQuantity = 1, 1
+
+	threeForTwo := promotion("third-half", "BOGO", 50, 1)
+	threeForTwo.BuyQuantity, threeForTwo.FreeQuantity = 2, 1
+
+	bundle := promotion("menu-deal", "BUNDLE", 10, 2)
+	bundle.BundleItems = []model.ComboItem{{FoodID: "burger", Quantity: 1}, {FoodID: "fries", Quantity: 1}}
+
+	ended := promotion("ended", "PERCENT", 10, 1)
+	yesterday := ordered.AddDate(0, 0, -1)
+	ended.EndDate = &yesterday
+
+	tests := []struct {
+		name       string
+		promotions []model.Promotion
+		items      []Item
+		want       [][]model.AppliedPromotion
+	}{
+		{
+			name:       "percent off everything",
+			promotions: []model.Promotion{promotion("tenth", "PERCENT", 10, 1)},
+			items:      []Item{item("pasta", "main", 2, 10), item("soup", "main", 1, 5)},
+			want:       [][]model.AppliedPromotion{off("tenth", 2), off("tenth", 0.5)},
+		},
+		{
+			name:       "fixed off one food",
+			promotions: []model.Promotion{pastaOnly},
+			items:      []Item{item("pasta", "main", 2, 10), item("soup", "main", 1, 5)},
+			want:       [][]model.AppliedPromotion{off("pasta-3-off", 6), none},
+		},
+		{
+			name:       "fixed never below zero",
+			promotions: []model.Promotion{pastaOnly},
+			items:      []Item{item("pasta", "main", 1, 2)},
+			want:       [][]model.AppliedPromotion{off("pasta-3-off", 2)},
+		},
+		{
+			name:       "one menu",
+			promotions: []model.Promotion{drinks},
+			items:      []Item{item("lemonade", "drinks", 1, 4), item("pasta", "main", 1, 10)},
+			want:       [][]model.AppliedPromotion{off("drinks-half", 2), none},
+		},
+		{
+			name:       "buy one get the cheaper free",
+			promotions: []model.Promotion{bogo},
+			items:      []Item{item("pasta", "main", 1, 12), item("risotto", "main", 1, 10), item("soup", "main", 1, 5)},
+			want:       [][]model.AppliedPromotion{none, off("bogo", 10), none},
+		},
+		{
+			name:       "third unit at half price",
+			promotions: []model.Promotion{threeForTwo},
+			items:      []Item{item("beer", "drinks", 3, 8)},
+			want:       [][]model.AppliedPromotion{off("third-half", 4)},
+		},
+		{
+			name:       "incomplete multi-buy",
+			promotions: []model.Promotion{threeForTwo},
+			items:      []Item{item("beer", "drinks", 2, 8)},
+			want:       [][]model.AppliedPromotion{none},
+		},
+		{
+			name:       "bundle split by price",
+			promotions: []model.Promotion{bundle},
+			items:      []Item{item("burger", "main", 1, 8), item("fries", "main", 1, 4)},
+			want:       [][]model.AppliedPromotion{off("menu-deal", 1.33), off("menu-deal", 0.67)},
+		},
+		{
+			name:       "bundle matched twice",
+			promotions: []model.Promotion{bundle},
+			items:      []Item{item("burger", "main", 2, 8), item("fries", "main", 2, 4)},
+			want:       [][]model.AppliedPromotion{off("menu-deal", 2.66), off("menu-deal", 1.34)},
+		},
+		{
+			name:       "incomplete bundle",
+			promotions: []model.Promotion{bundle},
+			items:      []Item{item("burger", "main", 1, 8)},
+			want:       [][]model.AppliedPromotion{none},
+		},
+		{
+			name:       "bundle before older percent",
+			promotions: []model.Promotion{promotion("tenth", "PERCENT", 10, 1), bundle},
+			items:      []Item{item("burger", "main", 1, 8), item("fries", "main", 1, 4), item("cola", "drinks", 1, 3)},
+			want:       [][]model.AppliedPromotion{off("menu-deal", 1.33), off("menu-deal", 0.67), off("tenth", 0.3)},
+		},
+		{
+			name:       "first of two percents wins",
+			promotions: []model.Promotion{promotion("later", "PERCENT", 50, 2), promotion("earlier", "PERCENT", 10, 1)},
+			items:      []Item{item("pasta", "main", 1, 10)},
+			want:       [][]model.AppliedPromotion{off("earlier", 1)},
+		},
+		{
+			name:       "ended before the item was ordered",
+			promotions: []model.Promotion{ended},
+			items:      []Item{item("pasta", "main", 1, 10)},
+			want:       [][]model.AppliedPromotion{none},
+		},
+		{
+			name:  "no promotions",
+			items: []Item{item("pasta", "main", 1, 10)},
+			want:  [][]model.AppliedPromotion{none},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Evaluate(test.promotions, test.items)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Evaluate() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package receipt
+
+import (
+	"bytes"
+	"io"
+)
+
+var (
+	escposInit         = []byte{0x1b, '@'}
+	escposCodePage     = []byte{0x1b, 't', 16} // WPC1252
+	escposAlignLeft    = []byte{0x1b, 'a', 0}
+	escposAlignCenter  = []byte{0x1b, 'a', 1}
+	escposBoldOn       = []byte{0x1b, 'E', 1}
+	escposBoldOff      = []byte{0x1b, 'E', 0}
+	escposNormalSize   = []byte{0x1d, '!', 0x00}
+	escposDoubleHeight = []byte{0x1d, '!', 0x01}
+	escposDoubleSize   = []byte{0x1d, '!', 0x11}
+	escposFeed         = []byte{0x1b, 'd', 4}
+	escposCut          = []byte{0x1d, 'V', 66, 0}
+)
+
+// writeESCPOS wraps the plain-text receipt in the commands a thermal printer
+// needs to print it and cut the paper.
+func writeESCPOS(w io.Writer, text string) error {
+	var out bytes.Buffer
+	out.Write(escposInit)
+	out.Write(escposCodePage)
+	out.Write(encodeWinAnsi(text))
+	if !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	out.Write(escposFeed)
+	out.Write(escposCut)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,68 @@
+package receipt
+
+import (
+	"bytes"
+	"main/model"
+	"testing"
+	"time"
+)
+
+func TestRenderESCPOS(t *testing.T) {
+	data := sampleReceipt()
+	out := renderSample(t, ESCPOS, data)
+
+	var text bytes.Buffer
+	if err := Render(&text, Text, data); err != nil {
+		t.Fatal(err)
+	}
+
+	want := append([]byte{0x1b, '@', 0x1b, 't', 16}, encodeWinAnsi(text.String())...)
+	if !bytes.HasSuffix(want, []byte("\n")) {
+		want = append(want, '\n')
+	}
+	want = append(want, 0x1b, 'd', 4, 0x1d, 'V', 66, 0)
+	if !bytes.Equal(out, want) {
+		t.Errorf("escpos output = %q, want %q", out, want)
+	}
+	if !bytes.Contains(out, []byte("Cr\xe8me br\xfbl\xe9e")) {
+		t.Error("escpos output is not encoded in Windows-1252")
+	}
+}
+
+func TestRenderKitchenTicket(t *testing.T) {
+	ticket := model.KitchenTicket{
+		Station:     "GRILL",
+		OrderID:     "o1",
+		TableNumber: 7,
+		Server:      "Ana",
+		CreatedAt:   time.Date(2024, 3, 1, 20, 15, 0, 0, time.UTC),
+		Items: []model.KitchenTicketItem{
+			{Name: "Steak", Quantity: 2, Modifiers: []string{"medium"}, Notes: "no salt"},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := RenderKitchenTicket(&out, ticket, 16); err != nil {
+		t.Fatal(err)
+	}
+
+	var want bytes.Buffer
+	want.Write([]byte{0x1b, '@', 0x1b, 't', 16})
+	want.Write([]byte{0x1b, 'a', 1, 0x1d, '!', 0x11})
+	want.WriteString("GRILL\nTABLE 7\n")
+	want.Write([]byte{0x1d, '!', 0x00, 0x1b, 'a', 0})
+	want.WriteString("Ana        20:15\n----------------\n")
+	want.Write([]byte{0x1d, '!', 0x01})
+	want.WriteString("2 x Steak\n")
+	want.Write([]byte{0x1d, '!', 0x00})
+	want.WriteString("   + medium\n")
+	want.Write([]byte{0x1b, 'E', 1})
+	want.WriteString("   * no salt\n")
+	want.Write([]byte{0x1b, 'E', 0})
+	want.WriteString("----------------\nOrder o1\n")
+	want.Write([]byte{0x1b, 'd', 4, 0x1d, 'V', 66, 0})
+
+	if !bytes.Equal(out.Bytes(), want.Bytes()) {
+		t.Errorf("kitchen ticket = %q, want %q", out.Bytes(), want.Bytes())
+	}
+}
@@ -0,0 +1,69 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"main/model"
+	"strconv"
+	"strings"
+)
+
+// RenderKitchenTicket writes an ESC/POS kitchen ticket. Station and table are
+// printed large and items in double height so they can be read at a distance.
+func RenderKitchenTicket(w io.Writer, ticket model.KitchenTicket, width int) error {
+	if width == 0 {
+		width = DefaultWidth
+	}
+
+	var out bytes.Buffer
+	text := func(s string) {
+		out.Write(encodeWinAnsi(s))
+		out.WriteByte('\n')
+	}
+
+	out.Write(escposInit)
+	out.Write(escposCodePage)
+
+	out.Write(escposAlignCenter)
+	out.Write(escposDoubleSize)
+	text(ticket.Station)
+	if ticket.TableNumber != 0 {
+		text(fmt.Sprintf("TABLE %d", ticket.TableNumber))
+	}
+	out.Write(escposNormalSize)
+	out.Write(escposAlignLeft)
+
+	header := ticket.CreatedAt.Format("15:04")
+	if ticket.Server != "" {
+		gap := width - len(ticket.Server) - len(header)
+		if gap < 1 {
+			gap = 1
+		}
+		header = ticket.Server + strings.Repeat(" ", gap) + header
+	}
+	text(header)
+	text(strings.Repeat("-", width))
+
+	for _, item := range ticket.Items {
+		out.Write(escposDoubleHeight)
+		text(strconv.FormatFloat(item.Quantity, 'f', -1, 64) + " x " + item.Name)
+		out.Write(escposNormalSize)
+		for _, modifier := range item.Modifiers {
+			text("   + " + modifier)
+		}
+		if item.Notes != "" {
+			out.Write(escposBoldOn)
+			text("   * " + item.Notes)
+			out.Write(escposBoldOff)
+		}
+	}
+
+	text(strings.Repeat("-", width))
+	text("Order " + ticket.OrderID)
+	out.Write(escposFeed)
+	out.Write(escposCut)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
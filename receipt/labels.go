@@ -0,0 +1,51 @@
+package receipt
+
+import "golang.org/x/text/language"
+
+// labels translates the texts of the default templates. Languages and texts
+// missing here are printed in English.
+var labels = map[string]map[string]string{
+	"es": {
+		"Invoice":   "Factura",
+		"Table":     "Mesa",
+		"Server":    "Camarero",
+		"Tel":       "Tel.",
+		"Tax ID":    "NIF",
+		"Subtotal":  "Subtotal",
+		"Tip":       "Propina",
+		"Total":     "Total",
+		"TOTAL":     "TOTAL",
+		"Gift card": "Tarjeta regalo",
+		"Payment":   "Pago",
+		"Status":    "Estado",
+		"PAID":      "PAGADO",
+		"PENDING":   "PENDIENTE",
+		"OVERDUE":   "VENCIDO",
+	},
+	"de": {
+		"Invoice":   "Rechnung",
+		"Table":     "Tisch",
+		"Server":    "Bedienung",
+		"Tel":       "Tel.",
+		"Tax ID":    "USt-IdNr.",
+		"Subtotal":  "Zwischensumme",
+		"Tip":       "Trinkgeld",
+		"Total":     "Gesamt",
+		"TOTAL":     "GESAMT",
+		"Gift card": "Geschenkkarte",
+		"Payment":   "Zahlung",
+		"Status":    "Status",
+		"PAID":      "BEZAHLT",
+		"PENDING":   "OFFEN",
+		"OVERDUE":   "ÜBERFÄLLIG",
+	},
+}
+
+// Label returns text in the language of locale, such as "es" or "de-AT".
+func Label(locale, text string) string {
+	base, _ := language.Make(locale).Base()
+	if translated, ok := labels[base.String()][text]; ok {
+		return translated
+	}
+	return text
+}
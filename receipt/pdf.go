@@ -0,0 +1,64 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	pdfFontSize = 9
+	pdfLeading  = 11
+	pdfMargin   = 12
+	// Courier glyphs are 600/1000 of the font size wide
+	pdfCharWidth = pdfFontSize * 0.6
+)
+
+// writePDF lays the plain-text receipt out on a single page as wide as the
+// receipt roll, using the built-in Courier font so nothing has to be embedded.
+func writePDF(w io.Writer, text string, width int) error {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	pageWidth := float64(width)*pdfCharWidth + 2*pdfMargin
+	pageHeight := float64(len(lines)*pdfLeading + 2*pdfMargin)
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %.2f Td\n", pdfFontSize, pdfLeading, pdfMargin, pageHeight-pdfMargin-pdfFontSize)
+	for _, line := range lines {
+		content.WriteByte('(')
+		for _, b := range encodeWinAnsi(line) {
+			if b == '(' || b == ')' || b == '\\' {
+				content.WriteByte('\\')
+			}
+			content.WriteByte(b)
+		}
+		content.WriteString(") Tj T*\n")
+	}
+	content.WriteString("ET")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>", pageWidth, pageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,59 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var pdfStartXref = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+
+func TestRenderPDFXref(t *testing.T) {
+	out := renderSample(t, PDF, sampleReceipt())
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) {
+		t.Fatalf("pdf does not start with a header: %q", out[:16])
+	}
+	match := pdfStartXref.FindSubmatch(out)
+	if match == nil {
+		t.Fatal("pdf has no startxref trailer")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n0 6\n0000000000 65535 f \n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	entries := out[xref+len("xref\n0 6\n0000000000 65535 f \n"):]
+	for object := 1; object <= 5; object++ {
+		entry := string(entries[:20])
+		entries = entries[20:]
+		offset, err := strconv.Atoi(entry[:10])
+		if err != nil || entry[10:] != " 00000 n \n" {
+			t.Fatalf("xref entry %d is malformed: %q", object, entry)
+		}
+		header := fmt.Sprintf("%d 0 obj\n", object)
+		if !bytes.HasPrefix(out[offset:], []byte(header)) {
+			t.Errorf("xref entry %d points at %q, want %q", object, out[offset:offset+len(header)], header)
+		}
+	}
+}
+
+func TestRenderPDFStream(t *testing.T) {
+	out := renderSample(t, PDF, sampleReceipt())
+
+	match := regexp.MustCompile(`<< /Length (\d+) >>\nstream\n`).FindSubmatchIndex(out)
+	if match == nil {
+		t.Fatal("pdf has no content stream")
+	}
+	length, _ := strconv.Atoi(string(out[match[2]:match[3]]))
+	stream := out[match[1]:]
+	if !bytes.HasPrefix(stream[length:], []byte("\nendstream")) {
+		t.Errorf("stream length %d does not end at endstream", length)
+	}
+	// parentheses in the text are escaped inside PDF strings
+	if !bytes.Contains(stream[:length], []byte(`(  + extra \(sugar\)) Tj T*`)) {
+		t.Errorf("stream does not escape parentheses:\n%s", stream[:length])
+	}
+}
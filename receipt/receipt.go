@@ -0,0 +1,180 @@
+package receipt
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"main/model"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	HTML   = "html"
+	Text   = "text"
+	ESCPOS = "escpos"
+	PDF    = "pdf"
+)
+
+// DefaultWidth is the number of characters on a line of an 80mm roll.
+const DefaultWidth = 42
+
+var contentTypes = map[string]string{
+	HTML:   "text/html; charset=utf-8",
+	Text:   "text/plain; charset=utf-8",
+	ESCPOS: "application/octet-stream",
+	PDF:    "application/pdf",
+}
+
+//go:embed templates
+var templates embed.FS
+
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+func ValidFormat(format string) bool {
+	_, ok := contentTypes[format]
+	return ok
+}
+
+// Render writes the receipt in the given format. The plain-text template also
+// drives the ESC/POS and PDF output so that they match the printed receipt.
+func Render(w io.Writer, format string, data model.Receipt) error {
+	width := data.Settings.Width
+	if width == 0 {
+		width = DefaultWidth
+	}
+
+	label := map[string]interface{}{
+		"label": func(text string) string {
+			return Label(data.Locale, text)
+		},
+	}
+
+	if format == HTML {
+		tmpl, err := ParseHTML(data.Settings.HTMLTemplate, data.Settings.Currency)
+		if err != nil {
+			return err
+		}
+		return tmpl.Funcs(label).Execute(w, data)
+	}
+
+	tmpl, err := ParseText(data.Settings.TextTemplate, data.Settings.Currency, width)
+	if err != nil {
+		return err
+	}
+	tmpl.Funcs(label)
+
+	switch format {
+	case Text:
+		return tmpl.Execute(w, data)
+	case ESCPOS:
+		var text bytes.Buffer
+		if err := tmpl.Execute(&text, data); err != nil {
+			return err
+		}
+		return writeESCPOS(w, text.String())
+	case PDF:
+		var text bytes.Buffer
+		if err := tmpl.Execute(&text, data); err != nil {
+			return err
+		}
+		return writePDF(w, text.String(), width)
+	}
+	return fmt.Errorf("unknown receipt format %q", format)
+}
+
+// ParseText parses a plain-text receipt template, or the default one when
+// source is empty.
+func ParseText(source, currency string, width int) (*texttemplate.Template, error) {
+	if source == "" {
+		source = defaultTemplate("receipt.txt.tmpl")
+	}
+	return texttemplate.New("receipt").Funcs(funcs(currency, width)).Parse(source)
+}
+
+// ParseHTML parses an html receipt template, or the default one when source
+// is empty.
+func ParseHTML(source, currency string) (*htmltemplate.Template, error) {
+	if source == "" {
+		source = defaultTemplate("receipt.html.tmpl")
+	}
+	return htmltemplate.New("receipt").Funcs(funcs(currency, DefaultWidth)).Parse(source)
+}
+
+func defaultTemplate(name string) string {
+	source, err := templates.ReadFile("templates/" + name)
+	if err != nil {
+		panic(err)
+	}
+	return string(source)
+}
+
+func funcs(currency string, width int) map[string]interface{} {
+	return map[string]interface{}{
+		"money": func(amount float64) string {
+			return currency + strconv.FormatFloat(amount, 'f', 2, 64)
+		},
+		"quantity": func(quantity float64) string {
+			return strconv.FormatFloat(quantity, 'f', -1, 64)
+		},
+		"date": func(t time.Time) string {
+			return t.Format("2006-01-02 15:04")
+		},
+		"lines": func(text string) []string {
+			if text == "" {
+				return nil
+			}
+			return strings.Split(text, "\n")
+		},
+		"center": func(text string) string {
+			padding := (width - utf8.RuneCountInString(text)) / 2
+			if padding <= 0 {
+				return text
+			}
+			return strings.Repeat(" ", padding) + text
+		},
+		"columns": func(left, right string) string {
+			gap := width - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+			if gap < 1 {
+				// keep the amount aligned by moving it to its own line
+				left += "\n"
+				gap = width - utf8.RuneCountInString(right)
+				if gap < 0 {
+					gap = 0
+				}
+			}
+			return left + strings.Repeat(" ", gap) + right
+		},
+		"rule": func() string {
+			return strings.Repeat("-", width)
+		},
+		// replaced by the receipt's language when rendering
+		"label": func(text string) string {
+			return text
+		},
+	}
+}
+
+// encodeWinAnsi converts text to Windows-1252, which both the PDF standard
+// fonts and most receipt printers understand. Other characters become '?'.
+func encodeWinAnsi(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '€':
+			encoded = append(encoded, 0x80)
+		case r == '\n' || r >= 0x20 && r < 0x7f || r >= 0xa0 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
@@ -0,0 +1,107 @@
+package receipt
+
+import (
+	"bytes"
+	"main/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleReceipt() model.Receipt {
+	tip := 2.0
+	method := "CARD"
+	return model.Receipt{
+		Settings: model.ReceiptSettings{
+			RestaurantName: "Chez Nous",
+			Address:        "1 Main Street\nSpringfield",
+			Currency:       "€",
+			Width:          32,
+			Footer:         "Thank you!",
+		},
+		Number:      "INV-2024-0001",
+		TableNumber: 4,
+		Server:      "Ana",
+		IssuedAt:    time.Date(2024, 3, 1, 20, 15, 0, 0, time.UTC),
+		Items: []model.ReceiptLine{
+			{Name: "Crème brûlée", Quantity: 2, UnitPrice: 6, Total: 12, Modifiers: []string{"extra (sugar)"}},
+			{Name: "Water", Quantity: 1, UnitPrice: 2.5, Total: 2.5, Notes: "no ice"},
+		},
+		Subtotal:      14.5,
+		Discounts:     []model.ReceiptDiscount{{Label: "HAPPY10", Amount: 1.45}},
+		Taxes:         []model.ReceiptTax{{Label: "VAT 10%", Amount: 1.31}},
+		Tip:           &tip,
+		Total:         16.36,
+		PaymentMethod: &method,
+		PaymentStatus: "PAID",
+	}
+}
+
+func renderSample(t *testing.T, format string, data model.Receipt) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := Render(&out, format, data); err != nil {
+		t.Fatalf("Render(%s) failed: %v", format, err)
+	}
+	return out.Bytes()
+}
+
+func TestRenderText(t *testing.T) {
+	text := string(renderSample(t, Text, sampleReceipt()))
+
+	want := []string{
+		"           Chez Nous",
+		"Invoice         2024-03-01 20:15",
+		"INV-2024-0001",
+		"Table                          4",
+		"2 x Crème brûlée          €12.00",
+		"  + extra (sugar)",
+		"  * no ice",
+		"HAPPY10                   -€1.45",
+		"Tip                        €2.00",
+		"TOTAL                     €16.36",
+		"Status                      PAID",
+		"           Thank you!",
+	}
+	for _, line := range want {
+		if !strings.Contains(text, line+"\n") && !strings.HasSuffix(text, line) {
+			t.Errorf("receipt is missing line %q:\n%s", line, text)
+		}
+	}
+}
+
+func TestRenderTextLocale(t *testing.T) {
+	data := sampleReceipt()
+	data.Locale = "de-AT"
+	text := string(renderSample(t, Text, data))
+
+	for _, line := range []string{"Rechnung", "Trinkgeld", "GESAMT", "BEZAHLT"} {
+		if !strings.Contains(text, line) {
+			t.Errorf("receipt is missing %q:\n%s", line, text)
+		}
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	var out bytes.Buffer
+	if err := Render(&out, "docx", sampleReceipt()); err == nil {
+		t.Error("Render(docx) was allowed")
+	}
+}
+
+func TestEncodeWinAnsi(t *testing.T) {
+	tests := []struct {
+		text string
+		want []byte
+	}{
+		{"abc\n", []byte("abc\n")},
+		{"€5", []byte{0x80, '5'}},
+		{"é", []byte{0xe9}},
+		{"\t✓", []byte("??")},
+	}
+	for _, test := range tests {
+		if got := encodeWinAnsi(test.text); !bytes.Equal(got, test.want) {
+			t.Errorf("encodeWinAnsi(%q) = %x, want %x", test.text, got, test.want)
+		}
+	}
+}
@@ -8,11 +8,38 @@ import (
 
 func Use(router *chi.Mux) {
 	router.Group(func(r chi.Router) {
+		// batch routes
+		r.With(controller.Idempotent).Post("/foods:batchCreate", controller.BatchCreateFoods())
+		r.Patch("/foods:batchUpdate", controller.BatchUpdateFoods())
+		r.Delete("/foods:batchDelete", controller.BatchDeleteFoods())
+		r.With(controller.Idempotent).Post("/menus:batchCreate", controller.BatchCreateMenus())
+		r.Patch("/menus:batchUpdate", controller.BatchUpdateMenus())
+		r.Delete("/menus:batchDelete", controller.BatchDeleteMenus())
+		r.With(controller.Idempotent).Post("/tables:batchCreate", controller.BatchCreateTables())
+		r.Patch("/tables:batchUpdate", controller.BatchUpdateTables())
+		r.Delete("/tables:batchDelete", controller.BatchDeleteTables())
+		r.With(controller.Idempotent).Post("/ingredients:batchCreate", controller.BatchCreateIngredients())
+		r.Patch("/ingredients:batchUpdate", controller.BatchUpdateIngredients())
+		r.Delete("/ingredients:batchDelete", controller.BatchDeleteIngredients())
+		r.With(controller.Idempotent).Post("/suppliers:batchCreate", controller.BatchCreateSuppliers())
+		r.Patch("/suppliers:batchUpdate", controller.BatchUpdateSuppliers())
+		r.Delete("/suppliers:batchDelete", controller.BatchDeleteSuppliers())
+
+		// uploaded files when they are stored locally
+		if path, images := controller.ServeImages(); path != "" {
+			r.Handle(path+"/*", images)
+		}
+
 		// food routes
 		r.Route("/foods", func(r chi.Router) {
 			r.Get("/", controller.GetFoods())
-			r.Post("/", controller.CreateFood())
+			r.With(controller.Idempotent).Post("/", controller.CreateFood())
+			r.Get("/availability/events", controller.GetFoodAvailabilityEvents())
 			r.Get("/{food_id}", controller.GetFoodByID())
+			r.Put("/{food_id}/availability", controller.UpdateFoodAvailability())
+			r.Get("/{food_id}/cost", controller.GetFoodCostByID())
+			r.Post("/{food_id}/image", controller.UploadFoodImage())
+			r.Delete("/{food_id}/image", controller.DeleteFoodImage())
 			r.Patch("/{food_id}", controller.UpdateFoodByID())
 			r.Delete("/{food_id}", controller.DeleteFoodByID())
 		})
@@ -20,16 +47,80 @@ func Use(router *chi.Mux) {
 		// invoice routes
 		r.Route("/invoices", func(r chi.Router) {
 			r.Get("/", controller.GetInvoices())
-			r.Post("/", controller.CreateInvoice())
+			r.With(controller.Idempotent).Post("/", controller.CreateInvoice())
+			r.Get("/fiscal-chain", controller.VerifyInvoiceChain())
+			r.Get("/overdue", controller.GetOverdueInvoices())
+			r.Get("/reminders", controller.GetInvoiceReminders())
+			r.Get("/reminders/events", controller.GetInvoiceReminderEvents())
 			r.Get("/{invoice_id}", controller.GetInvoiceByID())
+			r.Get("/{invoice_id}/receipt", controller.GetInvoiceReceipt())
+			r.Post("/{invoice_id}/print", controller.PrintInvoiceReceipt())
+			r.With(controller.Idempotent).Post("/{invoice_id}/reissue", controller.ReissueInvoice())
+			r.With(controller.Idempotent).Post("/{invoice_id}/rewards", controller.RedeemLoyaltyReward())
+			r.Delete("/{invoice_id}/rewards/{discount_id}", controller.RemoveLoyaltyReward())
+			r.With(controller.Idempotent).Post("/{invoice_id}/gift-cards", controller.RedeemGiftCard())
+			r.Delete("/{invoice_id}/gift-cards/{payment_id}", controller.RemoveGiftCardPayment())
 			r.Patch("/{invoice_id}", controller.UpdateInvoiceByID())
 			r.Delete("/{invoice_id}", controller.DeleteInvoiceByID())
 		})
 
+		// customer routes
+		r.Route("/customers", func(r chi.Router) {
+			r.Get("/", controller.GetCustomers())
+			r.With(controller.Idempotent).Post("/", controller.CreateCustomer())
+			r.Get("/duplicates", controller.GetDuplicateCustomers())
+			r.Get("/{customer_id}", controller.GetCustomerByID())
+			r.Get("/{customer_id}/orders", controller.GetCustomerOrders())
+			r.Get("/{customer_id}/loyalty", controller.GetCustomerLoyalty())
+			r.Post("/{customer_id}/loyalty/adjustments", controller.AdjustLoyaltyPoints())
+			r.Post("/{customer_id}/merge", controller.MergeCustomers())
+			r.Patch("/{customer_id}", controller.UpdateCustomerByID())
+			r.Delete("/{customer_id}", controller.DeleteCustomerByID())
+		})
+
+		// house account routes
+		r.Route("/accounts", func(r chi.Router) {
+			r.Get("/", controller.GetAccounts())
+			r.With(controller.Idempotent).Post("/", controller.CreateAccount())
+			r.Get("/{account_id}", controller.GetAccountByID())
+			r.Get("/{account_id}/statement", controller.GetAccountStatement())
+			r.Patch("/{account_id}", controller.UpdateAccountByID())
+			r.Delete("/{account_id}", controller.DeleteAccountByID())
+		})
+
+		// promotion routes
+		r.Route("/promotions", func(r chi.Router) {
+			r.Get("/", controller.GetPromotions())
+			r.With(controller.Idempotent).Post("/", controller.CreatePromotion())
+			r.Get("/{promotion_id}", controller.GetPromotionByID())
+			r.Patch("/{promotion_id}", controller.UpdatePromotionByID())
+			r.Delete("/{promotion_id}", controller.DeletePromotionByID())
+		})
+
+		// gift card routes
+		r.Route("/gift-cards", func(r chi.Router) {
+			r.Get("/", controller.GetGiftCards())
+			r.With(controller.Idempotent).Post("/", controller.IssueGiftCard())
+			r.Get("/liability", controller.GetGiftCardLiability())
+			r.Get("/balance/{code}", controller.GetGiftCardBalance())
+			r.Get("/{gift_card_id}", controller.GetGiftCardByID())
+			r.Get("/{gift_card_id}/transactions", controller.GetGiftCardTransactions())
+			r.With(controller.Idempotent).Post("/{gift_card_id}/reload", controller.ReloadGiftCard())
+			r.Patch("/{gift_card_id}", controller.UpdateGiftCardByID())
+		})
+
+		// credit note routes
+		r.Route("/credit-notes", func(r chi.Router) {
+			r.Get("/", controller.GetCreditNotes())
+			r.With(controller.Idempotent).Post("/", controller.CreateCreditNote())
+			r.Get("/{creditNote_id}", controller.GetCreditNoteByID())
+		})
+
 		// menu routes
 		r.Route("/menus", func(r chi.Router) {
 			r.Get("/", controller.GetMenus())
-			r.Post("/", controller.CreateMenu())
+			r.With(controller.Idempotent).Post("/", controller.CreateMenu())
+			r.Get("/active", controller.GetActiveMenus())
 			r.Get("/{menu_id}", controller.GetMenuByID())
 			r.Patch("/{menu_id}", controller.UpdateMenuByID())
 			r.Delete("/{menu_id}", controller.DeleteMenuByID())
@@ -38,25 +129,101 @@ func Use(router *chi.Mux) {
 		// order routes
 		r.Route("/orders", func(r chi.Router) {
 			r.Get("/", controller.GetOrders())
-			r.Post("/", controller.CreateOrder())
+			r.With(controller.Idempotent).Post("/", controller.CreateOrder())
 			r.Get("/{order_id}", controller.GetOrderByID())
 			r.Patch("/{order_id}", controller.UpdateOrderByID())
 			r.Delete("/{order_id}", controller.DeleteOrderByID())
+			r.Post("/{order_id}/kitchen-tickets", controller.PrintKitchenTickets())
+			r.Get("/{order_id}/allergens", controller.GetOrderAllergenWarnings())
 		})
 
 		// table routes
 		r.Route("/tables", func(r chi.Router) {
 			r.Get("/", controller.GetTables())
-			r.Post("/", controller.CreateTable())
+			r.With(controller.Idempotent).Post("/", controller.CreateTable())
 			r.Get("/{table_id}", controller.GetTableByID())
 			r.Patch("/{table_id}", controller.UpdateTableByID())
 			r.Delete("/{table_id}", controller.DeleteTableByID())
 		})
 
+		// ingredient routes
+		r.Route("/ingredients", func(r chi.Router) {
+			r.Get("/", controller.GetIngredients())
+			r.With(controller.Idempotent).Post("/", controller.CreateIngredient())
+			r.Get("/alerts", controller.GetStockAlerts())
+			r.Get("/reorder-suggestions", controller.GetReorderSuggestions())
+			r.Patch("/alerts/{alert_id}", controller.AcknowledgeStockAlert())
+			r.Get("/{ingredient_id}", controller.GetIngredientByID())
+			r.Patch("/{ingredient_id}", controller.UpdateIngredientByID())
+			r.Delete("/{ingredient_id}", controller.DeleteIngredientByID())
+			r.With(controller.Idempotent).Post("/{ingredient_id}/adjustments", controller.AdjustIngredientStock())
+		})
+
+		// supplier routes
+		r.Route("/suppliers", func(r chi.Router) {
+			r.Get("/", controller.GetSuppliers())
+			r.With(controller.Idempotent).Post("/", controller.CreateSupplier())
+			r.Get("/{supplier_id}", controller.GetSupplierByID())
+			r.Patch("/{supplier_id}", controller.UpdateSupplierByID())
+			r.Delete("/{supplier_id}", controller.DeleteSupplierByID())
+		})
+
+		// purchaseOrder routes
+		r.Route("/purchaseOrders", func(r chi.Router) {
+			r.Get("/", controller.GetPurchaseOrders())
+			r.With(controller.Idempotent).Post("/", controller.CreatePurchaseOrder())
+			r.Get("/{purchaseOrder_id}", controller.GetPurchaseOrderByID())
+			r.Patch("/{purchaseOrder_id}", controller.UpdatePurchaseOrderByID())
+			r.Delete("/{purchaseOrder_id}", controller.DeletePurchaseOrderByID())
+			r.With(controller.Idempotent).Post("/{purchaseOrder_id}/receipts", controller.ReceivePurchaseOrder())
+		})
+
+		// import routes
+		r.Route("/imports", func(r chi.Router) {
+			r.With(controller.Idempotent).Post("/catalog", controller.ImportCatalog())
+		})
+
+		// printer routes
+		r.Route("/printers", func(r chi.Router) {
+			r.Get("/", controller.GetPrinters())
+			r.With(controller.Idempotent).Post("/", controller.CreatePrinter())
+			r.Get("/{printer_id}", controller.GetPrinterByID())
+			r.Patch("/{printer_id}", controller.UpdatePrinterByID())
+			r.Delete("/{printer_id}", controller.DeletePrinterByID())
+			r.Post("/{printer_id}/test", controller.PrintTestPage())
+		})
+
+		// printJob routes
+		r.Route("/printJobs", func(r chi.Router) {
+			r.Get("/", controller.GetPrintJobs())
+			r.Get("/{printJob_id}", controller.GetPrintJobByID())
+			r.Post("/{printJob_id}/retry", controller.RetryPrintJob())
+		})
+
+		// settings routes
+		r.Route("/settings", func(r chi.Router) {
+			r.Get("/receipt", controller.GetReceiptSettings())
+			r.Put("/receipt", controller.UpdateReceiptSettings())
+			r.Get("/loyalty", controller.GetLoyaltySettings())
+			r.Put("/loyalty", controller.UpdateLoyaltySettings())
+			r.Get("/localization", controller.GetLocalizationSettings())
+			r.Put("/localization", controller.UpdateLocalizationSettings())
+		})
+
+		// report routes
+		r.Route("/reports", func(r chi.Router) {
+			r.Get("/food-costs", controller.GetFoodCosts())
+			r.Get("/menu-engineering", controller.GetMenuEngineeringReport())
+			r.Get("/sales", controller.GetSalesReport())
+			r.Get("/sales/summary", controller.GetSalesSummary())
+			r.Get("/payment-methods", controller.GetPaymentMethodReport())
+			r.Get("/z-report", controller.GetZReport())
+		})
+
 		// orderItem routes
 		r.Route("/orderItems", func(r chi.Router) {
 			r.Get("/", controller.GetOrderItems())
-			r.Post("/", controller.CreateOrderItem())
+			r.With(controller.Idempotent).Post("/", controller.CreateOrderItem())
 			r.Get("/{orderItem_id}", controller.GetOrderItemByID())
 			r.Get("/order/{order_id}", controller.GetOrderItemsByOrder())
 			r.Patch("/{orderItem_id}", controller.UpdateOrderItemByID())
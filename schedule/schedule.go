@@ -0,0 +1,74 @@
+// Package schedule decides when menus and promotions are available from
+// their date range and weekly opening times.
+package schedule
+
+import (
+	"main/model"
+	"time"
+)
+
+var weekdays = [...]string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// Active reports whether now falls between the start and end date and, when
+// there are schedules, inside one of them. Schedules are evaluated in the
+// timezone and a schedule whose end time is before its start time runs past
+// midnight into the next day.
+func Active(startDate, endDate *time.Time, timezone string, schedules []model.AvailabilitySchedule, now time.Time) bool {
+	if startDate != nil && now.Before(*startDate) {
+		return false
+	}
+	if endDate != nil && now.After(*endDate) {
+		return false
+	}
+	if len(schedules) == 0 {
+		return true
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return false
+	}
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	today := weekdays[local.Weekday()]
+	yesterday := weekdays[(local.Weekday()+6)%7]
+
+	for _, schedule := range schedules {
+		start := clockMinute(schedule.StartTime)
+		end := clockMinute(schedule.EndTime)
+
+		if start <= end {
+			if minute >= start && minute < end && runsOn(schedule, today) {
+				return true
+			}
+		} else {
+			if minute >= start && runsOn(schedule, today) {
+				return true
+			}
+			if minute < end && runsOn(schedule, yesterday) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func runsOn(schedule model.AvailabilitySchedule, day string) bool {
+	if len(schedule.Days) == 0 {
+		return true
+	}
+	for _, scheduled := range schedule.Days {
+		if scheduled == day {
+			return true
+		}
+	}
+	return false
+}
+
+func clockMinute(clock string) int {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0
+	}
+	return parsed.Hour()*60 + parsed.Minute()
+}
@@ -0,0 +1,63 @@
+package schedule
+
+import (
+	"main/model"
+	"testing"
+	"time"
+)
+
+func at(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestActive(t *testing.T) {
+	start := at("2026-03-01T00:00:00Z")
+	end := at("2026-03-31T23:00:00Z")
+	lunch := model.AvailabilitySchedule{Days: []string{"MON", "TUE"}, StartTime: "11:00", EndTime: "15:00"}
+	everyDay := model.AvailabilitySchedule{StartTime: "11:00", EndTime: "15:00"}
+	lateNight := model.AvailabilitySchedule{Days: []string{"FRI"}, StartTime: "22:00", EndTime: "02:00"}
+	breakfast := model.AvailabilitySchedule{Days: []string{"SAT"}, StartTime: "08:00", EndTime: "10:00"}
+
+	// 2026-03-16 is a Monday
+	tests := []struct {
+		name      string
+		start     *time.Time
+		end       *time.Time
+		timezone  string
+		schedules []model.AvailabilitySchedule
+		now       string
+		want      bool
+	}{
+		{"always", nil, nil, "UTC", nil, "2026-03-16T03:00:00Z", true},
+		{"before start date", &start, &end, "UTC", nil, "2026-02-28T12:00:00Z", false},
+		{"on end date", &start, &end, "UTC", nil, "2026-03-31T23:00:00Z", true},
+		{"after end date", &start, &end, "UTC", nil, "2026-03-31T23:00:01Z", false},
+		{"inside schedule", nil, nil, "UTC", []model.AvailabilitySchedule{lunch}, "2026-03-16T12:00:00Z", true},
+		{"at schedule start", nil, nil, "UTC", []model.AvailabilitySchedule{lunch}, "2026-03-16T11:00:00Z", true},
+		{"at schedule end", nil, nil, "UTC", []model.AvailabilitySchedule{lunch}, "2026-03-16T15:00:00Z", false},
+		{"other day", nil, nil, "UTC", []model.AvailabilitySchedule{lunch}, "2026-03-18T12:00:00Z", false},
+		{"no days is every day", nil, nil, "UTC", []model.AvailabilitySchedule{everyDay}, "2026-03-22T12:00:00Z", true},
+		{"schedule outside date range", &start, &end, "UTC", []model.AvailabilitySchedule{lunch}, "2026-04-06T12:00:00Z", false},
+		{"overnight before midnight", nil, nil, "UTC", []model.AvailabilitySchedule{lateNight}, "2026-03-20T23:00:00Z", true},
+		{"overnight after midnight", nil, nil, "UTC", []model.AvailabilitySchedule{lateNight}, "2026-03-21T01:00:00Z", true},
+		{"overnight ended", nil, nil, "UTC", []model.AvailabilitySchedule{lateNight}, "2026-03-21T02:00:00Z", false},
+		{"overnight night before other day", nil, nil, "UTC", []model.AvailabilitySchedule{lateNight}, "2026-03-20T01:00:00Z", false},
+		{"overnight on other day", nil, nil, "UTC", []model.AvailabilitySchedule{lateNight}, "2026-03-21T23:00:00Z", false},
+		{"second schedule", nil, nil, "UTC", []model.AvailabilitySchedule{lunch, breakfast}, "2026-03-21T09:00:00Z", true},
+		{"local time", nil, nil, "Europe/Berlin", []model.AvailabilitySchedule{lunch}, "2026-03-16T10:30:00Z", true},
+		{"local time ended", nil, nil, "Europe/Berlin", []model.AvailabilitySchedule{lunch}, "2026-03-16T14:30:00Z", false},
+		{"local day", nil, nil, "Pacific/Auckland", []model.AvailabilitySchedule{lunch}, "2026-03-15T23:00:00Z", true},
+		{"unknown timezone", nil, nil, "Mars/Olympus", []model.AvailabilitySchedule{everyDay}, "2026-03-16T12:00:00Z", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Active(test.start, test.end, test.timezone, test.schedules, at(test.now)); got != test.want {
+				t.Errorf("Active() at %s = %v, want %v", test.now, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// ToRGBA gives a decoded image the pixel layout Resize reads, copying it only
+// when it has another one.
+func ToRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok {
+		return rgba
+	}
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	return rgba
+}
+
+// Resize scales the image down to width, averaging the pixels each target
+// pixel covers. Smaller images are left as they are.
+func Resize(src *image.RGBA, width int) image.Image {
+	bounds := src.Bounds()
+	if bounds.Dx() <= width {
+		return src
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*bounds.Dy()/height, (y+1)*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			x0, x1 := x*bounds.Dx()/width, (x+1)*bounds.Dx()/width
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.PixOffset(bounds.Min.X, bounds.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[row+sx*4+c])
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// EncodeImage writes resized variants as png when the original may have
+// transparency and as jpeg otherwise.
+func EncodeImage(img image.Image, contentType string) ([]byte, string, error) {
+	var out bytes.Buffer
+	if contentType == "image/png" || contentType == "image/gif" {
+		err := png.Encode(&out, img)
+		return out.Bytes(), "image/png", err
+	}
+	err := jpeg.Encode(&out, img, &jpeg.Options{Quality: 85})
+	return out.Bytes(), "image/jpeg", err
+}
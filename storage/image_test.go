@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// filled returns an image whose left half has the left color and whose
+// right half has the right one.
+func filled(width, height int, left, right color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.SetRGBA(x, y, left)
+			} else {
+				img.SetRGBA(x, y, right)
+			}
+		}
+	}
+	return img
+}
+
+var (
+	black = color.RGBA{0, 0, 0, 255}
+	white = color.RGBA{255, 255, 255, 255}
+	red   = color.RGBA{200, 0, 0, 255}
+)
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name          string
+		src           *image.RGBA
+		width         int
+		wantWidth     int
+		wantHeight    int
+		wantLeft      color.RGBA
+		wantRight     color.RGBA
+		wantUnchanged bool
+	}{
+		{
+			name:  "halved",
+			src:   filled(8, 4, black, white),
+			width: 4, wantWidth: 4, wantHeight: 2,
+			wantLeft: black, wantRight: white,
+		},
+		{
+			name:  "pixels averaged",
+			src:   filled(4, 2, black, white),
+			width: 1, wantWidth: 1, wantHeight: 1,
+			wantLeft: color.RGBA{127, 127, 127, 255}, wantRight: color.RGBA{127, 127, 127, 255},
+		},
+		{
+			name:  "at least one row",
+			src:   filled(100, 1, red, red),
+			width: 10, wantWidth: 10, wantHeight: 1,
+			wantLeft: red, wantRight: red,
+		},
+		{
+			name:  "smaller than the width",
+			src:   filled(10, 10, black, white),
+			width: 200, wantWidth: 10, wantHeight: 10,
+			wantLeft: black, wantRight: white, wantUnchanged: true,
+		},
+		{
+			name:  "sub image",
+			src:   filled(16, 4, white, black).SubImage(image.Rect(4, 0, 12, 4)).(*image.RGBA),
+			width: 2, wantWidth: 2, wantHeight: 1,
+			wantLeft: white, wantRight: black,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Resize(test.src, test.width)
+			bounds := got.Bounds()
+			if bounds.Dx() != test.wantWidth || bounds.Dy() != test.wantHeight {
+				t.Fatalf("Resize() is %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), test.wantWidth, test.wantHeight)
+			}
+			if test.wantUnchanged && got != image.Image(test.src) {
+				t.Error("Resize() copied an image that was small enough")
+			}
+			left := color.RGBAModel.Convert(got.At(bounds.Min.X, bounds.Min.Y))
+			right := color.RGBAModel.Convert(got.At(bounds.Max.X-1, bounds.Max.Y-1))
+			if left != test.wantLeft || right != test.wantRight {
+				t.Errorf("Resize() corners are %v and %v, want %v and %v", left, right, test.wantLeft, test.wantRight)
+			}
+		})
+	}
+}
+
+func TestToRGBA(t *testing.T) {
+	rgba := filled(2, 2, black, white)
+	if ToRGBA(rgba) != rgba {
+		t.Error("ToRGBA() copied an RGBA image")
+	}
+
+	gray := image.NewGray(image.Rect(3, 3, 5, 5))
+	gray.SetGray(4, 3, color.Gray{Y: 255})
+	got := ToRGBA(gray)
+	if got.Bounds() != image.Rect(0, 0, 2, 2) {
+		t.Fatalf("ToRGBA() bounds = %v, want %v", got.Bounds(), image.Rect(0, 0, 2, 2))
+	}
+	if got.RGBAAt(1, 0) != white || got.RGBAAt(0, 0) != black {
+		t.Errorf("ToRGBA() pixels = %v %v, want %v %v", got.RGBAAt(0, 0), got.RGBAAt(1, 0), black, white)
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	img := filled(4, 4, black, white)
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"image/jpeg", "image/jpeg"},
+		{"image/png", "image/png"},
+		{"image/gif", "image/png"},
+	}
+	for _, test := range tests {
+		t.Run(test.contentType, func(t *testing.T) {
+			data, contentType, err := EncodeImage(img, test.contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contentType != test.want {
+				t.Errorf("EncodeImage() type = %s, want %s", contentType, test.want)
+			}
+			if contentType == "image/png" {
+				if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+					t.Errorf("EncodeImage() wrote an unreadable png: %v", err)
+				}
+			}
+		})
+	}
+}
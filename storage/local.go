@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage keeps files in a directory and serves them itself.
+type LocalStorage struct {
+	dir     string
+	baseURL string
+}
+
+// filesOnly hides the directories, so that the stored keys cannot be listed.
+type filesOnly struct {
+	http.FileSystem
+}
+
+func (files filesOnly) Open(name string) (http.File, error) {
+	file, err := files.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
+
+func NewLocal(dir, baseURL string) *LocalStorage {
+	return &LocalStorage{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// written under a temporary name so that a file is never served half
+	// written
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// Path is the path of the base url, where ServeHTTP has to be mounted.
+func (s *LocalStorage) Path() string {
+	base, err := url.Parse(s.baseURL)
+	if err != nil {
+		return s.baseURL
+	}
+	return strings.TrimSuffix(base.Path, "/")
+}
+
+// ServeHTTP serves the stored files but not the directories holding them;
+// mount it under Path with the prefix stripped.
+func (s *LocalStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	http.FileServer(filesOnly{http.Dir(s.dir)}).ServeHTTP(w, r)
+}
+
+// path keeps keys from reaching outside the directory.
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || cleaned != "/"+key {
+		return "", errors.New("invalid storage key")
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(cleaned)), nil
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalServeHTTP(t *testing.T) {
+	local := NewLocal(t.TempDir(), "/uploads")
+	if err := local.Put(context.Background(), "foods/f1/a-original.jpg", []byte("image bytes"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/foods/f1/a-original.jpg", http.StatusOK},
+		{"/foods/f1/missing.jpg", http.StatusNotFound},
+		{"/foods/f1/", http.StatusNotFound},
+		{"/foods", http.StatusNotFound},
+		{"/", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			local.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if recorder.Code != test.want {
+				t.Errorf("GET %s = %d, want %d", test.path, recorder.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{"/uploads", "/uploads"},
+		{"/uploads/", "/uploads"},
+		{"/static/images", "/static/images"},
+		{"https://example.com/media/", "/media"},
+	}
+	for _, test := range tests {
+		t.Run(test.baseURL, func(t *testing.T) {
+			if got := NewLocal("uploads", test.baseURL).Path(); got != test.want {
+				t.Errorf("Path() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
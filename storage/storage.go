@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+const (
+	Local = "local"
+	S3    = "s3"
+)
+
+// Storage keeps uploaded files under slash separated keys and tells where
+// clients can fetch them.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// FromEnv returns the storage selected by STORAGE_DRIVER. Files go to the
+// local directory STORAGE_DIR unless the driver is s3, which is configured
+// with the S3_* variables.
+func FromEnv() (Storage, error) {
+	switch driver := getenv("STORAGE_DRIVER", Local); driver {
+	case Local:
+		return NewLocal(getenv("STORAGE_DIR", "uploads"), getenv("STORAGE_BASE_URL", "/uploads")), nil
+	case S3:
+		s3 := &S3Storage{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          getenv("S3_REGION", "us-east-1"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+		}
+		if s3.Endpoint == "" || s3.Bucket == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for s3 storage")
+		}
+		return s3, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+func getenv(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}